@@ -20,6 +20,9 @@ var Source = "adb.arcadeitalia.net"
 // ErrNotFound is returned when a game is not found.
 var ErrNotFound = errors.New("rom not found")
 
+// Client is the http.Client used to get games. It can be replaced to cache responses.
+var Client = http.DefaultClient
+
 type Result struct {
 	ID             string `json:"game_name"`
 	Genre          string `json:"genre"`
@@ -61,7 +64,7 @@ func GetGame(ctx context.Context, name string) (*GameResp, error) {
 		return nil, err
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
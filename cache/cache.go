@@ -0,0 +1,177 @@
+// Package cache stores the responses of the metadata APIs on disk.
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sselph/scraper/ss"
+)
+
+// ErrOffline is returned when a response isn't in the cache in offline mode.
+var ErrOffline = errors.New("not in cache")
+
+// DefaultNotFoundTTL is how long a 404 is used by default. It is short since games
+// are added to the APIs all the time.
+const DefaultNotFoundTTL = 24 * time.Hour
+
+// Key returns the cache key of a request URL. The credentials are removed so
+// the cache can be shared and doesn't change when they do.
+func Key(u *url.URL) string {
+	s, err := url.Parse(ss.SanitizeURL(u.String()))
+	if err != nil {
+		return u.String()
+	}
+	q := s.Query()
+	q.Del("apikey")
+	s.RawQuery = q.Encode()
+	return s.String()
+}
+
+type hitKey struct{}
+
+// WithHit returns a context that records if the response of the request made with
+// it was read from the cache. Callers counting requests against a quota use it to
+// skip the responses that weren't requested.
+func WithHit(ctx context.Context) (context.Context, *bool) {
+	hit := new(bool)
+	return context.WithValue(ctx, hitKey{}, hit), hit
+}
+
+// setHit records that the response of the request was read from the cache.
+func setHit(req *http.Request) {
+	if hit, ok := req.Context().Value(hitKey{}).(*bool); ok {
+		*hit = true
+	}
+}
+
+// Offline is an http.RoundTripper that fails every request with ErrOffline.
+type Offline struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (Offline) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, ErrOffline
+}
+
+// Transport is an http.RoundTripper that caches the responses of GET requests.
+// Only responses with a 200 or 404 status are stored so errors are retried, and
+// 404s are only used for NotFoundTTL so new games are found.
+type Transport struct {
+	// Dir is the directory the responses are stored in.
+	Dir string
+	// TTL is how long a response is used before it is requested again.
+	TTL time.Duration
+	// NotFoundTTL is how long a 404 response is used before it is requested again.
+	NotFoundTTL time.Duration
+	// Offline only uses the cache and never makes a request. Expired responses are used.
+	Offline bool
+	// Transport makes the requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// New returns a Transport storing responses in dir.
+func New(dir string, ttl time.Duration, offline bool) (*Transport, error) {
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return nil, err
+	}
+	nf := DefaultNotFoundTTL
+	if ttl < nf {
+		nf = ttl
+	}
+	return &Transport{Dir: dir, TTL: ttl, NotFoundTTL: nf, Offline: offline}, nil
+}
+
+// Client returns an http.Client using the Transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) path(req *http.Request) string {
+	h := fmt.Sprintf("%x", sha1.Sum([]byte(Key(req.URL))))
+	return filepath.Join(t.Dir, h[:2], h)
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		if t.Offline {
+			return nil, ErrOffline
+		}
+		return t.transport().RoundTrip(req)
+	}
+	p := t.path(req)
+	if fi, err := os.Stat(p); err == nil {
+		if resp, err := read(p, req); err == nil {
+			ttl := t.TTL
+			if resp.StatusCode == http.StatusNotFound {
+				ttl = t.NotFoundTTL
+			}
+			if t.Offline || time.Since(fi.ModTime()) < ttl {
+				setHit(req)
+				return resp, nil
+			}
+			resp.Body.Close()
+		}
+	}
+	if t.Offline {
+		return nil, ErrOffline
+	}
+	resp, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return resp, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err := write(p, resp); err != nil {
+		log.Printf("ERR: Can't cache response: %s", err)
+	}
+	return resp, nil
+}
+
+// read loads the response stored at p.
+func read(p string, req *http.Request) (*http.Response, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+}
+
+// write stores the response at p. The file is replaced atomically so
+// concurrent requests never read a partial response.
+func write(p string, resp *http.Response) error {
+	b, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0775); err != nil {
+		return err
+	}
+	return writeFile(p, b)
+}
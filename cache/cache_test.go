@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/api?sha1=abc&ssid=me&sspassword=pw&devid=d&devpassword=p&softname=s", "https://example.com/api?devid=xxx&devpassword=yyy&sha1=abc&softname=zzz"},
+		{"https://example.com/v1/Games/ByGameID?apikey=secret&id=1", "https://example.com/v1/Games/ByGameID?devid=xxx&devpassword=yyy&id=1&softname=zzz"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Key(u); got != test.want {
+			t.Errorf("Key(%q) => %q; want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/error":
+			http.Error(w, "quota", 429)
+		default:
+			w.Write([]byte("game " + r.URL.Query().Get("id")))
+		}
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tr, err := New(dir, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := tr.Client()
+	get := func(c *http.Client, p string) (int, string, error) {
+		resp, err := c.Get(srv.URL + p)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), err
+	}
+	tests := []struct {
+		path   string
+		status int
+		body   string
+		calls  int
+	}{
+		{"/game?id=1&ssid=a", 200, "game 1", 1},
+		{"/game?id=1&ssid=b", 200, "game 1", 1},
+		{"/game?id=2", 200, "game 2", 2},
+		{"/missing", 404, "404 page not found\n", 3},
+		{"/missing", 404, "404 page not found\n", 3},
+		{"/error", 429, "quota\n", 4},
+		{"/error", 429, "quota\n", 5},
+	}
+	for _, test := range tests {
+		status, body, err := get(c, test.path)
+		if err != nil {
+			t.Fatalf("Get(%q) => err = %v; want nil", test.path, err)
+		}
+		if status != test.status || body != test.body || calls != test.calls {
+			t.Errorf("Get(%q) => %d, %q, %d calls; want %d, %q, %d calls", test.path, status, body, calls, test.status, test.body, test.calls)
+		}
+	}
+
+	for _, test := range []struct {
+		path string
+		hit  bool
+	}{
+		{"/game?id=1", true},
+		{"/game?id=4", false},
+	} {
+		ctx, hit := WithHit(context.Background())
+		req, err := http.NewRequest("GET", srv.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("Get(%q) => err = %v; want nil", test.path, err)
+		}
+		resp.Body.Close()
+		if *hit != test.hit {
+			t.Errorf("Get(%q) => hit %t; want %t", test.path, *hit, test.hit)
+		}
+	}
+
+	tr.NotFoundTTL = 0
+	get(c, "/missing")
+	if calls != 7 {
+		t.Errorf("Get(expired 404) => %d calls; want 7 calls", calls)
+	}
+	get(c, "/game?id=1")
+	if calls != 7 {
+		t.Errorf("Get(cached) with an expired 404 TTL => %d calls; want 7 calls", calls)
+	}
+
+	tr.TTL = 0
+	if _, body, _ := get(c, "/game?id=1"); body != "game 1" || calls != 8 {
+		t.Errorf("Get(expired) => %q, %d calls; want %q, 8 calls", body, calls, "game 1")
+	}
+
+	tr.Offline = true
+	if _, body, err := get(c, "/game?id=2"); err != nil || body != "game 2" || calls != 8 {
+		t.Errorf("Get(offline) => %q, %v, %d calls; want %q, nil, 8 calls", body, err, calls, "game 2")
+	}
+	if _, _, err := get(c, "/game?id=3"); err == nil {
+		t.Errorf("Get(offline miss) => err = nil; want %v", ErrOffline)
+	}
+}
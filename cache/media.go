@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes used to create files from the media cache.
+const (
+	Copy     = "copy"
+	Hardlink = "hardlink"
+	Symlink  = "symlink"
+)
+
+// Media is a content-addressed store of downloaded images and videos. Files are
+// stored once by the SHA1 of their contents and found by a key identifying the
+// source. The least recently used files are removed when the store is larger
+// than MaxSize. The order of use is kept in memory and in the modification times
+// of the files so it is kept between runs.
+type Media struct {
+	// Dir is the directory the files are stored in.
+	Dir string
+	// MaxSize is the maximum size of the stored files in bytes.
+	MaxSize int64
+	// Mode is how files are created from the store: Copy, Hardlink or Symlink.
+	// Symlinks break if the file is evicted.
+	Mode string
+
+	mu   sync.Mutex
+	size int64
+	// lru holds the stored files from the most to the least recently used and
+	// index finds them by SHA1.
+	lru   *list.List
+	index map[string]*list.Element
+}
+
+// entry is a stored file in the LRU list.
+type entry struct {
+	sum  string
+	size int64
+}
+
+// NewMedia returns the media store in dir.
+func NewMedia(dir string, maxSize int64, mode string) (*Media, error) {
+	switch mode {
+	case Copy, Hardlink, Symlink:
+	default:
+		return nil, fmt.Errorf("invalid media cache mode %q", mode)
+	}
+	m := &Media{Dir: dir, MaxSize: maxSize, Mode: mode, lru: list.New(), index: make(map[string]*list.Element)}
+	for _, d := range []string{m.blobDir(), m.keyDir()} {
+		if err := os.MkdirAll(d, 0775); err != nil {
+			return nil, err
+		}
+	}
+	blobs, err := m.blobs()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byModTime(blobs))
+	for _, b := range blobs {
+		m.index[b.Name()] = m.lru.PushFront(&entry{b.Name(), b.Size()})
+		m.size += b.Size()
+	}
+	return m, nil
+}
+
+func (m *Media) blobDir() string {
+	return filepath.Join(m.Dir, "blobs")
+}
+
+func (m *Media) keyDir() string {
+	return filepath.Join(m.Dir, "keys")
+}
+
+func (m *Media) keyPath(key string) string {
+	return filepath.Join(m.keyDir(), fmt.Sprintf("%x", sha1.Sum([]byte(key))))
+}
+
+func (m *Media) blobPath(sum string) string {
+	return filepath.Join(m.blobDir(), sum[:2], sum)
+}
+
+type blob struct {
+	os.FileInfo
+	p string
+}
+
+type byModTime []blob
+
+func (b byModTime) Len() int           { return len(b) }
+func (b byModTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byModTime) Less(i, j int) bool { return b[i].ModTime().Before(b[j].ModTime()) }
+
+// blobs returns the stored files.
+func (m *Media) blobs() ([]blob, error) {
+	var out []blob
+	err := filepath.Walk(m.blobDir(), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), "tmp") {
+			out = append(out, blob{fi, p})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Get creates the file p from the file stored for key. It returns false if nothing is stored.
+func (m *Media) Get(key, p string) (bool, error) {
+	b, err := ioutil.ReadFile(m.keyPath(key))
+	if err != nil || len(b) < 2 {
+		return false, nil
+	}
+	sum := string(b)
+	src := m.blobPath(sum)
+	if !m.touch(sum) {
+		os.Remove(m.keyPath(key))
+		return false, nil
+	}
+	if err := m.create(src, p); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// create creates p from the stored file src.
+func (m *Media) create(src, p string) error {
+	os.Remove(p)
+	switch m.Mode {
+	case Hardlink:
+		if err := os.Link(src, p); err == nil {
+			return nil
+		}
+	case Symlink:
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(abs, p)
+	}
+	return copyFile(src, p)
+}
+
+// Put stores the file p for key. Empty files aren't stored.
+func (m *Media) Put(key, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tmp, err := ioutil.TempFile(m.blobDir(), "tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha1.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), f)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || n == 0 {
+		return err
+	}
+	sum := fmt.Sprintf("%x", h.Sum(nil))
+	if err := m.add(sum, tmp.Name(), n); err != nil {
+		return err
+	}
+	if err := writeFile(m.keyPath(key), []byte(sum)); err != nil {
+		return err
+	}
+	return m.evict()
+}
+
+// touch marks the stored file as the most recently used. It returns false if the
+// file isn't stored.
+func (m *Media) touch(sum string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.touchLocked(sum)
+}
+
+// touchLocked is touch with m.mu held.
+func (m *Media) touchLocked(sum string) bool {
+	e, ok := m.index[sum]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if err := os.Chtimes(m.blobPath(sum), now, now); err != nil {
+		m.remove(e)
+		return false
+	}
+	m.lru.MoveToFront(e)
+	return true
+}
+
+// add stores the file tmp of n bytes as sum unless it is already stored. The check
+// and the rename are done under the lock so concurrent Puts of the same data only
+// count it once.
+func (m *Media) add(sum, tmp string, n int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.touchLocked(sum) {
+		return nil
+	}
+	dst := m.blobPath(sum)
+	if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	m.index[sum] = m.lru.PushFront(&entry{sum, n})
+	m.size += n
+	return nil
+}
+
+// remove removes the file from the index. m.mu must be held.
+func (m *Media) remove(e *list.Element) {
+	x := e.Value.(*entry)
+	m.lru.Remove(e)
+	delete(m.index, x.sum)
+	m.size -= x.size
+}
+
+// evict removes the least recently used files until the store fits in MaxSize.
+func (m *Media) evict() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.size > m.MaxSize && m.lru.Len() > 0 {
+		e := m.lru.Back()
+		if err := os.Remove(m.blobPath(e.Value.(*entry).sum)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		m.remove(e)
+	}
+	return nil
+}
+
+// writeFile writes the file atomically.
+func writeFile(p string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(p), "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
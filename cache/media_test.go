@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, mode := range []string{Copy, Hardlink, Symlink} {
+		m, err := NewMedia(filepath.Join(dir, "cache-"+mode), 1<<20, mode)
+		if err != nil {
+			t.Fatalf("NewMedia(%s) => err = %v; want nil", mode, err)
+		}
+		src := filepath.Join(dir, "src-"+mode+".png")
+		if err := ioutil.WriteFile(src, []byte("image data"), 0664); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := m.Get("a", src); ok || err != nil {
+			t.Errorf("%s: Get(a) => %t, %v; want false, nil", mode, ok, err)
+		}
+		if err := m.Put("a", src); err != nil {
+			t.Fatalf("%s: Put(a) => err = %v; want nil", mode, err)
+		}
+		if err := m.Put("b", src); err != nil {
+			t.Fatalf("%s: Put(b) => err = %v; want nil", mode, err)
+		}
+		if blobs, _ := m.blobs(); len(blobs) != 1 {
+			t.Errorf("%s: Put(b) with the same data => %d files; want 1", mode, len(blobs))
+		}
+		dst := filepath.Join(dir, "dst-"+mode+".png")
+		ok, err := m.Get("b", dst)
+		if !ok || err != nil {
+			t.Fatalf("%s: Get(b) => %t, %v; want true, nil", mode, ok, err)
+		}
+		b, err := ioutil.ReadFile(dst)
+		if err != nil || string(b) != "image data" {
+			t.Errorf("%s: Get(b) => %q, %v; want %q", mode, b, err, "image data")
+		}
+	}
+	if _, err := NewMedia(filepath.Join(dir, "bad"), 1, "move"); err == nil {
+		t.Errorf("NewMedia(move) => err = nil; want invalid mode")
+	}
+}
+
+func TestMediaEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := NewMedia(filepath.Join(dir, "cache"), 10, Copy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"aaaa", "bbbb", "cccc"}
+	for i, data := range files {
+		p := filepath.Join(dir, data)
+		if err := ioutil.WriteFile(p, []byte(data), 0664); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Put(data, p); err != nil {
+			t.Fatalf("Put(%q) => err = %v; want nil", data, err)
+		}
+		// Make the order of use deterministic.
+		old := time.Now().Add(time.Duration(i-10) * time.Minute)
+		blobs, _ := m.blobs()
+		for _, b := range blobs {
+			if b.ModTime().After(old) {
+				os.Chtimes(b.p, old, old)
+			}
+		}
+		if i == 1 {
+			// Using aaaa makes bbbb the least recently used.
+			if ok, _ := m.Get("aaaa", filepath.Join(dir, "out")); !ok {
+				t.Fatalf("Get(aaaa) => false; want true")
+			}
+		}
+	}
+	want := map[string]bool{"aaaa": true, "bbbb": false, "cccc": true}
+	for k, w := range want {
+		if ok, _ := m.Get(k, filepath.Join(dir, "out")); ok != w {
+			t.Errorf("Get(%q) => %t; want %t", k, ok, w)
+		}
+	}
+}
+
+func TestMediaConcurrentPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := NewMedia(filepath.Join(dir, "cache"), 1<<20, Copy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "src.png")
+	if err := ioutil.WriteFile(p, []byte("image data"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := m.Put(fmt.Sprintf("key%d", i), p); err != nil {
+				t.Errorf("Put(key%d) => err = %v; want nil", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if m.size != 10 || m.lru.Len() != 1 {
+		t.Errorf("Put() of the same data => size %d, %d files; want 10, 1", m.size, m.lru.Len())
+	}
+	m, err = NewMedia(filepath.Join(dir, "cache"), 1<<20, Copy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.size != 10 || m.lru.Len() != 1 {
+		t.Errorf("NewMedia() => size %d, %d files; want 10, 1", m.size, m.lru.Len())
+	}
+}
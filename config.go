@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sselph/scraper/ds"
+	"gopkg.in/yaml.v2"
+)
+
+// configNames are the names of the config file looked for in the cache directory.
+var configNames = []string{"config.toml", "config.yaml", "config.yml", "config.json"}
+
+// config is the config file. Every key is the name of a flag without the leading dash
+// except for systems which contains a section per es_systems.cfg system name that
+// overrides the top level values for that system. With scrape_all the sources are
+// only created once so flags like console_src can't be overridden per system.
+type config struct {
+	values  map[string]interface{}
+	systems map[string]map[string]interface{}
+}
+
+// findConfig returns the path of the config file in the cache directory or "" if there is none.
+func findConfig() (string, error) {
+	dir, err := ds.DefaultCachePath()
+	if err != nil {
+		return "", err
+	}
+	for _, n := range configNames {
+		p := filepath.Join(dir, n)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// loadConfig parses the config file at path p. The format is chosen by the extension.
+func loadConfig(p string) (*config, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".json":
+		err = json.Unmarshal(b, &raw)
+	case ".yaml", ".yml":
+		var y map[interface{}]interface{}
+		err = yaml.Unmarshal(b, &y)
+		if err == nil {
+			raw, err = stringKeys(y)
+		}
+	case ".toml":
+		_, err = toml.Decode(string(b), &raw)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format", p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	c := &config{values: raw, systems: make(map[string]map[string]interface{})}
+	if s, ok := raw["systems"]; ok {
+		delete(raw, "systems")
+		systems, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: systems must be a table of systems", p)
+		}
+		for name, v := range systems {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: system %s must be a table of flags", p, name)
+			}
+			c.systems[name] = m
+		}
+	}
+	if err := checkValues(c.values); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	for name, m := range c.systems {
+		if err := checkValues(m); err != nil {
+			return nil, fmt.Errorf("%s: system %s: %v", p, name, err)
+		}
+	}
+	return c, nil
+}
+
+// startupFlags are the flags that can't be set in the config because they are used
+// before it is read.
+var startupFlags = map[string]bool{
+	"config":     true,
+	"scrape_all": true,
+	"version":    true,
+}
+
+// globalFlags are the flags that are only read once before the systems are scraped.
+// With scrape_all they can't be overridden per system.
+var globalFlags = map[string]bool{
+	"cache_ttl":        true,
+	"console_src":      true,
+	"daily_quotas":     true,
+	"dat_files":        true,
+	"gdb_apikey":       true,
+	"hash_file":        true,
+	"img_workers":      true,
+	"mame":             true,
+	"mame_src":         true,
+	"media_cache_mode": true,
+	"media_cache_size": true,
+	"offline":          true,
+	"output_format":    true,
+	"rate_limits":      true,
+	"rehash":           true,
+	"rom_dir":          true,
+	"ss_password":      true,
+	"ss_user":          true,
+	"throttle_retries": true,
+	"update_cache":     true,
+	"workers":          true,
+}
+
+// checkValues returns an error if a key isn't a flag or a value isn't a single value
+// or a list.
+func checkValues(values map[string]interface{}) error {
+	for k, v := range values {
+		if flag.Lookup(k) == nil {
+			return fmt.Errorf("unknown flag %q", k)
+		}
+		if startupFlags[k] {
+			return fmt.Errorf("%s can't be set in the config", k)
+		}
+		switch v := v.(type) {
+		case map[string]interface{}, []map[string]interface{}:
+			return fmt.Errorf("invalid value for %s: a table isn't a flag value", k)
+		case []interface{}:
+			for _, x := range v {
+				switch x.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("invalid value for %s: only lists of values are allowed", k)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkSystems returns an error if the section of a system sets a flag that can't be
+// overridden per system with scrape_all.
+func (c *config) checkSystems() error {
+	for name, m := range c.systems {
+		for k := range m {
+			if globalFlags[k] {
+				return fmt.Errorf("config: system %s: %s can't be set per system with scrape_all", name, k)
+			}
+		}
+	}
+	return nil
+}
+
+// has returns true if the key is set at the top level or in the section of the system.
+func (c *config) has(system, key string) bool {
+	if _, ok := c.values[key]; ok {
+		return true
+	}
+	_, ok := c.systems[system][key]
+	return ok
+}
+
+// stringKeys converts the maps decoded by yaml to have string keys like json.
+func stringKeys(m map[interface{}]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	for k, v := range m {
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("key %v is not a string", k)
+		}
+		if vm, ok := v.(map[interface{}]interface{}); ok {
+			var err error
+			if v, err = stringKeys(vm); err != nil {
+				return nil, err
+			}
+		}
+		out[ks] = v
+	}
+	return out, nil
+}
+
+// configValue converts a config value to the string form used by the flag.
+func configValue(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		var s []string
+		for _, x := range v {
+			s = append(s, configValue(x))
+		}
+		return strings.Join(s, ",")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// setFlags sets the flags to the values. Flags in cli were set on the command-line
+// and are skipped. It returns a function to restore the previous values.
+func setFlags(values map[string]interface{}, cli map[string]bool) (func(), error) {
+	old := make(map[string]string)
+	restore := func() {
+		for k, v := range old {
+			flag.Set(k, v)
+		}
+	}
+	for k, v := range values {
+		if cli[k] {
+			continue
+		}
+		old[k] = flag.Lookup(k).Value.String()
+		if err := flag.Set(k, configValue(v)); err != nil {
+			restore()
+			return nil, fmt.Errorf("config: invalid value for %s: %v", k, err)
+		}
+	}
+	return restore, nil
+}
+
+// apply sets the flags from the top level of the config.
+func (c *config) apply(cli map[string]bool) error {
+	_, err := setFlags(c.values, cli)
+	return err
+}
+
+// applySystem sets the flags from the section of the system and returns a
+// function to restore the values for the next system.
+func (c *config) applySystem(name string, cli map[string]bool) (func(), error) {
+	return setFlags(c.systems[name], cli)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testTOML = `
+# Global values.
+console_img = "b,s" # trailing comment
+max_width = 400
+download_videos = true
+
+[systems.arcade]
+region = "jp,us"
+
+[systems."snes"]
+console_img = [
+  "s",
+  "b", # box art
+]
+`
+
+func TestLoadConfigTOML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(p, []byte(testTOML+"\n[systems.nes]\nlang = [\"en,fr\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(p)
+	if err != nil {
+		t.Fatalf("loadConfig(%q) => err = %v; want nil", p, err)
+	}
+	want := map[string]interface{}{
+		"console_img":     "b,s",
+		"max_width":       int64(400),
+		"download_videos": true,
+	}
+	if !reflect.DeepEqual(c.values, want) {
+		t.Errorf("loadConfig() => %v; want %v", c.values, want)
+	}
+	wantSystems := map[string]map[string]interface{}{
+		"arcade": {"region": "jp,us"},
+		"snes":   {"console_img": []interface{}{"s", "b"}},
+		"nes":    {"lang": []interface{}{"en,fr"}},
+	}
+	if !reflect.DeepEqual(c.systems, wantSystems) {
+		t.Errorf("loadConfig() => systems %v; want %v", c.systems, wantSystems)
+	}
+	if !c.has("arcade", "region") || c.has("snes", "region") || !c.has("snes", "max_width") {
+		t.Errorf("has() doesn't match the top level and system values")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"config.toml": testTOML,
+		"config.yaml": "console_img: b,s\nmax_width: 400\ndownload_videos: true\nsystems:\n  arcade:\n    region: jp,us\n  snes:\n    console_img: [s, b]\n",
+		"config.json": `{"console_img": "b,s", "max_width": 400, "download_videos": true, "systems": {"arcade": {"region": "jp,us"}, "snes": {"console_img": ["s", "b"]}}}`,
+	}
+	defer func() {
+		*consoleImg, *maxWidth, *downloadVideos, *region = "b", 400, false, "us,wor,eu,jp,fr,xx"
+	}()
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		*consoleImg, *maxWidth, *downloadVideos = "b", 100, false
+		c, err := loadConfig(p)
+		if err != nil {
+			t.Errorf("loadConfig(%q) => err = %v; want nil", name, err)
+			continue
+		}
+		if err := c.apply(map[string]bool{"max_width": true}); err != nil {
+			t.Errorf("%s: apply() => err = %v; want nil", name, err)
+			continue
+		}
+		if *consoleImg != "b,s" || *maxWidth != 100 || !*downloadVideos {
+			t.Errorf("%s: apply() => console_img=%q max_width=%d download_videos=%t; want b,s 100 true", name, *consoleImg, *maxWidth, *downloadVideos)
+		}
+		restore, err := c.applySystem("snes", nil)
+		if err != nil {
+			t.Errorf("%s: applySystem() => err = %v; want nil", name, err)
+			continue
+		}
+		if *consoleImg != "s,b" {
+			t.Errorf("%s: applySystem(snes) => console_img=%q; want s,b", name, *consoleImg)
+		}
+		restore()
+		if *consoleImg != "b,s" {
+			t.Errorf("%s: restore() => console_img=%q; want b,s", name, *consoleImg)
+		}
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, tc := range []struct {
+		name, data string
+	}{
+		{"config.json", `{"no_such_flag": 1}`},
+		{"config.json", `{"systems": {"snes": {"no_such_flag": 1}}}`},
+		{"config.json", `{"systems": {"snes": {"scrape_all": true}}}`},
+		{"config.json", `{"config": "other.json"}`},
+		{"config.json", `{"region": {"us": true}}`},
+		{"config.toml", "[[systems]]\nregion = \"us\"\n"},
+		{"config.toml", "[region]\nus = true\n"},
+		{"config.toml", "region = [\"us\"\n"},
+	} {
+		p := filepath.Join(dir, fmt.Sprintf("%d-%s", i, tc.name))
+		if err := ioutil.WriteFile(p, []byte(tc.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(p); err == nil {
+			t.Errorf("loadConfig(%q) => err = nil; want an error", tc.data)
+		}
+	}
+}
+
+func TestConfigCheckSystems(t *testing.T) {
+	c := &config{systems: map[string]map[string]interface{}{"snes": {"region": "us"}}}
+	if err := c.checkSystems(); err != nil {
+		t.Errorf("checkSystems() with region => err = %v; want nil", err)
+	}
+	c.systems["arcade"] = map[string]interface{}{"mame_src": "adb"}
+	if err := c.checkSystems(); err == nil {
+		t.Errorf("checkSystems() with mame_src => err = nil; want an error")
+	}
+}
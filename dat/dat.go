@@ -0,0 +1,283 @@
+// Package dat reads Logiqx XML DAT files such as the ones published by No-Intro and Redump.
+package dat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sselph/scraper/naming"
+)
+
+// ROM is a single file of a Game.
+type ROM struct {
+	Name   string `xml:"name,attr"`
+	Size   int64  `xml:"size,attr"`
+	CRC    string `xml:"crc,attr"`
+	MD5    string `xml:"md5,attr"`
+	SHA1   string `xml:"sha1,attr"`
+	Status string `xml:"status,attr"`
+}
+
+// Game is a single game, or machine for MAME, in a DAT.
+type Game struct {
+	Name         string `xml:"name,attr"`
+	CloneOf      string `xml:"cloneof,attr"`
+	RomOf        string `xml:"romof,attr"`
+	Description  string `xml:"description"`
+	Year         string `xml:"year"`
+	Manufacturer string `xml:"manufacturer"`
+	// Serial is one or more comma-separated product serials. Not all DATs include it.
+	Serial string `xml:"serial"`
+	ROMs   []ROM  `xml:"rom"`
+}
+
+// Header is the header of a DAT.
+type Header struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Version     string `xml:"version"`
+}
+
+// File is a parsed DAT file. Both the <game> elements of Logiqx DATs and
+// the <machine> elements of MAME's -listxml are read into Games.
+type File struct {
+	Header   Header `xml:"header"`
+	Games    []Game `xml:"game"`
+	Machines []Game `xml:"machine"`
+}
+
+// Parse parses a DAT.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	if err := d.Decode(f); err != nil {
+		return nil, fmt.Errorf("dat: cannot parse: %v", err)
+	}
+	f.Games = append(f.Games, f.Machines...)
+	f.Machines = nil
+	return f, nil
+}
+
+// ParseFile parses the DAT at path p.
+func ParseFile(p string) (*File, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// entry is a ROM and the Game it belongs to.
+type entry struct {
+	game *Game
+	rom  *ROM
+}
+
+// DB is an index of one or more DATs.
+type DB struct {
+	games  []*Game
+	names  map[string]*Game
+	sha1   map[string][]entry
+	md5    map[string][]entry
+	crc    map[string][]entry
+	tracks map[string]*Game
+	serial map[string]*Game
+}
+
+// New creates a DB from DAT files.
+func New(files ...*File) *DB {
+	db := &DB{
+		names:  make(map[string]*Game),
+		sha1:   make(map[string][]entry),
+		md5:    make(map[string][]entry),
+		crc:    make(map[string][]entry),
+		tracks: make(map[string]*Game),
+		serial: make(map[string]*Game),
+	}
+	for _, f := range files {
+		for i := range f.Games {
+			db.add(&f.Games[i])
+		}
+	}
+	return db
+}
+
+// Load parses the DATs at the paths and creates a DB.
+func Load(paths ...string) (*DB, error) {
+	var files []*File
+	for _, p := range paths {
+		f, err := ParseFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		files = append(files, f)
+	}
+	return New(files...), nil
+}
+
+func (db *DB) add(g *Game) {
+	db.games = append(db.games, g)
+	if _, ok := db.names[g.Name]; !ok {
+		db.names[g.Name] = g
+	}
+	for i := range g.ROMs {
+		r := &g.ROMs[i]
+		e := entry{g, r}
+		if r.SHA1 != "" {
+			k := strings.ToLower(r.SHA1)
+			db.sha1[k] = append(db.sha1[k], e)
+		}
+		if r.MD5 != "" {
+			k := strings.ToLower(r.MD5)
+			db.md5[k] = append(db.md5[k], e)
+		}
+		if r.CRC != "" {
+			k := strings.ToLower(r.CRC)
+			db.crc[k] = append(db.crc[k], e)
+		}
+	}
+	var sums []string
+	for _, r := range g.ROMs {
+		if isSheet(r.Name) {
+			continue
+		}
+		if r.SHA1 == "" {
+			sums = nil
+			break
+		}
+		sums = append(sums, r.SHA1)
+	}
+	if len(sums) > 0 {
+		db.tracks[trackKey(sums)] = g
+	}
+	for _, x := range strings.Split(g.Serial, ",") {
+		if k := serialKey(x); k != "" {
+			if _, ok := db.serial[k]; !ok {
+				db.serial[k] = g
+			}
+		}
+	}
+}
+
+// serialKey normalizes a serial so SLUS-00594, SLUS_005.94 and slus 00594 are the same.
+func serialKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// isSheet returns true if the file is a cue sheet or gdi that describes the tracks
+// rather than being a track. Sheets are often regenerated so they aren't used for matching.
+func isSheet(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".cue", ".gdi":
+		return true
+	}
+	return false
+}
+
+// trackKey creates a key for a set of SHA1s that doesn't depend on order.
+func trackKey(sums []string) string {
+	s := make([]string, len(sums))
+	for i, x := range sums {
+		s[i] = strings.ToLower(x)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+// Tracks returns the Game whose tracks exactly match the set of SHA1s.
+func (db *DB) Tracks(sha1s []string) (*Game, bool) {
+	if len(sha1s) == 0 {
+		return nil, false
+	}
+	g, ok := db.tracks[trackKey(sha1s)]
+	return g, ok
+}
+
+// Digests are the digests of a ROM used to find it in the DB. Empty values are ignored.
+type Digests struct {
+	CRC32 string
+	MD5   string
+	SHA1  string
+	Size  int64
+}
+
+// sizeMatch returns true if the sizes match or either is unknown.
+func sizeMatch(r *ROM, size int64) bool {
+	return r.Size == 0 || size == 0 || r.Size == size
+}
+
+// ROM finds the Game and ROM matching the digests. SHA1 is preferred, then MD5 and
+// finally CRC32 which also requires the size to match.
+func (db *DB) ROM(d Digests) (*Game, *ROM, bool) {
+	if d.SHA1 != "" {
+		for _, e := range db.sha1[strings.ToLower(d.SHA1)] {
+			if sizeMatch(e.rom, d.Size) {
+				return e.game, e.rom, true
+			}
+		}
+	}
+	if d.MD5 != "" {
+		for _, e := range db.md5[strings.ToLower(d.MD5)] {
+			if sizeMatch(e.rom, d.Size) {
+				return e.game, e.rom, true
+			}
+		}
+	}
+	if d.CRC32 != "" && d.Size != 0 {
+		for _, e := range db.crc[strings.ToLower(d.CRC32)] {
+			if e.rom.Size == d.Size {
+				return e.game, e.rom, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// Serial returns the Game with the product serial.
+func (db *DB) Serial(serial string) (*Game, bool) {
+	k := serialKey(serial)
+	if k == "" {
+		return nil, false
+	}
+	g, ok := db.serial[k]
+	return g, ok
+}
+
+// Game returns the Game with the name. For MAME this is the set name.
+func (db *DB) Game(name string) (*Game, bool) {
+	g, ok := db.names[name]
+	return g, ok
+}
+
+// Parent returns the parent of a clone.
+func (db *DB) Parent(g *Game) (*Game, bool) {
+	if g.CloneOf == "" {
+		return nil, false
+	}
+	return db.Game(g.CloneOf)
+}
+
+// Regions returns the regions of the game from the name, e.g. "Game (USA, Europe)" returns [us eu].
+func (g *Game) Regions() []string {
+	return naming.Parse(g.Name).Regions
+}
+
+// Languages returns the languages of the game from the name, e.g. "Game (Europe) (En,Fr)" returns [en fr].
+func (g *Game) Languages() []string {
+	return naming.Parse(g.Name).Languages
+}
@@ -0,0 +1,154 @@
+package dat
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDAT = `<?xml version="1.0"?>
+<!DOCTYPE datafile PUBLIC "-//Logiqx//DTD ROM Management Datafile//EN" "http://www.logiqx.com/dtds/datafile.dtd">
+<datafile>
+	<header>
+		<name>Sony - PlayStation</name>
+		<version>20170101</version>
+	</header>
+	<game name="Game (USA) (Disc 1)">
+		<description>Game (USA) (Disc 1)</description>
+		<serial>SLUS-00594, SLUS-00595</serial>
+		<rom name="Game (USA) (Disc 1).cue" size="100" crc="00000001" sha1="0000000000000000000000000000000000000001"/>
+		<rom name="Game (USA) (Disc 1) (Track 1).bin" size="1000" crc="00000002" sha1="AAAA000000000000000000000000000000000002"/>
+		<rom name="Game (USA) (Disc 1) (Track 2).bin" size="2000" crc="00000003" sha1="0000000000000000000000000000000000000003"/>
+	</game>
+</datafile>`
+
+func TestTracks(t *testing.T) {
+	f, err := Parse(strings.NewReader(testDAT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := New(f)
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{[]string{"0000000000000000000000000000000000000003", "aaaa000000000000000000000000000000000002"}, "Game (USA) (Disc 1)"},
+		{[]string{"aaaa000000000000000000000000000000000002"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		g, ok := db.Tracks(tt.in)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("db.Tracks(%v) => %q; want not found", tt.in, g.Name)
+			}
+			continue
+		}
+		if !ok || g.Name != tt.want {
+			t.Errorf("db.Tracks(%v) => %v, %t; want %q", tt.in, g, ok, tt.want)
+		}
+	}
+}
+
+func TestSerial(t *testing.T) {
+	f, err := Parse(strings.NewReader(testDAT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := New(f)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"SLUS-00594", "Game (USA) (Disc 1)"},
+		{"slus_005.95", "Game (USA) (Disc 1)"},
+		{"SLUS-00596", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		g, ok := db.Serial(tt.in)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("db.Serial(%q) => %q; want not found", tt.in, g.Name)
+			}
+			continue
+		}
+		if !ok || g.Name != tt.want {
+			t.Errorf("db.Serial(%q) => %v, %t; want %q", tt.in, g, ok, tt.want)
+		}
+	}
+}
+
+const testMAME = `<?xml version="1.0"?>
+<mame build="0.190">
+	<machine name="sf2">
+		<description>Street Fighter II: The World Warrior (World 910522)</description>
+		<year>1991</year>
+		<manufacturer>Capcom</manufacturer>
+		<rom name="sf2e_30g.11e" size="131072" crc="fe39ee33" sha1="22558eb15e035b09b80935a32b8425d91cd79669"/>
+	</machine>
+	<machine name="sf2j" cloneof="sf2" romof="sf2">
+		<description>Street Fighter II: The World Warrior (Japan 911210)</description>
+		<rom name="sf2j30.bin" size="131072" crc="79022b31" sha1="b7cfaa5b35e29f5dfe1e8b96dc1b5f2ea6ec6fa8"/>
+	</machine>
+</mame>`
+
+func TestROM(t *testing.T) {
+	f, err := Parse(strings.NewReader(testDAT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Parse(strings.NewReader(testMAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := New(f, m)
+	tests := []struct {
+		in   Digests
+		want string
+	}{
+		{Digests{SHA1: "B7CFAA5B35E29F5DFE1E8B96DC1B5F2EA6EC6FA8"}, "sf2j"},
+		{Digests{SHA1: "b7cfaa5b35e29f5dfe1e8b96dc1b5f2ea6ec6fa8", Size: 1}, ""},
+		{Digests{CRC32: "FE39EE33", Size: 131072}, "sf2"},
+		{Digests{CRC32: "fe39ee33"}, ""},
+	}
+	for _, tt := range tests {
+		g, _, ok := db.ROM(tt.in)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("db.ROM(%+v) => %q; want not found", tt.in, g.Name)
+			}
+			continue
+		}
+		if !ok || g.Name != tt.want {
+			t.Errorf("db.ROM(%+v) => %v, %t; want %q", tt.in, g, ok, tt.want)
+		}
+	}
+	g, ok := db.Game("sf2j")
+	if !ok {
+		t.Fatalf("db.Game(%q) => not found", "sf2j")
+	}
+	if p, ok := db.Parent(g); !ok || p.Name != "sf2" {
+		t.Errorf("db.Parent(%q) => %v, %t; want sf2", g.Name, p, ok)
+	}
+}
+
+func TestRegionsLanguages(t *testing.T) {
+	tests := []struct {
+		name    string
+		regions string
+		langs   string
+	}{
+		{"Game (USA, Europe) (En,Fr,De) (Rev 1)", "us,eu", "en,fr,de"},
+		{"Game (Japan)", "jp", ""},
+		{"Game (Beta)", "", ""},
+	}
+	for _, tt := range tests {
+		g := &Game{Name: tt.name}
+		if got := strings.Join(g.Regions(), ","); got != tt.regions {
+			t.Errorf("Regions(%q) => %q; want %q", tt.name, got, tt.regions)
+		}
+		if got := strings.Join(g.Languages(), ","); got != tt.langs {
+			t.Errorf("Languages(%q) => %q; want %q", tt.name, got, tt.langs)
+		}
+	}
+}
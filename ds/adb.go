@@ -3,7 +3,6 @@ package ds
 import (
 	"context"
 	"fmt"
-	"path/filepath"
 	"regexp"
 
 	"github.com/sselph/scraper/adb"
@@ -18,9 +17,7 @@ type ADB struct {
 
 // getID gets the ID for the game..
 func (a *ADB) getID(p string) (string, error) {
-	b := filepath.Base(p)
-	id := b[:len(b)-len(filepath.Ext(b))]
-	return id, nil
+	return fileID(p), nil
 }
 
 // GetName implements DS.
@@ -42,7 +39,7 @@ func (a *ADB) GetGame(ctx context.Context, p string) (*Game, error) {
 	}
 	r, err := adb.GetGame(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, quotaErr(err)
 	}
 	if len(r.Results) == 0 {
 		return nil, ErrNotFound
@@ -56,6 +53,7 @@ func (a *ADB) GetGame(ctx context.Context, p string) (*Game, error) {
 	game.Genre = g.Genre
 	game.CloneOf = g.CloneOf
 	game.Source = adb.Source
+	game.Match = MatchFilename
 	game.Players = g.Players
 	game.Rating = float64(g.Rating) / 100
 	if g.History != "" {
@@ -20,7 +20,7 @@ func (d *Daphne) getID(p string) (string, error) {
 	if filepath.Ext(p) != ".daphne" {
 		return "", ErrNotFound
 	}
-	gameID := filepath.Base(p)
+	gameID := fileID(p) + ".daphne"
 	switch {
 	case strings.HasPrefix(gameID, "lair2_"):
 		gameID = "lair2_*.daphne"
@@ -38,7 +38,7 @@ func (d *Daphne) getID(p string) (string, error) {
 
 // GetName implements DS.
 func (d *Daphne) GetName(p string) string {
-	gameID := filepath.Base(p)
+	gameID := fileID(p) + ".daphne"
 	n, ok := d.HM.Name(gameID)
 	if !ok {
 		return ""
@@ -61,5 +61,6 @@ func (d *Daphne) GetGame(ctx context.Context, p string) (*Game, error) {
 	}
 
 	result := ParseGDBGame(*resp)
+	result.Match = MatchFilename
 	return result, nil
 }
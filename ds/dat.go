@@ -0,0 +1,109 @@
+package ds
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sselph/scraper/dat"
+	"github.com/sselph/scraper/rom/header"
+)
+
+// DAT is a DataSource using local Logiqx XML DAT files such as the No-Intro,
+// Redump and MAME -listxml DATs. ROMs are matched by CRC32, MD5 or SHA1 and size
+// and then by set name. If Hasher is nil only the set name is used.
+type DAT struct {
+	DB     *dat.DB
+	Hasher *Hasher
+}
+
+// datGame converts a dat.Game into a Game filling in missing values from the parent.
+func (d *DAT) datGame(g *dat.Game) *Game {
+	ret := NewGame()
+	ret.ID = g.Name
+	ret.Source = "dat"
+	ret.GameTitle = g.Description
+	if ret.GameTitle == "" {
+		ret.GameTitle = g.Name
+	}
+	year, manufacturer := g.Year, g.Manufacturer
+	if p, ok := d.DB.Parent(g); ok {
+		ret.CloneOf = p.Name
+		if year == "" {
+			year = p.Year
+		}
+		if manufacturer == "" {
+			manufacturer = p.Manufacturer
+		}
+	}
+	if _, err := strconv.Atoi(year); err == nil {
+		ret.ReleaseDate = toXMLDate(year)
+	}
+	ret.Developer = manufacturer
+	ret.Region = strings.Join(g.Regions(), ",")
+	ret.Lang = strings.Join(g.Languages(), ",")
+	return ret
+}
+
+// find finds the game by the digests of the ROM, then by the serial in the ROM header
+// and finally by set name. It also returns how the game was matched.
+func (d *DAT) find(p string) (*dat.Game, string, bool) {
+	if d.Hasher != nil {
+		if h, err := d.Hasher.Digests(p); err == nil {
+			if g, _, ok := d.DB.ROM(dat.Digests{CRC32: h.CRC32, MD5: h.MD5, SHA1: h.SHA1, Size: h.Size}); ok {
+				return g, MatchHash, true
+			}
+		}
+		if info, err := header.Read(p); err == nil {
+			if g, ok := d.DB.Serial(info.Serial); ok {
+				return g, MatchSerial, true
+			}
+		}
+	}
+	b := filepath.Base(p)
+	g, ok := d.DB.Game(b[:len(b)-len(filepath.Ext(b))])
+	return g, MatchFilename, ok
+}
+
+// GetName implements DS.
+func (d *DAT) GetName(p string) string {
+	g, _, ok := d.find(p)
+	if !ok {
+		return ""
+	}
+	return g.Description
+}
+
+// GetGame implements DS.
+func (d *DAT) GetGame(ctx context.Context, p string) (*Game, error) {
+	g, match, ok := d.find(p)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	ret := d.datGame(g)
+	ret.Match = match
+	return ret, nil
+}
+
+// GetDiscGame implements DiscDS.
+func (d *DAT) GetDiscGame(ctx context.Context, tracks []string) (*Game, error) {
+	if d.Hasher == nil {
+		return nil, ErrNotFound
+	}
+	var sums []string
+	for _, t := range tracks {
+		h, err := d.Hasher.Hash(t)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, h)
+	}
+	g, ok := d.DB.Tracks(sums)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	ret := d.datGame(g)
+	ret.Match = MatchSHA1
+	return ret, nil
+}
@@ -22,6 +22,8 @@ import (
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/nfnt/resize"
+	"github.com/sselph/scraper/limit"
+	"github.com/sselph/scraper/ss"
 )
 
 const (
@@ -33,6 +35,18 @@ const (
 // ErrNotFound is the error returned when a rom can't be found in the source.
 var ErrNotFound = errors.New("hash not found")
 
+// ErrQuota is the error returned when the source can't be used because the quota of requests is used.
+var ErrQuota = errors.New("source quota reached")
+
+// quotaErr returns ErrQuota if err is from a request the rate limiter didn't make
+// because the daily quota of the host is used. Other errors are returned as is.
+func quotaErr(err error) error {
+	if limit.IsQuota(err) {
+		return ErrQuota
+	}
+	return err
+}
+
 // ErrImgNotFound is the error returned when a rom image can't be found.
 var ErrImgNotFound = errors.New("image not found")
 
@@ -82,6 +96,17 @@ type Game struct {
 	Genre       string
 	Players     int64
 	CloneOf     string
+	// Region is a comma-separated list of region codes, e.g. "us,eu".
+	Region string
+	// Lang is a comma-separated list of language codes, e.g. "en,fr".
+	Lang string
+	// Fuzzy is true if the game was found by searching its name instead of an exact match.
+	Fuzzy bool
+	// Match is how the source identified the game, ie MatchSHA1 or MatchFilename.
+	Match string
+	// Provenance maps the fields, images and videos to where their values came from.
+	// It is set by Record and Merge.
+	Provenance map[string]Provenance
 }
 
 // NewGame returns a new Game.
@@ -93,6 +118,9 @@ func NewGame() *Game {
 	return g
 }
 
+// Client is the http.Client used to download images and videos.
+var Client = http.DefaultClient
+
 // DS is the interface all DataSoures should implement.
 type DS interface {
 	// GetName takes the path of a ROM and returns the Pretty name if it differs from the Sources normal name.
@@ -101,6 +129,20 @@ type DS interface {
 	GetGame(context.Context, string) (*Game, error)
 }
 
+// DiscDS is implemented by DataSources that can identify a whole disc from all of its tracks.
+type DiscDS interface {
+	// GetDiscGame takes the paths of every track of a disc and returns the Game.
+	GetDiscGame(context.Context, []string) (*Game, error)
+}
+
+// Searcher is implemented by DataSources that can also find a game by the name of
+// the file when its hash isn't known, e.g. hacks and translations.
+type Searcher interface {
+	// SearchGame takes the path of a ROM and returns the best match for its name. It
+	// is only used once for a ROM after no source found any of its files.
+	SearchGame(context.Context, string) (*Game, error)
+}
+
 type Video interface {
 	Save(ctx context.Context, p string) error
 	Ext() string
@@ -124,7 +166,7 @@ func (v HTTPVideo) Save(ctx context.Context, p string) error {
 		return err
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -153,6 +195,22 @@ type Image interface {
 	Save(ctx context.Context, p string, w, h uint) error
 }
 
+// CacheKey returns the key used to cache the image or video when it is saved
+// with the max width w and height h. It returns "" if it can't be cached.
+func CacheKey(v interface{}, w, h uint) string {
+	switch v := v.(type) {
+	case HTTPImage:
+		return fmt.Sprintf("%s|%dx%d", v.URL, w, h)
+	case HTTPImageSS:
+		return ss.SanitizeURL(ssImgURL(v.URL, int(w), int(h)))
+	case HTTPVideo:
+		return v.URL
+	case HTTPVideoSS:
+		return ss.SanitizeURL(v.URL)
+	}
+	return ""
+}
+
 type HTTPImage struct {
 	URL   string
 	Limit chan struct{}
@@ -201,7 +259,7 @@ func getImage(ctx context.Context, url string, w, h uint) (image.Image, error) {
 		return nil, err
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
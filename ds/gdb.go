@@ -3,10 +3,15 @@ package ds
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sselph/scraper/gdb"
+	"github.com/sselph/scraper/naming"
 )
 
 // GDB is a DataSource using thegamesdb.net
@@ -165,12 +170,135 @@ func (g *GDB) GetGame(ctx context.Context, p string) (*Game, error) {
 	}
 	resp, err := gdb.GetGame(ctx, g.APIKey, id)
 	if err != nil {
-		return nil, err
+		return nil, quotaErr(err)
 	}
 	if resp == nil {
 		return nil, fmt.Errorf("game with id (%s) not found", id)
 	}
 
 	result := ParseGDBGame(*resp)
+	result.Match = MatchSHA1
 	return result, nil
 }
+
+// maxPlatformFiles is the most files of a directory hashed to find its platform.
+const maxPlatformFiles = 10
+
+// GDBSearch is a DataSource using thegamesdb.net that finds games by the name of the
+// file instead of the hash. Games found this way are marked as fuzzy. The platform
+// searched is the system in the hash map of the file or of other files in its
+// directory. Nothing is searched when the platform isn't known.
+type GDBSearch struct {
+	HM     *HashMap
+	Hasher *Hasher
+	APIKey string
+	// Threshold is the minimum similarity from 0 to 1 of the names.
+	Threshold float64
+
+	dirs *dirPlatforms
+}
+
+// dirPlatforms caches the platform of the files of each directory by extension.
+type dirPlatforms struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+// NewGDBSearch returns a new GDBSearch.
+func NewGDBSearch(apikey string, hm *HashMap, hasher *Hasher) *GDBSearch {
+	return &GDBSearch{
+		HM:     hm,
+		Hasher: hasher,
+		APIKey: apikey,
+		dirs:   &dirPlatforms{m: make(map[string]int)},
+	}
+}
+
+// system returns the system of the file in the hash map.
+func (g *GDBSearch) system(p string) (int, bool) {
+	h, err := g.Hasher.Hash(p)
+	if err != nil {
+		return 0, false
+	}
+	return g.HM.System(h)
+}
+
+// platform returns the thegamesdb.net platform ID of the file or 0 if unknown.
+func (g *GDBSearch) platform(p string) int {
+	if g.HM == nil || g.Hasher == nil {
+		return 0
+	}
+	if id, ok := g.system(p); ok {
+		return id
+	}
+	if g.dirs == nil {
+		return 0
+	}
+	dir, ext := filepath.Dir(p), strings.ToLower(filepath.Ext(p))
+	g.dirs.mu.Lock()
+	defer g.dirs.mu.Unlock()
+	k := filepath.Join(dir, "*"+ext)
+	if id, ok := g.dirs.m[k]; ok {
+		return id
+	}
+	fi, _ := ioutil.ReadDir(dir)
+	var id, n int
+	for _, f := range fi {
+		if f.IsDir() || strings.ToLower(filepath.Ext(f.Name())) != ext {
+			continue
+		}
+		fp := filepath.Join(dir, f.Name())
+		if fp == p {
+			continue
+		}
+		if n++; n > maxPlatformFiles {
+			break
+		}
+		if s, ok := g.system(fp); ok {
+			id = s
+			break
+		}
+	}
+	g.dirs.m[k] = id
+	return id
+}
+
+// GetName implements DS
+func (g *GDBSearch) GetName(p string) string {
+	return ""
+}
+
+// GetGame implements DS. Games are only found by SearchGame.
+func (g *GDBSearch) GetGame(ctx context.Context, p string) (*Game, error) {
+	return nil, ErrNotFound
+}
+
+// SearchGame implements Searcher.
+func (g *GDBSearch) SearchGame(ctx context.Context, p string) (*Game, error) {
+	platform := g.platform(p)
+	if platform == 0 {
+		return nil, ErrNotFound
+	}
+	name := searchName(p)
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	games, err := gdb.SearchByName(ctx, g.APIKey, name, platform)
+	if err != nil {
+		return nil, quotaErr(err)
+	}
+	var best *gdb.ParsedGame
+	bestScore := -1.0
+	for i, game := range games {
+		if score := naming.Similarity(name, game.Name); score > bestScore {
+			best, bestScore = &games[i], score
+		}
+	}
+	if best == nil || bestScore < g.Threshold {
+		return nil, ErrNotFound
+	}
+	gdb.AddImages(ctx, g.APIKey, best)
+	ret := ParseGDBGame(*best)
+	ret.Fuzzy = true
+	return ret, nil
+}
@@ -0,0 +1,57 @@
+package ds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGDBSearchPlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"snes/a.sfc", "snes/b.sfc", "snes/c.txt", "other/d.sfc"} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hasher, err := NewHasher(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := hasher.Hash(filepath.Join(dir, "snes", "a.sfc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := filepath.Join(dir, "hash.csv")
+	if err := ioutil.WriteFile(csv, []byte(fmt.Sprintf("%s,1,6,A\n", h)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hm, err := FileHashMap(csv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGDBSearch("", hm, hasher)
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"snes/a.sfc", 6},
+		{"snes/b.sfc", 6},
+		{"snes/c.txt", 0},
+		{"other/d.sfc", 0},
+	}
+	for _, test := range tests {
+		if got := g.platform(filepath.Join(dir, filepath.FromSlash(test.path))); got != test.want {
+			t.Errorf("platform(%q) => %d; want %d", test.path, got, test.want)
+		}
+	}
+}
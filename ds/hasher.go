@@ -1,53 +1,137 @@
 package ds
 
 import (
+	"encoding/json"
 	"fmt"
-	"hash"
+	"log"
+	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/hashicorp/golang-lru"
 	rh "github.com/sselph/scraper/rom/hash"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
-// Hasher is a thread-safe object to hash files. Hashes are cached and
-// multiple calls to hash the same file wait for the first call to complete to read from cache.
+const (
+	hashCacheName = "hash_cache"
+	// hashAlgo identifies the digests stored in the persistent cache.
+	hashAlgo = "crc32,md5,sha1"
+)
+
+// hashEntry is the value stored in the persistent hash cache.
+type hashEntry struct {
+	Size    int64      `json:"size"`
+	ModTime int64      `json:"mtime"`
+	Digests rh.Digests `json:"digests"`
+}
+
+// Hasher is a thread-safe object to hash files. The CRC32, MD5 and SHA1 are computed
+// in a single pass and cached, and multiple calls to hash the same file wait for the
+// first call to complete to read from cache.
 type Hasher struct {
-	h  func() hash.Hash
-	c  *lru.Cache
-	cl *sync.Mutex
-	l  map[string]*sync.Mutex
-	b  chan []byte
+	c      *lru.Cache
+	cl     *sync.Mutex
+	l      map[string]*sync.Mutex
+	b      chan []byte
+	db     *leveldb.DB
+	rehash bool
 }
 
-// Hash returns the hash of the file at the given path.
+// Hash returns the SHA1 of the file at the given path.
 func (h *Hasher) Hash(p string) (string, error) {
-	chash, ok := h.c.Get(p)
+	d, err := h.Digests(p)
+	if err != nil {
+		return "", err
+	}
+	return d.SHA1, nil
+}
+
+// Digests returns the CRC32, MD5 and SHA1 of the file at the given path.
+func (h *Hasher) Digests(p string) (rh.Digests, error) {
+	cd, ok := h.c.Get(p)
 	if ok {
-		switch chash := chash.(type) {
+		switch cd := cd.(type) {
 		default:
-			return "", fmt.Errorf("unexpected type %T", chash)
-		case string:
-			return chash, nil
+			return rh.Digests{}, fmt.Errorf("unexpected type %T", cd)
+		case rh.Digests:
+			return cd, nil
 		case error:
-			return "", chash
+			return rh.Digests{}, cd
 		}
 	}
 	hl, ok := h.getPathLock(p)
 	if ok {
 		hl.Lock()
 		hl.Unlock()
-		return h.Hash(p)
+		return h.Digests(p)
 	}
 	defer h.deletePathLock(p)
+	key, fi := h.dbKey(p)
+	if d, ok := h.dbGet(key, fi); ok {
+		h.c.Add(p, d)
+		return d, nil
+	}
 	b := <-h.b
-	phash, err := rh.Hash(p, h.h(), b)
+	d, err := rh.HashAll(p, b)
 	h.b <- b
 	if err != nil {
 		h.c.Add(p, err)
-		return "", err
+		return rh.Digests{}, err
+	}
+	h.c.Add(p, d)
+	if err := h.dbPut(key, fi, d); err != nil {
+		log.Printf("ERR: Can't cache the hash of %s: %s", p, err)
+	}
+	return d, nil
+}
+
+// dbKey returns the persistent cache key for the path and its current stat.
+// It returns an empty key if there is no persistent cache or the file can't be stat'd.
+func (h *Hasher) dbKey(p string) (string, os.FileInfo) {
+	if h.db == nil {
+		return "", nil
+	}
+	ap, err := filepath.Abs(p)
+	if err != nil {
+		return "", nil
+	}
+	fi, err := os.Stat(ap)
+	if err != nil {
+		return "", nil
+	}
+	return hashAlgo + "\x00" + ap, fi
+}
+
+// dbGet returns the persisted digests if the size and modification time still match.
+func (h *Hasher) dbGet(key string, fi os.FileInfo) (rh.Digests, bool) {
+	if key == "" || h.rehash {
+		return rh.Digests{}, false
 	}
-	h.c.Add(p, phash)
-	return phash, nil
+	b, err := h.db.Get([]byte(key), nil)
+	if err != nil {
+		return rh.Digests{}, false
+	}
+	var e hashEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return rh.Digests{}, false
+	}
+	if e.Size != fi.Size() || e.ModTime != fi.ModTime().UnixNano() || e.Digests.SHA1 == "" {
+		return rh.Digests{}, false
+	}
+	return e.Digests, true
+}
+
+// dbPut persists the digests along with the stat they were computed from.
+func (h *Hasher) dbPut(key string, fi os.FileInfo, d rh.Digests) error {
+	if key == "" {
+		return nil
+	}
+	b, err := json.Marshal(hashEntry{Size: fi.Size(), ModTime: fi.ModTime().UnixNano(), Digests: d})
+	if err != nil {
+		return err
+	}
+	return h.db.Put([]byte(key), b, nil)
 }
 
 func (h *Hasher) getPathLock(p string) (*sync.Mutex, bool) {
@@ -70,9 +154,17 @@ func (h *Hasher) deletePathLock(p string) {
 	delete(h.l, p)
 }
 
-// NewHasher creates a new Hasher that hashes using the provided hash.
-// threads is the expected number of threads a 4MB buffer will be created for each.
-func NewHasher(hashFunc func() hash.Hash, threads int) (*Hasher, error) {
+// Close closes the persistent cache if there is one.
+func (h *Hasher) Close() error {
+	if h.db == nil {
+		return nil
+	}
+	return h.db.Close()
+}
+
+// NewHasher creates a new Hasher.
+// threads is the expected number of threads a 1MB buffer will be created for each.
+func NewHasher(threads int) (*Hasher, error) {
 	c, err := lru.New(500)
 	if err != nil {
 		return nil, err
@@ -82,5 +174,29 @@ func NewHasher(hashFunc func() hash.Hash, threads int) (*Hasher, error) {
 	for i := 0; i < threads; i++ {
 		b <- make([]byte, 1*1024*1024)
 	}
-	return &Hasher{h: hashFunc, c: c, cl: &sync.Mutex{}, l: l, b: b}, nil
+	return &Hasher{c: c, cl: &sync.Mutex{}, l: l, b: b}, nil
+}
+
+// NewCachedHasher creates a new Hasher that also persists hashes to disk in p.
+// If p is empty the DefaultCachePath is used. Entries are keyed by the absolute
+// path and hash algorithms and are ignored if the size or modification time of the file changes.
+// If rehash is true, existing entries are ignored and rebuilt. The Hasher should be closed when not needed.
+func NewCachedHasher(threads int, p string, rehash bool) (*Hasher, error) {
+	h, err := NewHasher(threads)
+	if err != nil {
+		return nil, err
+	}
+	if p == "" {
+		p, err = DefaultCachePath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	db, err := leveldb.OpenFile(filepath.Join(p, hashCacheName), nil)
+	if err != nil {
+		return nil, err
+	}
+	h.db = db
+	h.rehash = rehash
+	return h, nil
 }
@@ -1,12 +1,13 @@
 package ds
 
 import (
-	"crypto/sha1"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+
+	rh "github.com/sselph/scraper/rom/hash"
 )
 
 type File struct {
@@ -60,7 +61,7 @@ func TestHasher(t *testing.T) {
 	}
 	defer d.Close()
 	d.Files = append(d.Files, File{Path: "doesnotexist"})
-	h, err := NewHasher(sha1.New, 4)
+	h, err := NewHasher(4)
 	if err != nil {
 		t.Error(err)
 	}
@@ -90,3 +91,42 @@ func TestHasher(t *testing.T) {
 	f(d.Files[0])
 	f(d.Files[1])
 }
+
+func TestCachedHasher(t *testing.T) {
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	f := d.Files[0]
+	h, err := NewCachedHasher(1, d.Dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := h.Hash(f.Path); err != nil || s != f.SHA1 {
+		t.Fatalf("h.Hash(%q) => %q, %v; want %q, nil", f.Path, s, err, f.SHA1)
+	}
+	h.Close()
+
+	// Reopen and poison the stored entry to confirm it is read back from disk.
+	h, err = NewCachedHasher(1, d.Dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	key, fi := h.dbKey(f.Path)
+	h.dbPut(key, fi, rh.Digests{SHA1: "cached"})
+	if s, _ := h.Hash(f.Path); s != "cached" {
+		t.Errorf("h.Hash(%q) => %q; want %q", f.Path, s, "cached")
+	}
+
+	// Changing the file must invalidate the entry.
+	h.c.Purge()
+	if err := ioutil.WriteFile(f.Path, []byte{0}, 0664); err != nil {
+		t.Fatal(err)
+	}
+	want := "5ba93c9db0cff93f52b521d7420e43f6eda2784f"
+	if s, _ := h.Hash(f.Path); s != want {
+		t.Errorf("h.Hash(%q) => %q; want %q", f.Path, s, want)
+	}
+}
@@ -0,0 +1,36 @@
+package ds
+
+import (
+	"context"
+
+	"github.com/sselph/scraper/rom/header"
+)
+
+// Header is a DataSource that uses the internal header of the ROM. It works
+// offline but only provides the title, region and serial so it is best used
+// as the last source.
+type Header struct{}
+
+// GetName implements DS.
+func (h *Header) GetName(p string) string {
+	return ""
+}
+
+// GetGame implements DS.
+func (h *Header) GetGame(ctx context.Context, p string) (*Game, error) {
+	info, err := header.Read(p)
+	if err != nil || info.Title == "" {
+		return nil, ErrNotFound
+	}
+	ret := NewGame()
+	ret.ID = info.Serial
+	ret.Source = "header"
+	// Games without a serial are only identified by the title in the header.
+	ret.Match = MatchHeader
+	if info.Serial != "" {
+		ret.Match = MatchSerial
+	}
+	ret.GameTitle = info.Title
+	ret.Region = info.Region
+	return ret, nil
+}
@@ -0,0 +1,56 @@
+package ds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// snesROM returns a SNES ROM with the title and, if serial isn't empty, the
+// extended header with the serial.
+func snesROM(title, serial string) []byte {
+	b := make([]byte, 0x8000)
+	h := b[0x7FC0:]
+	copy(h, title+"                     ")
+	h[0x15] = 0x20
+	h[0x19] = 0x01
+	h[0x1C], h[0x1D] = 0xFF, 0xFF
+	if serial != "" {
+		h[0x1A] = 0x33
+		copy(b[0x7FB0:], "01"+serial)
+	}
+	return b
+}
+
+func TestHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name      string
+		rom       []byte
+		id, match string
+	}{
+		{"serial.sfc", snesROM("SUPER GAME", "AGME"), "AGME", MatchSerial},
+		{"title.sfc", snesROM("SUPER GAME", ""), "", MatchHeader},
+	}
+	h := &Header{}
+	for _, tt := range tests {
+		p := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(p, tt.rom, 0664); err != nil {
+			t.Fatal(err)
+		}
+		g, err := h.GetGame(context.Background(), p)
+		if err != nil {
+			t.Errorf("GetGame(%s) => err = %v; want nil", tt.name, err)
+			continue
+		}
+		if g.GameTitle != "SUPER GAME" || g.ID != tt.id || g.Match != tt.match {
+			t.Errorf("GetGame(%s) => %q, %q, %q; want %q, %q, %q", tt.name, g.GameTitle, g.ID, g.Match, "SUPER GAME", tt.id, tt.match)
+		}
+	}
+}
@@ -29,9 +29,7 @@ type MAME struct {
 
 // getID gets the ID for the game..
 func (m *MAME) getID(p string) (string, error) {
-	b := filepath.Base(p)
-	id := b[:len(b)-len(filepath.Ext(b))]
-	return id, nil
+	return fileID(p), nil
 }
 
 // GetName implements DS.
@@ -65,6 +63,7 @@ func (m *MAME) GetGame(ctx context.Context, p string) (*Game, error) {
 	game.Genre = g.Genre
 	game.CloneOf = g.CloneOf
 	game.Source = g.Source
+	game.Match = MatchFilename
 	game.Players = g.Players
 	game.Rating = g.Rating / 10.0
 	if g.Title != "" {
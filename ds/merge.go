@@ -0,0 +1,285 @@
+package ds
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fields of a Game that can be merged from several sources. Images and videos of a
+// type use FieldImage or FieldVideo followed by "." and the type, ie "image.3b",
+// before falling back to FieldImage or FieldVideo.
+const (
+	FieldName        = "name"
+	FieldDesc        = "desc"
+	FieldRating      = "rating"
+	FieldReleaseDate = "releasedate"
+	FieldDeveloper   = "developer"
+	FieldPublisher   = "publisher"
+	FieldGenre       = "genre"
+	FieldPlayers     = "players"
+	FieldCloneOf     = "cloneof"
+	FieldRegion      = "region"
+	FieldLang        = "lang"
+	FieldImage       = "image"
+	FieldVideo       = "video"
+)
+
+// field is a field of a Game other than the images and videos.
+type field struct {
+	name string
+	has  func(g *Game) bool
+	set  func(dst, src *Game)
+}
+
+var fields = []field{
+	{FieldName, func(g *Game) bool { return g.GameTitle != "" }, func(d, s *Game) { d.GameTitle = s.GameTitle }},
+	{FieldDesc, func(g *Game) bool { return g.Overview != "" }, func(d, s *Game) { d.Overview = s.Overview }},
+	{FieldRating, func(g *Game) bool { return g.Rating != 0 }, func(d, s *Game) { d.Rating = s.Rating }},
+	{FieldReleaseDate, func(g *Game) bool { return g.ReleaseDate != "" }, func(d, s *Game) { d.ReleaseDate = s.ReleaseDate }},
+	{FieldDeveloper, func(g *Game) bool { return g.Developer != "" }, func(d, s *Game) { d.Developer = s.Developer }},
+	{FieldPublisher, func(g *Game) bool { return g.Publisher != "" }, func(d, s *Game) { d.Publisher = s.Publisher }},
+	{FieldGenre, func(g *Game) bool { return g.Genre != "" }, func(d, s *Game) { d.Genre = s.Genre }},
+	{FieldPlayers, func(g *Game) bool { return g.Players != 0 }, func(d, s *Game) { d.Players = s.Players }},
+	{FieldCloneOf, func(g *Game) bool { return g.CloneOf != "" }, func(d, s *Game) { d.CloneOf = s.CloneOf }},
+	{FieldRegion, func(g *Game) bool { return g.Region != "" }, func(d, s *Game) { d.Region = s.Region }},
+	{FieldLang, func(g *Game) bool { return g.Lang != "" }, func(d, s *Game) { d.Lang = s.Lang }},
+}
+
+// sourceFields are the fields each source can find. Sources not listed may find any
+// field. Every source may find images and videos.
+var sourceFields = map[string][]string{
+	"gdb":        {FieldName, FieldDesc, FieldReleaseDate, FieldDeveloper, FieldPublisher, FieldGenre, FieldPlayers},
+	"gdb_search": {FieldName, FieldDesc, FieldReleaseDate, FieldDeveloper, FieldPublisher, FieldGenre, FieldPlayers},
+	"ss":         {FieldName, FieldDesc, FieldRating, FieldReleaseDate, FieldDeveloper, FieldPublisher, FieldGenre, FieldPlayers},
+	"ovgdb":      {FieldName, FieldDesc, FieldReleaseDate, FieldDeveloper, FieldPublisher, FieldGenre},
+	"mamedb":     {FieldName, FieldDesc, FieldRating, FieldReleaseDate, FieldDeveloper, FieldGenre, FieldPlayers, FieldCloneOf},
+	"adb":        {FieldName, FieldDesc, FieldRating, FieldReleaseDate, FieldDeveloper, FieldGenre, FieldPlayers, FieldCloneOf},
+	"dat":        {FieldName, FieldReleaseDate, FieldDeveloper, FieldCloneOf, FieldRegion, FieldLang},
+	"header":     {FieldName, FieldRegion},
+}
+
+// supplies returns true if the source can find the field.
+func supplies(source, f string) bool {
+	l, ok := sourceFields[source]
+	if !ok || strings.HasPrefix(f, FieldImage) || strings.HasPrefix(f, FieldVideo) {
+		return true
+	}
+	for _, x := range l {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceName returns the name used to select the source, ie "ss" or "gdb".
+func SourceName(s DS) string {
+	switch s.(type) {
+	case *GDB, *ScummVM, *Daphne, *NeoGeo:
+		return "gdb"
+	case *GDBSearch:
+		return "gdb_search"
+	case *SS, *SSMAME:
+		return "ss"
+	case *OVGDB:
+		return "ovgdb"
+	case *MAME:
+		return "mamedb"
+	case *ADB:
+		return "adb"
+	case *DAT:
+		return "dat"
+	case *Header:
+		return "header"
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// Found is a game found by a source.
+type Found struct {
+	// Source is the name of the source.
+	Source string
+	Game   *Game
+}
+
+// Priority maps a field to the names of the sources in order of preference. Sources
+// not listed come after the listed ones in the order they were queried.
+type Priority map[string][]string
+
+// ParsePriority parses a semicolon-separated list of fields and sources like
+// "desc=ss,gdb;image=ss,gdb;rating=adb".
+func ParsePriority(s string) (Priority, error) {
+	p := make(Priority)
+	for _, x := range strings.Split(s, ";") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		kv := strings.SplitN(x, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected field=sources, got %q", x)
+		}
+		f := strings.TrimSpace(kv[0])
+		if !validField(f) {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		for _, src := range strings.Split(kv[1], ",") {
+			if src = strings.TrimSpace(src); src != "" {
+				p[f] = append(p[f], src)
+			}
+		}
+	}
+	return p, nil
+}
+
+func validField(f string) bool {
+	if f == FieldImage || f == FieldVideo || strings.HasPrefix(f, FieldImage+".") || strings.HasPrefix(f, FieldVideo+".") {
+		return true
+	}
+	for _, x := range fields {
+		if x.name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the sources listed for the field.
+func (p Priority) list(f string) []string {
+	l, ok := p[f]
+	if !ok && strings.Contains(f, ".") {
+		l = p[f[:strings.Index(f, ".")]]
+	}
+	return l
+}
+
+// rank returns the position of the source in the list of the field.
+func (p Priority) rank(f, source string) int {
+	l := p.list(f)
+	for i, s := range l {
+		if s == source {
+			return i
+		}
+	}
+	return len(l)
+}
+
+// best returns the game with the highest priority for the field that has it.
+func (p Priority) best(f string, found []Found, has func(g *Game) bool) (Found, bool) {
+	var b Found
+	r := -1
+	for _, x := range found {
+		if !has(x.Game) {
+			continue
+		}
+		if xr := p.rank(f, x.Source); r == -1 || xr < r {
+			b, r = x, xr
+		}
+	}
+	return b, r != -1
+}
+
+func hasImage(t ImgType) func(g *Game) bool {
+	return func(g *Game) bool {
+		_, ok := g.Images[t]
+		return ok
+	}
+}
+
+func hasVideo(t VidType) func(g *Game) bool {
+	return func(g *Game) bool {
+		_, ok := g.Videos[t]
+		return ok
+	}
+}
+
+// Merge returns a new Game with each field taken from the found game with the
+// highest priority that has it, along with its provenance. The ID and source are the
+// ones of the game the name is taken from.
+func (p Priority) Merge(found []Found) *Game {
+	g := NewGame()
+	if len(found) == 0 {
+		return g
+	}
+	first := found[0]
+	if b, ok := p.best(FieldName, found, fields[0].has); ok {
+		first = b
+	}
+	g.ID = first.Game.ID
+	g.Source = first.Game.Source
+	g.Fuzzy = first.Game.Fuzzy
+	g.Match = first.Game.Match
+	g.Provenance = make(map[string]Provenance)
+	from := func(f string, src *Game) {
+		if pv, ok := src.Provenance[f]; ok {
+			g.Provenance[f] = pv
+		}
+	}
+	for _, f := range fields {
+		if b, ok := p.best(f.name, found, f.has); ok {
+			f.set(g, b.Game)
+			from(f.name, b.Game)
+		}
+	}
+	for _, x := range found {
+		for t := range x.Game.Images {
+			if _, ok := g.Images[t]; ok {
+				continue
+			}
+			b, _ := p.best(FieldImage+"."+string(t), found, hasImage(t))
+			g.Images[t] = b.Game.Images[t]
+			if th, ok := b.Game.Thumbs[t]; ok {
+				g.Thumbs[t] = th
+			}
+			from(FieldImage+"."+string(t), b.Game)
+		}
+		for t := range x.Game.Videos {
+			if _, ok := g.Videos[t]; ok {
+				continue
+			}
+			b, _ := p.best(FieldVideo+"."+string(t), found, hasVideo(t))
+			g.Videos[t] = b.Game.Videos[t]
+			from(FieldVideo+"."+string(t), b.Game)
+		}
+	}
+	return g
+}
+
+// Complete returns true if the sources left can't change the merged game, ie no
+// source left that can find a field has a higher priority than the source the field
+// is taken from. A source can find a field if it is listed for the field or the
+// source is known to have it. The image and video types must be found while sources
+// are left.
+func (p Priority) Complete(found []Found, left []string, imgs []ImgType, vids []VidType) bool {
+	complete := func(f string, has func(g *Game) bool) bool {
+		r := -1
+		if b, ok := p.best(f, found, has); ok {
+			r = p.rank(f, b.Source)
+		}
+		for _, s := range left {
+			if !supplies(s, f) && p.rank(f, s) == len(p.list(f)) {
+				continue
+			}
+			if r == -1 || p.rank(f, s) < r {
+				return false
+			}
+		}
+		return true
+	}
+	for _, f := range fields {
+		if !complete(f.name, f.has) {
+			return false
+		}
+	}
+	for _, t := range imgs {
+		if !complete(FieldImage+"."+string(t), hasImage(t)) {
+			return false
+		}
+	}
+	for _, t := range vids {
+		if !complete(FieldVideo+"."+string(t), hasVideo(t)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package ds
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePriority(t *testing.T) {
+	got, err := ParsePriority("desc=ss, gdb; image.3b=ss;rating=adb;")
+	if err != nil {
+		t.Fatalf("ParsePriority() => err = %v; want nil", err)
+	}
+	want := Priority{"desc": {"ss", "gdb"}, "image.3b": {"ss"}, "rating": {"adb"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePriority() => %v; want %v", got, want)
+	}
+	for _, bad := range []string{"desc", "size=ss"} {
+		if _, err := ParsePriority(bad); err == nil {
+			t.Errorf("ParsePriority(%q) => err = nil; want error", bad)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	gdbGame := NewGame()
+	gdbGame.ID = "1"
+	gdbGame.GameTitle = "GDB Name"
+	gdbGame.Overview = "GDB overview"
+	gdbGame.Images[ImgBoxart] = HTTPImage{URL: "gdb-b"}
+	gdbGame.Images[ImgScreen] = HTTPImage{URL: "gdb-s"}
+	ssGame := NewGame()
+	ssGame.ID = "2"
+	ssGame.GameTitle = "SS Name"
+	ssGame.Overview = "SS overview"
+	ssGame.Players = 2
+	ssGame.Images[ImgBoxart] = HTTPImage{URL: "ss-b"}
+	ssGame.Images[ImgBoxart3D] = HTTPImage{URL: "ss-3b"}
+	found := []Found{{"gdb", gdbGame}, {"ss", ssGame}}
+	p := Priority{"desc": {"ss", "gdb"}, "image.b": {"ss"}}
+
+	g := p.Merge(found)
+	if g.ID != "1" || g.GameTitle != "GDB Name" {
+		t.Errorf("Merge() => %s, %q; want 1, %q", g.ID, g.GameTitle, "GDB Name")
+	}
+	if g.Overview != "SS overview" || g.Players != 2 {
+		t.Errorf("Merge() => %q, %d; want %q, 2", g.Overview, g.Players, "SS overview")
+	}
+	wantImgs := map[ImgType]Image{
+		ImgBoxart:   HTTPImage{URL: "ss-b"},
+		ImgScreen:   HTTPImage{URL: "gdb-s"},
+		ImgBoxart3D: HTTPImage{URL: "ss-3b"},
+	}
+	if !reflect.DeepEqual(g.Images, wantImgs) {
+		t.Errorf("Merge() => images %v; want %v", g.Images, wantImgs)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	g := &Game{GameTitle: "a", Overview: "b", Rating: 1, ReleaseDate: "c", Developer: "d", Publisher: "e",
+		Genre: "f", Players: 1, CloneOf: "g", Region: "us", Lang: "en", Images: map[ImgType]Image{ImgBoxart: HTTPImage{}}}
+	found := []Found{{"gdb", g}}
+	if !(Priority{}).Complete(found, []string{"ss"}, []ImgType{ImgBoxart}, nil) {
+		t.Errorf("Complete() without priority => false; want true")
+	}
+	if (Priority{"desc": {"ss"}}).Complete(found, []string{"ss"}, []ImgType{ImgBoxart}, nil) {
+		t.Errorf("Complete() with ss preferred and left => true; want false")
+	}
+	if (Priority{}).Complete(found, []string{"ss"}, []ImgType{ImgScreen}, nil) {
+		t.Errorf("Complete() with a missing image => true; want false")
+	}
+	g = &Game{GameTitle: "a", Overview: "b", ReleaseDate: "c", Developer: "d", Publisher: "e", Genre: "f", Players: 1}
+	found = []Found{{"gdb", g}}
+	if !(Priority{}).Complete(found, []string{"ovgdb"}, nil, nil) {
+		t.Errorf("Complete() with fields ovgdb can't find missing => false; want true")
+	}
+	if (Priority{}).Complete(found, []string{"ovgdb", "adb"}, nil, nil) {
+		t.Errorf("Complete() with the rating missing and adb left => true; want false")
+	}
+	if (Priority{"region": {"ovgdb"}}).Complete(found, []string{"ovgdb"}, nil, nil) {
+		t.Errorf("Complete() with the region missing and listed for ovgdb => true; want false")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewGame()
+	a.ID = "1"
+	a.GameTitle = "A"
+	a.Match = MatchSHA1
+	a.Images[ImgBoxart] = HTTPImage{URL: "a-b"}
+	a.Record("gdb", now)
+	b := NewGame()
+	b.ID = "2"
+	b.Overview = "B"
+	b.Fuzzy = true
+	b.Record("ss", now)
+	g := Priority{}.Merge([]Found{{"gdb", a}, {"ss", b}})
+	want := map[string]Provenance{
+		"name":    {Source: "gdb", ID: "1", Match: MatchSHA1, Time: now},
+		"image.b": {Source: "gdb", ID: "1", Match: MatchSHA1, Time: now},
+		"desc":    {Source: "ss", ID: "2", Match: MatchFuzzy, Time: now},
+	}
+	if !reflect.DeepEqual(g.Provenance, want) {
+		t.Errorf("Merge() => provenance %v; want %v", g.Provenance, want)
+	}
+	if !want["name"].Exact() || want["desc"].Exact() {
+		t.Errorf("Exact() of %s, %s => %t, %t; want true, false", MatchSHA1, MatchFuzzy, want["name"].Exact(), want["desc"].Exact())
+	}
+}
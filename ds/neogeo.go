@@ -55,6 +55,7 @@ func (n *NeoGeo) GetGame(ctx context.Context, p string) (*Game, error) {
 	}
 
 	result := ParseGDBGame(*resp)
+	result.Match = MatchFilename
 	result.Images[ImgTitle] = result.Images[ImgBoxart]
 	result.Thumbs[ImgTitle] = result.Thumbs[ImgBoxart]
 	result.Images[ImgMarquee] = result.Images[ImgLogo]
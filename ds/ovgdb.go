@@ -2,6 +2,7 @@ package ds
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,7 +12,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/sselph/scraper/naming"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -51,6 +54,11 @@ func ovgdbUnmarshalGame(b []byte) (*Game, error) {
 type OVGDB struct {
 	db     *leveldb.DB
 	Hasher *Hasher
+
+	// names maps the naming keys of the file names in the DB to IDs. It is built the
+	// first time a file name isn't in the DB as written.
+	names     map[string]string
+	namesOnce sync.Once
 }
 
 // GetName implements DS.
@@ -66,31 +74,67 @@ func (o *OVGDB) GetName(p string) string {
 	return string(n)
 }
 
-// getID gets the ID from the path.
-func (o *OVGDB) getID(p string) (string, error) {
+// getID gets the ID from the path and how it was matched.
+func (o *OVGDB) getID(p string) (string, string, error) {
 	h, err := o.Hasher.Hash(p)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	id, err := o.db.Get([]byte(h), nil)
 	if err == nil {
-		return string(id), nil
+		return string(id), MatchSHA1, nil
 	}
 	if err != nil && err != leveldb.ErrNotFound {
-		return "", err
+		return "", "", err
 	}
 	b := filepath.Base(p)
 	n := b[:len(b)-len(filepath.Ext(b))]
 	id, err = o.db.Get([]byte(strings.ToLower(n)), nil)
-	if err != nil {
-		return "", ErrNotFound
+	if err == nil {
+		return string(id), MatchFilename, nil
+	}
+	o.namesOnce.Do(o.indexNames)
+	if s, ok := o.names[naming.Key(n)]; ok {
+		return s, MatchFilename, nil
+	}
+	return "", "", ErrNotFound
+}
+
+// isSHA1 returns true if s is a hex encoded SHA1.
+func isSHA1(s []byte) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// indexNames maps the naming keys of the file names in the DB to IDs. The DB holds
+// hashes and file names mapped to IDs, hashes with a "-name" suffix mapped to names
+// and IDs mapped to games.
+func (o *OVGDB) indexNames() {
+	o.names = make(map[string]string)
+	it := o.db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		k, v := it.Key(), it.Value()
+		if isSHA1(k) || bytes.HasSuffix(k, []byte("-name")) || bytes.HasPrefix(v, []byte("[")) {
+			continue
+		}
+		nk := naming.Key(string(k))
+		if _, ok := o.names[nk]; !ok && nk != "" {
+			o.names[nk] = string(v)
+		}
 	}
-	return string(id), nil
 }
 
 // GetGame implements DS.
 func (o *OVGDB) GetGame(ctx context.Context, p string) (*Game, error) {
-	id, err := o.getID(p)
+	id, match, err := o.getID(p)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +145,12 @@ func (o *OVGDB) GetGame(ctx context.Context, p string) (*Game, error) {
 		}
 		return nil, err
 	}
-	return ovgdbUnmarshalGame(g)
+	game, err := ovgdbUnmarshalGame(g)
+	if err != nil {
+		return nil, err
+	}
+	game.Match = match
+	return game, nil
 }
 
 // Close closes the DB.
@@ -0,0 +1,53 @@
+package ds
+
+import "time"
+
+// Match methods recording how a source identified a game.
+const (
+	MatchSHA1     = "sha1"
+	MatchHash     = "hash"
+	MatchSerial   = "serial"
+	MatchHeader   = "header"
+	MatchFilename = "filename"
+	MatchFuzzy    = "fuzzy"
+)
+
+// Provenance records where the value of a field came from.
+type Provenance struct {
+	// Source is the name of the source, ie "ss" or "gdb".
+	Source string `json:"source"`
+	// ID is the ID of the game in the source.
+	ID string `json:"id,omitempty"`
+	// Match is how the source identified the game, ie MatchSHA1 or MatchFuzzy.
+	Match string `json:"match,omitempty"`
+	// Time is when the value was scraped.
+	Time time.Time `json:"time"`
+	// Sum is the checksum of the value written. It is used to find values that were
+	// changed after scraping.
+	Sum string `json:"sum,omitempty"`
+}
+
+// Exact returns true if the game was identified by its contents instead of its name.
+func (p Provenance) Exact() bool {
+	return p.Match != "" && p.Match != MatchFilename && p.Match != MatchFuzzy
+}
+
+// Record sets the provenance of every field of the game that has a value to the source.
+func (g *Game) Record(source string, t time.Time) {
+	p := Provenance{Source: source, ID: g.ID, Match: g.Match, Time: t}
+	if g.Fuzzy {
+		p.Match = MatchFuzzy
+	}
+	g.Provenance = make(map[string]Provenance)
+	for _, f := range fields {
+		if f.has(g) {
+			g.Provenance[f.name] = p
+		}
+	}
+	for t := range g.Images {
+		g.Provenance[FieldImage+"."+string(t)] = p
+	}
+	for t := range g.Videos {
+		g.Provenance[FieldVideo+"."+string(t)] = p
+	}
+}
@@ -20,9 +20,7 @@ func (s *ScummVM) getID(p string) (string, error) {
 	if filepath.Ext(p) != ".svm" {
 		return "", ErrNotFound
 	}
-	b := filepath.Base(p)
-	svm := b[:len(b)-len(filepath.Ext(b))]
-	gameID := strings.Split(svm, "-")[0]
+	gameID := strings.Split(fileID(p), "-")[0]
 	id, ok := s.HM.ID(gameID)
 	if !ok {
 		return "", ErrNotFound
@@ -32,9 +30,7 @@ func (s *ScummVM) getID(p string) (string, error) {
 
 // GetName implements DS.
 func (s *ScummVM) GetName(p string) string {
-	b := filepath.Base(p)
-	svm := b[:len(b)-len(filepath.Ext(b))]
-	gameID := strings.Split(svm, "-")[0]
+	gameID := strings.Split(fileID(p), "-")[0]
 	n, ok := s.HM.Name(gameID)
 	if !ok {
 		return ""
@@ -57,5 +53,6 @@ func (s *ScummVM) GetGame(ctx context.Context, p string) (*Game, error) {
 	}
 
 	result := ParseGDBGame(*resp)
+	result.Match = MatchFilename
 	return result, nil
 }
@@ -0,0 +1,24 @@
+package ds
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/sselph/scraper/naming"
+)
+
+// searchName returns the name of the ROM without the extension and tags.
+func searchName(p string) string {
+	return naming.ParseFile(p).Title
+}
+
+// fileID returns the lowercase name of the file without the extension and tags. It
+// is used to match the files named after IDs like MAME sets, ie "SF2 (World).zip"
+// and "sf2.zip" are both "sf2".
+func fileID(p string) string {
+	if t := naming.ParseFile(p).Title; t != "" {
+		return strings.ToLower(t)
+	}
+	b := filepath.Base(p)
+	return strings.ToLower(b[:len(b)-len(filepath.Ext(b))])
+}
@@ -0,0 +1,37 @@
+package ds
+
+import "testing"
+
+func TestSearchName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/roms/Super Mario Bros. (USA) [T+Fre].nes", "Super Mario Bros."},
+		{"Sonic the Hedgehog (Hack) (Europe).md", "Sonic the Hedgehog"},
+		{"Dr. Mario (World) (Rev 1).nes", "Dr. Mario"},
+		{"Tetris.gb", "Tetris"},
+	}
+	for _, test := range tests {
+		if got := searchName(test.in); got != test.want {
+			t.Errorf("searchName(%q) => %q; want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestFileID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/roms/sf2.zip", "sf2"},
+		{"SF2 (World).zip", "sf2"},
+		{"Monkey-VGA [!].svm", "monkey-vga"},
+		{"(1).zip", "(1)"},
+	}
+	for _, test := range tests {
+		if got := fileID(test.in); got != test.want {
+			t.Errorf("fileID(%q) => %q; want %q", test.in, got, test.want)
+		}
+	}
+}
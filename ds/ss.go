@@ -7,14 +7,19 @@ import (
 	"image/jpeg"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/sselph/scraper/cache"
+	"github.com/sselph/scraper/naming"
+	"github.com/sselph/scraper/rom/header"
 	"github.com/sselph/scraper/ss"
 )
 
@@ -40,6 +45,103 @@ type SS struct {
 	Width  int
 	Height int
 	Limit  chan struct{}
+	Quota  *SSQuota
+	// Search enables searching by the name of the file when the hash isn't found.
+	Search bool
+	// SearchThreshold is the minimum score from 0 to 1 of a game found by searching.
+	SearchThreshold float64
+	// SystemID is the ScreenScraper system searched. If 0, searching is disabled.
+	SystemID int
+}
+
+// SSQuota tracks the ScreenScraper requests left today. It is shared by the
+// sources of the same user so they stop before the daily quota is used.
+type SSQuota struct {
+	mu       sync.Mutex
+	today    int
+	max      int
+	koToday  int
+	maxKO    int
+	inflight int
+	logged   int
+	stopped  bool
+}
+
+// Load gets the requests made today from the user information.
+func (q *SSQuota) Load(ctx context.Context, dev ss.DevInfo, user ss.UserInfo) error {
+	i, err := ss.User(ctx, dev, user)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.set(i.RequestsToday, i.MaxRequestsPerDay, i.RequestsKOToday, i.MaxRequestsKOPerDay)
+	return nil
+}
+
+func (q *SSQuota) set(today, max, koToday, maxKO int) {
+	q.today, q.max, q.koToday, q.maxKO = today, max, koToday, maxKO
+	if q.max <= 0 {
+		return
+	}
+	step := q.max / 10
+	if step < 1 {
+		step = 1
+	}
+	if q.today/step != q.logged {
+		q.logged = q.today / step
+		log.Printf("INFO: ScreenScraper requests today: %d of %d, not found: %d of %d.", q.today, q.max, q.koToday, q.maxKO)
+	}
+}
+
+// stop stops all requests for the rest of the run.
+func (q *SSQuota) stop() {
+	if q.stopped {
+		return
+	}
+	q.stopped = true
+	log.Printf("ERR: ScreenScraper daily quota reached, requests today: %d of %d, not found: %d of %d. Skipping it for the remaining ROMs.", q.today, q.max, q.koToday, q.maxKO)
+}
+
+// take reserves a request. It returns false if the quota is used.
+func (q *SSQuota) take() bool {
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.stopped && (q.max > 0 && q.today+q.inflight >= q.max || q.maxKO > 0 && q.koToday+q.inflight >= q.maxKO) {
+		q.stop()
+	}
+	if q.stopped {
+		return false
+	}
+	q.inflight++
+	return true
+}
+
+// done updates the quota with the result of a request reserved with take.
+// u is the user of the response if the request succeeded. Cached responses
+// weren't requested and their user is out of date so they are ignored.
+func (q *SSQuota) done(u *ss.UserResp, err error, cached bool) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inflight--
+	switch {
+	case err == ss.ErrQuota:
+		q.stop()
+	case cached:
+	case err == ss.ErrNotFound:
+		q.set(q.today+1, q.max, q.koToday+1, q.maxKO)
+	case err != nil:
+	case u != nil && u.MaxRequestsPerDay > 0:
+		q.set(int(u.RequestsToday), int(u.MaxRequestsPerDay), int(u.RequestsKOToday), int(u.MaxRequestsKOPerDay))
+	default:
+		q.set(q.today+1, q.max, q.koToday, q.maxKO)
+	}
 }
 
 type HTTPVideoSS struct {
@@ -60,7 +162,7 @@ func (v HTTPVideoSS) Save(ctx context.Context, p string) error {
 		return err
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -96,7 +198,7 @@ func (i HTTPImageSS) fetch(ctx context.Context, width, height uint) (rc io.ReadC
 		return nil, err
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		if uerr, ok := err.(*url.Error); ok {
 			uerr.URL = ss.SanitizeURL(uerr.URL)
@@ -210,13 +312,28 @@ func (s *SS) GetGame(ctx context.Context, path string) (*Game, error) {
 		return nil, ErrNotFound
 	}
 	req := ss.GameInfoReq{SHA1: id}
-	resp, err := ss.GameInfo(ctx, s.Dev, s.User, req)
+	// Disc images are often re-encoded so also send the serial for SS to fall back to.
+	if header.IsDisc(path) {
+		if info, err := header.Read(path); err == nil && info.System != "" {
+			req.Serial = info.Serial
+		}
+	}
+	if !s.Quota.take() {
+		return nil, ErrQuota
+	}
+	hctx, hit := cache.WithHit(ctx)
+	resp, err := ss.GameInfo(hctx, s.Dev, s.User, req)
 	if err != nil {
+		s.Quota.done(nil, err, *hit)
 		if err == ss.ErrNotFound {
 			return nil, ErrNotFound
 		}
-		return nil, err
+		if err == ss.ErrQuota {
+			return nil, ErrQuota
+		}
+		return nil, quotaErr(err)
 	}
+	s.Quota.done(&resp.Response.User, nil, *hit)
 	game := resp.Response.Game
 	var regions []string
 	rom, ok := game.ROM(req)
@@ -227,7 +344,90 @@ func (s *SS) GetGame(ctx context.Context, path string) (*Game, error) {
 		regions = append(regions, r)
 	}
 	regions = append(regions, s.Region...)
+	ret, err := s.game(game, regions)
+	if err != nil {
+		return nil, err
+	}
+	ret.Match = MatchSHA1
+	if !strings.EqualFold(rom.SHA1, req.SHA1) {
+		ret.Match = MatchSerial
+	}
+	return ret, nil
+}
+
+// SearchGame implements Searcher. It finds the game by the name of the file for ROMs
+// with an unknown hash like hacks and translations. The best match is only used if
+// its score is at least SearchThreshold and the game is marked as fuzzy.
+func (s *SS) SearchGame(ctx context.Context, path string) (*Game, error) {
+	if !s.Search || s.SystemID == 0 {
+		return nil, ErrNotFound
+	}
+	if s.Limit != nil {
+		s.Limit <- struct{}{}
+		defer func() {
+			<-s.Limit
+		}()
+	}
+	name := searchName(path)
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	if !s.Quota.take() {
+		return nil, ErrQuota
+	}
+	hctx, hit := cache.WithHit(ctx)
+	resp, err := ss.Search(hctx, s.Dev, s.User, name, s.SystemID)
+	if err != nil {
+		s.Quota.done(nil, err, *hit)
+		if err == ss.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		if err == ss.ErrQuota {
+			return nil, ErrQuota
+		}
+		return nil, quotaErr(err)
+	}
+	s.Quota.done(&resp.Response.User, nil, *hit)
+	var best ss.Game
+	bestScore := -1.0
+	for _, g := range resp.Response.Games {
+		if score := searchScore(name, g, s.Region); score > bestScore {
+			best, bestScore = g, score
+		}
+	}
+	if bestScore < s.SearchThreshold {
+		return nil, ErrNotFound
+	}
+	ret, err := s.game(best, s.Region)
+	if err != nil {
+		return nil, err
+	}
+	ret.Fuzzy = true
+	return ret, nil
+}
+
+// searchScore scores how well the game matches the name. The similarity of the
+// best name is weighted most and the region of that name breaks ties.
+func searchScore(name string, g ss.Game, regions []string) float64 {
+	var best float64
+	var region string
+	for _, n := range g.Names {
+		if sim := naming.Similarity(name, n.Text); sim > best {
+			best, region = sim, n.Region
+		}
+	}
+	var rs float64
+	for i, r := range regions {
+		if r == region {
+			rs = 1 - float64(i)/float64(len(regions))
+			break
+		}
+	}
+	return 0.9*best + 0.1*rs
+}
 
+// game creates the Game from the ScreenScraper game using the regions to choose media.
+func (s *SS) game(game ss.Game, regions []string) (*Game, error) {
 	ret := NewGame()
 	var screen, box, cart, wheel Image
 	screen = addImageToGame(ret, game, ss.Screenshot, ImgScreen, regions, s)
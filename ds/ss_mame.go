@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/sselph/scraper/cache"
 	"github.com/sselph/scraper/ss"
 )
 
@@ -18,6 +19,7 @@ type SSMAME struct {
 	Width  int
 	Height int
 	Limit  chan struct{}
+	Quota  *SSQuota
 }
 
 // GetName implements DS
@@ -34,13 +36,22 @@ func (s *SSMAME) GetGame(ctx context.Context, path string) (*Game, error) {
 		}()
 	}
 	req := ss.GameInfoReq{Name: filepath.Base(path)}
-	resp, err := ss.GameInfo(ctx, s.Dev, s.User, req)
+	if !s.Quota.take() {
+		return nil, ErrQuota
+	}
+	hctx, hit := cache.WithHit(ctx)
+	resp, err := ss.GameInfo(hctx, s.Dev, s.User, req)
 	if err != nil {
+		s.Quota.done(nil, err, *hit)
 		if err == ss.ErrNotFound {
 			return nil, ErrNotFound
 		}
-		return nil, err
+		if err == ss.ErrQuota {
+			return nil, ErrQuota
+		}
+		return nil, quotaErr(err)
 	}
+	s.Quota.done(&resp.Response.User, nil, *hit)
 	game := resp.Response.Game
 	var regions []string
 	rom, ok := game.ROM(req)
@@ -64,6 +75,7 @@ func (s *SSMAME) GetGame(ctx context.Context, path string) (*Game, error) {
 	}
 	ret.ID = game.ID
 	ret.Source = "screenscraper.fr"
+	ret.Match = MatchFilename
 	ret.GameTitle, _ = game.Name(s.Region)
 	ret.Overview, _ = game.Desc(s.Lang)
 	game.Rating.Text = strings.TrimSuffix(game.Rating.Text, "/20")
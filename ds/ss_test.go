@@ -0,0 +1,82 @@
+package ds
+
+import (
+	"testing"
+
+	"github.com/sselph/scraper/ss"
+)
+
+func TestSSQuota(t *testing.T) {
+	// Requests in flight count against the quota.
+	q := &SSQuota{}
+	q.set(8, 10, 0, 5)
+	for i, want := range []bool{true, true, false} {
+		if got := q.take(); got != want {
+			t.Errorf("%d: take() => %t; want %t", i, got, want)
+		}
+	}
+
+	// Not found requests count against their own quota.
+	q = &SSQuota{}
+	q.set(0, 100, 1, 2)
+	q.take()
+	q.done(nil, ss.ErrNotFound, false)
+	if q.take() {
+		t.Errorf("take() after %v => true; want false", ss.ErrNotFound)
+	}
+
+	// The quota is updated from the user in the response.
+	q = &SSQuota{}
+	q.set(0, 10, 0, 0)
+	q.take()
+	q.done(&ss.UserResp{RequestsToday: 10, MaxRequestsPerDay: 10}, nil, false)
+	if q.take() {
+		t.Errorf("take() after using the quota => true; want false")
+	}
+
+	// Cached responses don't count and their user is out of date.
+	q = &SSQuota{}
+	q.set(5, 10, 1, 2)
+	q.take()
+	q.done(nil, ss.ErrNotFound, true)
+	q.take()
+	q.done(&ss.UserResp{RequestsToday: 1, MaxRequestsPerDay: 10}, nil, true)
+	if q.today != 5 || q.koToday != 1 || q.inflight != 0 {
+		t.Errorf("done() of cached responses => %d today, %d not found, %d in flight; want 5, 1, 0", q.today, q.koToday, q.inflight)
+	}
+
+	q = &SSQuota{}
+	if !q.take() {
+		t.Fatalf("take() without quota => false; want true")
+	}
+	q.done(nil, ss.ErrQuota, false)
+	if q.take() {
+		t.Errorf("take() after %v => true; want false", ss.ErrQuota)
+	}
+
+	var nq *SSQuota
+	if !nq.take() {
+		t.Errorf("nil take() => false; want true")
+	}
+}
+
+func TestSearchScore(t *testing.T) {
+	g := ss.Game{Names: []ss.RegionAndText{
+		{Region: "jp", Text: "Rockman 2: Dr. Wily no Nazo"},
+		{Region: "us", Text: "Mega Man 2"},
+	}}
+	regions := []string{"us", "eu"}
+	exact := searchScore("Mega Man 2", g, regions)
+	if exact != 1 {
+		t.Errorf("searchScore(exact) => %v; want 1", exact)
+	}
+	if s := searchScore("MegaMan II", g, regions); s >= exact || s < 0.5 {
+		t.Errorf("searchScore(similar) => %v; want between 0.5 and %v", s, exact)
+	}
+	if s := searchScore("Contra", g, regions); s >= 0.5 {
+		t.Errorf("searchScore(different) => %v; want < 0.5", s)
+	}
+	if s := searchScore("Mega Man 2", g, []string{"jp"}); s != 0.9 {
+		t.Errorf("searchScore(other region) => %v; want 0.9", s)
+	}
+}
@@ -13,7 +13,14 @@ import (
 	gamesdb "github.com/J-Swift/thegamesdb-swagger-client-go"
 )
 
-var apiClient = gamesdb.NewAPIClient(gamesdb.NewConfiguration())
+var apiConfig = gamesdb.NewConfiguration()
+
+var apiClient = gamesdb.NewAPIClient(apiConfig)
+
+// SetClient sets the http.Client used for API calls. It can be replaced to cache responses.
+func SetClient(c *http.Client) {
+	apiConfig.HTTPClient = c
+}
 
 // Publishers
 
@@ -214,6 +221,9 @@ type ParsedGame struct {
 	ImageBaseUrls ParsedImageSizeBaseUrls
 }
 
+// gameFields are the fields requested with the games.
+const gameFields = "players,publishers,genres,overview,platform"
+
 // GetGame gets the game information from the DB.
 func GetGame(ctx context.Context, apikey string, gameID string) (*ParsedGame, error) {
 	var games gamesdb.GamesByGameId
@@ -222,15 +232,18 @@ func GetGame(ctx context.Context, apikey string, gameID string) (*ParsedGame, er
 
 	// TODO(jpr): remove unneeded fields
 	//fields := "players,publishers,genres,overview,last_updated,rating,platform,coop,youtube,os,processor,ram,hdd,video,sound,alternates"
-	fields := "players,publishers,genres,overview,platform"
 
 	if gameID == "" {
 		return nil, fmt.Errorf("must provide an ID or Name")
 	}
 
-	games, resp, err = apiClient.GamesApi.GamesByGameID(ctx, apikey, gameID, &gamesdb.GamesByGameIDOpts{Fields: optional.NewString(fields)})
+	games, resp, err = apiClient.GamesApi.GamesByGameID(ctx, apikey, gameID, &gamesdb.GamesByGameIDOpts{Fields: optional.NewString(gameFields)})
 
 	if err != nil {
+		if resp == nil {
+			// The request wasn't made, e.g. the daily quota of the host is used.
+			return nil, err
+		}
 		return nil, fmt.Errorf("getting game url:%s, error:%s", resp.Request.URL, err)
 	}
 
@@ -238,7 +251,13 @@ func GetGame(ctx context.Context, apikey string, gameID string) (*ParsedGame, er
 		return nil, fmt.Errorf("game not found")
 	}
 
-	apiGame := games.Data.Games[0]
+	res := parseGame(ctx, apikey, games.Data.Games[0])
+	AddImages(ctx, apikey, res)
+	return res, nil
+}
+
+// parseGame converts the game of the API and looks up its genres, developers and publishers.
+func parseGame(ctx context.Context, apikey string, apiGame gamesdb.Game) *ParsedGame {
 	res := &ParsedGame{
 		ID:          int(apiGame.Id),
 		Name:        apiGame.GameTitle,
@@ -273,23 +292,26 @@ func GetGame(ctx context.Context, apikey string, gameID string) (*ParsedGame, er
 		}
 	}
 	res.Publishers = publishers
+	return res
+}
 
+// AddImages gets the images of the game. The game is left without images if they can't be found.
+func AddImages(ctx context.Context, apikey string, res *ParsedGame) {
 	images, _, err := apiClient.GamesApi.GamesImages(ctx, apikey, strconv.Itoa(res.ID), nil)
-	if err == nil {
-		res.ImageBaseUrls = toParsedImageSizeBaseUrls(images.Data.BaseUrl)
-
-		parsedImages := make(map[string][]ParsedGameImage)
-		for key, val := range images.Data.Images {
-			result := parsedImages[key]
-			for _, image := range val {
-				result = append(result, toParsedGameImage(image))
-			}
-			parsedImages[key] = result
-		}
-		res.Images = parsedImages
+	if err != nil {
+		return
 	}
+	res.ImageBaseUrls = toParsedImageSizeBaseUrls(images.Data.BaseUrl)
 
-	return res, nil
+	parsedImages := make(map[string][]ParsedGameImage)
+	for key, val := range images.Data.Images {
+		result := parsedImages[key]
+		for _, image := range val {
+			result = append(result, toParsedGameImage(image))
+		}
+		parsedImages[key] = result
+	}
+	res.Images = parsedImages
 }
 
 // IsUp returns if thegamedb.net is up.
@@ -300,3 +322,28 @@ func IsUp(ctx context.Context, apikey string) bool {
 	}
 	return true
 }
+
+// SearchByName finds the games with a name like name. If platform isn't 0, only
+// games of that platform are returned. The games don't include images so AddImages
+// must be used to get the images of the game that is used.
+func SearchByName(ctx context.Context, apikey string, name string, platform int) ([]ParsedGame, error) {
+	if name == "" {
+		return nil, fmt.Errorf("must provide a Name")
+	}
+	opts := &gamesdb.GamesByGameNameOpts{Fields: optional.NewString(gameFields)}
+	if platform != 0 {
+		opts.FilterPlatform = optional.NewString(strconv.Itoa(platform))
+	}
+	games, resp, err := apiClient.GamesApi.GamesByGameName(ctx, apikey, name, opts)
+	if err != nil {
+		if resp == nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("searching game %q, error:%s", name, err)
+	}
+	var res []ParsedGame
+	for _, g := range games.Data.Games {
+		res = append(res, *parseGame(ctx, apikey, g))
+	}
+	return res, nil
+}
@@ -0,0 +1,104 @@
+// Package cuesheet splits the lines of cue sheets and gdi files. It is shared by
+// the rom package, which lists the track files, and the header package, which reads
+// the data track.
+package cuesheet
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrNoDataTrack is returned when a cue sheet or gdi has no data track.
+var ErrNoDataTrack = errors.New("no data track")
+
+// ScanWords is a split function for a Scanner that returns each
+// space-separated word of text, or quoted value in a cue sheet or gdi, with
+// surrounding spaces deleted. A quote only starts a value at the start of a word.
+// It will never return an empty string. The definition of space is set by
+// unicode.IsSpace.
+func ScanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// Skip leading spaces.
+	start := 0
+	for width := 0; start < len(data); start += width {
+		var r rune
+		r, width = utf8.DecodeRune(data[start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+	}
+	quote := false
+	// Scan until space, marking end of word.
+	for width, i := 0, start; i < len(data); i += width {
+		var r rune
+		r, width = utf8.DecodeRune(data[i:])
+		switch {
+		case i == start && r == '"':
+			quote = true
+		case !quote && unicode.IsSpace(r):
+			return i + width, data[start:i], nil
+		case quote && r == '"':
+			return i + width, data[start+width : i], nil
+		}
+	}
+	// If we're at EOF, we have a final, non-empty, non-terminated word. Return it.
+	if atEOF && len(data) > start {
+		return len(data), data[start:], nil
+	}
+	// Request more data.
+	return start, nil, nil
+}
+
+// Fields splits a line of a cue sheet or gdi into its words.
+func Fields(s string) []string {
+	var out []string
+	w := bufio.NewScanner(strings.NewReader(s))
+	w.Split(ScanWords)
+	for w.Scan() {
+		out = append(out, w.Text())
+	}
+	return out
+}
+
+// DataTrack returns the path of the first data track of the .cue or .gdi at path p.
+// For a .gdi it is track 3, the first track of the high density area. Other files
+// are returned as is.
+func DataTrack(p string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(p))
+	if ext != ".cue" && ext != ".gdi" {
+		return p, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	dir := filepath.Dir(p)
+	var file string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := Fields(s.Text())
+		switch {
+		case ext == ".gdi" && len(l) >= 5:
+			// Track 3 is the first track of the high density area that holds IP.BIN.
+			if n, _ := strconv.Atoi(l[0]); n == 3 {
+				return filepath.Join(dir, l[4]), nil
+			}
+		case ext == ".cue" && len(l) >= 2 && strings.ToUpper(l[0]) == "FILE":
+			file = l[1]
+		case ext == ".cue" && len(l) >= 3 && strings.ToUpper(l[0]) == "TRACK":
+			if strings.HasPrefix(strings.ToUpper(l[2]), "MODE") && file != "" {
+				return filepath.Join(dir, file), nil
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrNoDataTrack
+}
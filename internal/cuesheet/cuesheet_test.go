@@ -0,0 +1,27 @@
+package cuesheet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{`FILE "a b.bin" BINARY`, []string{"FILE", "a b.bin", "BINARY"}},
+		{`  FILE  "a b.bin"  BINARY`, []string{"FILE", "a b.bin", "BINARY"}},
+		// The quoted value isn't at the start of the line.
+		{`  FILE "Game (Track 1).bin" BINARY`, []string{"FILE", "Game (Track 1).bin", "BINARY"}},
+		{`"a b.bin"`, []string{"a b.bin"}},
+		// A quote inside a word doesn't start a value.
+		{`TITLE a"b c`, []string{"TITLE", `a"b`, "c"}},
+		{`3 45000 4 2352 "track 03.bin" 0`, []string{"3", "45000", "4", "2352", "track 03.bin", "0"}},
+		{`TRACK 01 MODE1/2352`, []string{"TRACK", "01", "MODE1/2352"}},
+	} {
+		if got := Fields(tc.line); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Fields(%q) => %q; want %q", tc.line, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sselph/scraper/ds"
+	"github.com/sselph/scraper/rom"
+)
+
+// Status of a ROM in the journal.
+const (
+	statusDone     = "done"
+	statusFailed   = "failed"
+	statusNotFound = "not_found"
+)
+
+// journalEntry is the result of processing a single ROM.
+type journalEntry struct {
+	Path   string       `json:"path"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Game   *rom.GameXML `json:"game,omitempty"`
+}
+
+// journal records the ROMs processed for an output file so an interrupted scrape can be resumed.
+// The entries are the ones of the journal being resumed. They are only read once
+// crawling starts so the walk can skip ROMs while the results are added.
+type journal struct {
+	p       string
+	f       *os.File
+	enc     *json.Encoder
+	entries map[string]journalEntry
+	order   []string
+}
+
+// journalPath returns the path of the journal for the output file.
+func journalPath(output string) (string, error) {
+	dir, err := ds.DefaultCachePath()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "journal")
+	if err := mkDir(dir); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("%x.jsonl", sha1.Sum([]byte(abs)))), nil
+}
+
+// openJournal opens the journal at path p. If resume is false any previous journal is discarded.
+func openJournal(p string, resume bool) (*journal, error) {
+	j := &journal{p: p, entries: make(map[string]journalEntry)}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if err := j.read(); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	var err error
+	j.f, err = os.OpenFile(p, flags, 0664)
+	if err != nil {
+		return nil, err
+	}
+	j.enc = json.NewEncoder(j.f)
+	return j, nil
+}
+
+// discardJournal returns a journal that isn't written, used by -dry_run.
+func discardJournal() *journal {
+	return &journal{entries: make(map[string]journalEntry), enc: json.NewEncoder(ioutil.Discard)}
+}
+
+// read loads the entries of an existing journal. A partially written last line is ignored.
+func (j *journal) read() error {
+	f, err := os.Open(j.p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+		j.set(e)
+	}
+	return s.Err()
+}
+
+func (j *journal) set(e journalEntry) {
+	if _, ok := j.entries[e.Path]; !ok {
+		j.order = append(j.order, e.Path)
+	}
+	j.entries[e.Path] = e
+}
+
+// skip returns true if the ROM was already scraped or not found. Failed ROMs are tried again.
+func (j *journal) skip(p string) bool {
+	e, ok := j.entries[p]
+	return ok && e.Status != statusFailed
+}
+
+// games returns the games that were scraped in the order they were added.
+func (j *journal) games() []*rom.GameXML {
+	var out []*rom.GameXML
+	for _, p := range j.order {
+		if e := j.entries[p]; e.Status == statusDone && e.Game != nil {
+			out = append(out, e.Game)
+		}
+	}
+	return out
+}
+
+// add records the result of a ROM. It is written to the journal but doesn't change
+// the entries being resumed.
+func (j *journal) add(e journalEntry) error {
+	return j.enc.Encode(e)
+}
+
+// Close closes the journal.
+func (j *journal) Close() error {
+	return j.f.Close()
+}
+
+// Remove closes and deletes the journal once the scrape is complete.
+func (j *journal) Remove() error {
+	j.f.Close()
+	return os.Remove(j.p)
+}
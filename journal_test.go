@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sselph/scraper/rom"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "journal.jsonl")
+	j, err := openJournal(p, false)
+	if err != nil {
+		t.Fatalf("openJournal(%q, false) => err = %v; want nil", p, err)
+	}
+	entries := []journalEntry{
+		{Path: "a.nes", Status: statusDone, Game: &rom.GameXML{Path: "./a.nes", GameTitle: "A"}},
+		{Path: "b.nes", Status: statusNotFound, Error: "not found"},
+		{Path: "c.nes", Status: statusFailed, Error: "timeout"},
+	}
+	for _, e := range entries {
+		if err := j.add(e); err != nil {
+			t.Fatalf("add(%q) => err = %v; want nil", e.Path, err)
+		}
+	}
+	j.Close()
+	// A partially written line from an interrupted run is ignored.
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"path":"d.nes","sta`)
+	f.Close()
+
+	j, err = openJournal(p, true)
+	if err != nil {
+		t.Fatalf("openJournal(%q, true) => err = %v; want nil", p, err)
+	}
+	skip := map[string]bool{"a.nes": true, "b.nes": true, "c.nes": false, "d.nes": false}
+	for f, want := range skip {
+		if got := j.skip(f); got != want {
+			t.Errorf("skip(%q) => %t; want %t", f, got, want)
+		}
+	}
+	games := j.games()
+	if len(games) != 1 || games[0].GameTitle != "A" {
+		t.Errorf("games() => %v; want [A]", games)
+	}
+	// Results added while resuming don't change what is skipped.
+	done := make(chan bool)
+	go func() {
+		j.add(journalEntry{Path: "c.nes", Status: statusDone})
+		close(done)
+	}()
+	j.skip("c.nes")
+	<-done
+	if j.skip("c.nes") {
+		t.Errorf("skip(c.nes) after add => true; want false")
+	}
+	if err := j.Remove(); err != nil {
+		t.Errorf("Remove() => err = %v; want nil", err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("Stat(%q) => err = %v; want not exist", p, err)
+	}
+
+	j, err = openJournal(p, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if j.skip("a.nes") {
+		t.Errorf("skip(a.nes) without resume => true; want false")
+	}
+}
@@ -0,0 +1,364 @@
+// Package limit limits the rate of requests to each host and retries throttled requests.
+package limit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minBackoff is the first wait after a throttled request without Retry-After.
+	minBackoff = time.Second
+	// maxBackoff is the longest wait between retries.
+	maxBackoff = 5 * time.Minute
+)
+
+// ErrQuota is returned when the daily quota of a host is used.
+var ErrQuota = errors.New("daily quota reached")
+
+// QuotaError is the error of a request that wasn't made because the daily quota of
+// the host is used.
+type QuotaError struct {
+	Host string
+}
+
+func (e *QuotaError) Error() string {
+	return e.Host + ": " + ErrQuota.Error()
+}
+
+// IsQuota returns true if err is a QuotaError, including one returned by an http.Client.
+func IsQuota(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	_, ok := err.(*QuotaError)
+	return ok
+}
+
+// Host is the limit of requests to a host.
+type Host struct {
+	// Rate is the number of requests per second. If 0, there is no limit.
+	Rate float64
+	// Daily is the number of requests per day. If 0, there is no limit.
+	Daily int
+}
+
+// ParseHosts parses the comma-separated host=value lists of rates and daily quotas.
+func ParseHosts(rates, quotas string) (map[string]Host, error) {
+	hosts := make(map[string]Host)
+	err := parseList(rates, func(host, v string) error {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r < 0 {
+			return fmt.Errorf("invalid rate %q for %s", v, host)
+		}
+		h := hosts[host]
+		h.Rate = r
+		hosts[host] = h
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = parseList(quotas, func(host, v string) error {
+		q, err := strconv.Atoi(v)
+		if err != nil || q < 0 {
+			return fmt.Errorf("invalid quota %q for %s", v, host)
+		}
+		h := hosts[host]
+		h.Daily = q
+		hosts[host] = h
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+func parseList(s string, f func(host, v string) error) error {
+	for _, x := range strings.Split(s, ",") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		kv := strings.SplitN(x, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected host=value, got %q", x)
+		}
+		if err := f(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bucket is the token bucket and quota of a host.
+type bucket struct {
+	mu     sync.Mutex
+	host   Host
+	tokens float64
+	last   time.Time
+	until  time.Time
+	day    string
+	count  int
+	logged bool
+}
+
+// dayCount is the number of requests made to a host on a day.
+type dayCount struct {
+	Day   string
+	Count int
+}
+
+func newBucket(h Host, now time.Time) *bucket {
+	return &bucket{host: h, tokens: math.Max(1, h.Rate), last: now}
+}
+
+// reserve takes a token and returns how long to wait before making the request.
+func (b *bucket) reserve(now time.Time) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.host.Daily > 0 {
+		if d := now.Format("2006-01-02"); d != b.day {
+			b.day = d
+			b.count = 0
+			b.logged = false
+		}
+		if b.count >= b.host.Daily {
+			return 0, ErrQuota
+		}
+		b.count++
+	}
+	var wait time.Duration
+	if b.host.Rate > 0 {
+		b.tokens = math.Min(math.Max(1, b.host.Rate), b.tokens+now.Sub(b.last).Seconds()*b.host.Rate)
+		b.last = now
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.host.Rate * float64(time.Second))
+		}
+	}
+	if p := b.until.Sub(now); p > wait {
+		wait = p
+	}
+	return wait, nil
+}
+
+// quotaLogged returns whether the quota was already logged and marks it logged.
+func (b *bucket) quotaLogged() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l := b.logged
+	b.logged = true
+	return l
+}
+
+// dayCount returns the requests made today.
+func (b *bucket) dayCount() dayCount {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return dayCount{Day: b.day, Count: b.count}
+}
+
+// pause stops requests to the host until t.
+func (b *bucket) pause(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.After(b.until) {
+		b.until = t
+	}
+}
+
+// Transport is an http.RoundTripper that limits the requests to each host. Requests
+// throttled with a 429 or 503 status are retried after the Retry-After time or an
+// exponential backoff and every request to the host waits until then.
+type Transport struct {
+	// Hosts are the limits of each host. Hosts not listed aren't limited.
+	Hosts map[string]Host
+	// Retries is the number of times a throttled request is retried.
+	Retries int
+	// Transport makes the requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+	// Counts is the file the requests made today to the hosts with a daily quota are
+	// saved in so the quota carries over to the next runs. If empty, they aren't saved.
+	Counts string
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	counts  map[string]dayCount
+}
+
+// Client returns an http.Client using the Transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+func (t *Transport) bucket(host string) *bucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.buckets == nil {
+		t.buckets = make(map[string]*bucket)
+	}
+	b, ok := t.buckets[host]
+	if !ok {
+		b = newBucket(t.Hosts[host], time.Now())
+		if b.host.Daily > 0 {
+			c := t.loadCounts()[host]
+			b.day, b.count = c.Day, c.Count
+		}
+		t.buckets[host] = b
+	}
+	return b
+}
+
+// loadCounts returns the saved request counts of the hosts, reading the Counts file
+// the first time. t.mu must be held.
+func (t *Transport) loadCounts() map[string]dayCount {
+	if t.counts != nil {
+		return t.counts
+	}
+	t.counts = make(map[string]dayCount)
+	if t.Counts == "" {
+		return t.counts
+	}
+	b, err := ioutil.ReadFile(t.Counts)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ERR: Can't read the request counts: %s", err)
+		}
+		return t.counts
+	}
+	if err := json.Unmarshal(b, &t.counts); err != nil {
+		log.Printf("ERR: Can't read the request counts: %s", err)
+	}
+	return t.counts
+}
+
+// saveCounts writes the request counts of the hosts with a daily quota to the Counts file.
+func (t *Transport) saveCounts() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := t.loadCounts()
+	for host, b := range t.buckets {
+		if b.host.Daily > 0 {
+			counts[host] = b.dayCount()
+		}
+	}
+	b, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+	tmp := t.Counts + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.Counts)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.bucket(req.URL.Host)
+	for try := 0; ; try++ {
+		wait, err := b.reserve(time.Now())
+		if err != nil {
+			if !b.quotaLogged() {
+				log.Printf("ERR: %s daily quota of %d requests reached. Skipping it for the remaining ROMs.", req.URL.Host, b.host.Daily)
+			}
+			return nil, &QuotaError{Host: req.URL.Host}
+		}
+		if b.host.Daily > 0 && t.Counts != "" {
+			if err := t.saveCounts(); err != nil {
+				log.Printf("ERR: Can't save the request counts: %s", err)
+			}
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		resp, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if !throttled(resp) || try >= t.Retries || req.Body != nil {
+			return resp, nil
+		}
+		d, ok := retryAfter(resp, time.Now())
+		if !ok {
+			d = backoff(try)
+		}
+		resp.Body.Close()
+		log.Printf("INFO: %s throttled the request, retrying in %s.", req.URL.Host, d)
+		b.pause(time.Now().Add(d))
+	}
+}
+
+func throttled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "")
+}
+
+// retryAfter parses the Retry-After header which is either seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if s, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(s) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d, true
+}
+
+// backoff returns the exponential backoff with jitter for the try.
+func backoff(try int) time.Duration {
+	d := maxBackoff
+	if try < 16 {
+		if b := minBackoff << uint(try); b < maxBackoff {
+			d = b
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
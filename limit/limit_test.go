@@ -0,0 +1,151 @@
+package limit
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHosts(t *testing.T) {
+	got, err := ParseHosts("a.com=2, b.com=0.5", "a.com=100,c.com=10")
+	if err != nil {
+		t.Fatalf("ParseHosts() => err = %v; want nil", err)
+	}
+	want := map[string]Host{
+		"a.com": {Rate: 2, Daily: 100},
+		"b.com": {Rate: 0.5},
+		"c.com": {Daily: 10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseHosts() => %v; want %v", got, want)
+	}
+	for _, bad := range []string{"a.com", "a.com=x", "a.com=-1"} {
+		if _, err := ParseHosts(bad, ""); err == nil {
+			t.Errorf("ParseHosts(%q) => err = nil; want error", bad)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	now := time.Date(2017, 1, 1, 23, 59, 0, 0, time.UTC)
+	b := newBucket(Host{Rate: 2, Daily: 3}, now)
+	tests := []struct {
+		now  time.Time
+		wait time.Duration
+		err  error
+	}{
+		{now, 0, nil},
+		{now, 0, nil},
+		{now, 500 * time.Millisecond, nil},
+		{now, 0, ErrQuota},
+		{now.Add(time.Minute), 0, nil},
+	}
+	for i, test := range tests {
+		wait, err := b.reserve(test.now)
+		if wait != test.wait || err != test.err {
+			t.Errorf("%d: reserve() => %v, %v; want %v, %v", i, wait, err, test.wait, test.err)
+		}
+	}
+	b.pause(now.Add(time.Hour))
+	if wait, _ := b.reserve(now.Add(time.Minute)); wait != 59*time.Minute {
+		t.Errorf("reserve() after pause => %v; want %v", wait, 59*time.Minute)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{"Sun, 01 Jan 2017 00:01:00 GMT", time.Minute, true},
+		{"86400", maxBackoff, true},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if test.header != "" {
+			resp.Header.Set("Retry-After", test.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != test.want || ok != test.ok {
+			t.Errorf("retryAfter(%q) => %v, %t; want %v, %t", test.header, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for try, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := backoff(try); got < max/2 || got > max {
+			t.Errorf("backoff(%d) => %v; want between %v and %v", try, got, max/2, max)
+		}
+	}
+	if got := backoff(100); got > maxBackoff {
+		t.Errorf("backoff(100) => %v; want <= %v", got, maxBackoff)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	tr := &Transport{Retries: 1}
+	resp, err := tr.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() => err = %v; want nil", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(b) != "ok" || calls != 2 {
+		t.Errorf("Get() => %d, %q, %d calls; want 200, %q, 2 calls", resp.StatusCode, b, calls, "ok")
+	}
+}
+
+func TestTransportQuota(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := map[string]Host{u.Host: {Daily: 1}}
+	counts := filepath.Join(dir, "quotas.json")
+	tr := &Transport{Hosts: hosts, Counts: counts}
+	resp, err := tr.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() => err = %v; want nil", err)
+	}
+	resp.Body.Close()
+	if _, err := tr.Client().Get(srv.URL); !IsQuota(err) {
+		t.Errorf("Get() over the quota => err = %v; want a QuotaError", err)
+	}
+	// The count is read by the next run.
+	tr = &Transport{Hosts: hosts, Counts: counts}
+	if _, err := tr.Client().Get(srv.URL); !IsQuota(err) {
+		t.Errorf("Get() over the saved quota => err = %v; want a QuotaError", err)
+	}
+}
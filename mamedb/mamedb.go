@@ -42,6 +42,9 @@ var (
 // ErrNotFound is returned when a game is not found.
 var ErrNotFound = errors.New("rom not found")
 
+// Client is the http.Client used to get games. It can be replaced to cache responses.
+var Client = http.DefaultClient
+
 // Game represents a game response from mamedb.
 type Game struct {
 	ID        string
@@ -69,7 +72,7 @@ func GetGame(ctx context.Context, name string) (*Game, error) {
 		return nil, err
 	}
 	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
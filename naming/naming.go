@@ -0,0 +1,385 @@
+// Package naming parses ROM file names following the No-Intro, TOSEC and GoodTools
+// conventions and compares the titles of games.
+package naming
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Tag is a kind of tag of a file name that can be added to a title.
+type Tag string
+
+const (
+	// TagRegion is the region like "(USA, Europe)" or "(U)".
+	TagRegion Tag = "region"
+	// TagLanguage is the list of languages like "(En,Fr,De)".
+	TagLanguage Tag = "language"
+	// TagRevision is the revision like "(Rev 1)".
+	TagRevision Tag = "revision"
+	// TagVersion is the version like "(v1.1)".
+	TagVersion Tag = "version"
+	// TagDisc is the disc like "(Disc 1)".
+	TagDisc Tag = "disc"
+)
+
+// ParseTags parses a comma-separated list of tags.
+func ParseTags(s string) ([]Tag, error) {
+	var tags []Tag
+	for _, x := range strings.Split(s, ",") {
+		t := Tag(strings.ToLower(strings.TrimSpace(x)))
+		switch t {
+		case "":
+			continue
+		case TagRegion, TagLanguage, TagRevision, TagVersion, TagDisc:
+			tags = append(tags, t)
+		default:
+			return nil, fmt.Errorf("unknown name tag %q", x)
+		}
+	}
+	return tags, nil
+}
+
+// Name is a parsed file name.
+type Name struct {
+	// Title is the name of the game without tags. A trailing article is moved to the
+	// front, ie "Legend of Zelda, The" becomes "The Legend of Zelda".
+	Title string
+	// Regions are the lowercase region codes like "us", "eu" and "jp".
+	Regions []string
+	// Languages are the lowercase language codes like "en" and "fr".
+	Languages []string
+	// Revision is the revision like "1" or "A".
+	Revision string
+	// Version is the version like "1.1".
+	Version string
+	// Disc is the disc or side like "1" or "A".
+	Disc string
+	// Year is the TOSEC year like "1990" or "199x".
+	Year string
+	// Publisher is the TOSEC publisher.
+	Publisher string
+	// Flags are the other tags as written, ie "!", "h", "T+Eng", "Beta" or "Unl".
+	Flags []string
+
+	// raw is the text of each kind of tag as written.
+	raw map[Tag]string
+}
+
+var (
+	tagRE     = regexp.MustCompile(`\(([^)]*)\)|\[([^\]]*)\]`)
+	discRE    = regexp.MustCompile(`(?i)^(?:disc|disk|cd|side)\s*([0-9a-z]+)(?:\s+of\s+\d+)?$`)
+	revRE     = regexp.MustCompile(`(?i)^rev\s*([0-9a-z.]+)$`)
+	versionRE = regexp.MustCompile(`(?i)^v(?:ersion)?\s*(\d[0-9a-z.]*)$`)
+	// titleVersionRE is the TOSEC version that follows the title.
+	titleVersionRE = regexp.MustCompile(`\s+(v(\d[0-9a-z.]*))$`)
+	yearRE         = regexp.MustCompile(`^((?:19|20)[0-9x]{2})(?:-[0-9x]{2}){0,2}$`)
+	listRE         = regexp.MustCompile(`\s*[,+-]\s*`)
+)
+
+// regions maps the No-Intro region names and the TOSEC country codes to region codes.
+var regions = map[string]string{
+	"Asia":        "asi",
+	"Australia":   "au",
+	"Brazil":      "br",
+	"Canada":      "ca",
+	"China":       "cn",
+	"Europe":      "eu",
+	"France":      "fr",
+	"Germany":     "de",
+	"Hong Kong":   "hk",
+	"Italy":       "it",
+	"Japan":       "jp",
+	"Korea":       "kr",
+	"Netherlands": "nl",
+	"Russia":      "ru",
+	"Scandinavia": "eu",
+	"Spain":       "sp",
+	"Sweden":      "se",
+	"Taiwan":      "tw",
+	"UK":          "uk",
+	"USA":         "us",
+	"World":       "wor",
+	"AS":          "asi",
+	"AU":          "au",
+	"BR":          "br",
+	"CA":          "ca",
+	"CN":          "cn",
+	"DE":          "de",
+	"ES":          "sp",
+	"EU":          "eu",
+	"FR":          "fr",
+	"GB":          "uk",
+	"HK":          "hk",
+	"IT":          "it",
+	"JP":          "jp",
+	"KR":          "kr",
+	"NL":          "nl",
+	"RU":          "ru",
+	"SE":          "se",
+	"TW":          "tw",
+	"US":          "us",
+}
+
+// goodRegions maps the GoodTools region letters to region codes.
+var goodRegions = map[rune]string{
+	'A': "au",
+	'B': "br",
+	'C': "cn",
+	'E': "eu",
+	'F': "fr",
+	'G': "de",
+	'H': "nl",
+	'I': "it",
+	'J': "jp",
+	'K': "kr",
+	'S': "sp",
+	'U': "us",
+	'W': "wor",
+}
+
+// languages are the language codes used by No-Intro and TOSEC.
+var languages = map[string]bool{
+	"ar": true, "ca": true, "cs": true, "da": true, "de": true, "el": true,
+	"en": true, "es": true, "fi": true, "fr": true, "he": true, "hu": true,
+	"it": true, "ja": true, "ko": true, "nl": true, "no": true, "pl": true,
+	"pt": true, "ru": true, "sv": true, "tr": true, "zh": true,
+}
+
+// articles are the articles No-Intro and TOSEC move to the end of the title.
+var articles = []string{"The", "A", "An", "Das", "Der", "Die", "El", "Il", "La", "Las", "Le", "Les", "Los"}
+
+// ParseFile parses the base name of the path without the extension.
+func ParseFile(p string) Name {
+	b := filepath.Base(p)
+	return Parse(b[:len(b)-len(filepath.Ext(b))])
+}
+
+// Parse parses the name which should not contain an extension.
+func Parse(s string) Name {
+	n := Name{raw: make(map[Tag]string)}
+	title, rest := s, ""
+	if i := strings.IndexAny(s, "(["); i >= 0 {
+		title, rest = s[:i], s[i:]
+	}
+	title = strings.TrimSpace(title)
+	if m := titleVersionRE.FindStringSubmatch(title); m != nil {
+		title = title[:len(title)-len(m[0])]
+		n.Version = m[2]
+		n.raw[TagVersion] = m[1]
+	}
+	n.Title = moveArticle(title)
+	var publisher bool
+	for _, m := range tagRE.FindAllStringSubmatch(rest, -1) {
+		if strings.HasPrefix(m[0], "[") {
+			if t := strings.TrimSpace(m[2]); t != "" {
+				n.Flags = append(n.Flags, t)
+			}
+			publisher = false
+			continue
+		}
+		t := strings.TrimSpace(m[1])
+		if t == "" {
+			continue
+		}
+		// The TOSEC publisher always follows the date.
+		if publisher {
+			publisher = false
+			if t != "-" {
+				n.Publisher = t
+			}
+			continue
+		}
+		if y := yearRE.FindStringSubmatch(t); y != nil && n.Year == "" {
+			n.Year = y[1]
+			publisher = true
+			continue
+		}
+		if n.parse(t) {
+			continue
+		}
+		n.Flags = append(n.Flags, t)
+	}
+	return n
+}
+
+// parse sets the kind of tag matching the text of the tag t.
+func (n *Name) parse(t string) bool {
+	if m := discRE.FindStringSubmatch(t); m != nil && n.Disc == "" {
+		n.Disc = m[1]
+		n.raw[TagDisc] = t
+		return true
+	}
+	if m := revRE.FindStringSubmatch(t); m != nil && n.Revision == "" {
+		n.Revision = m[1]
+		n.raw[TagRevision] = t
+		return true
+	}
+	if m := versionRE.FindStringSubmatch(t); m != nil && n.Version == "" {
+		n.Version = m[1]
+		n.raw[TagVersion] = t
+		return true
+	}
+	if r := parseRegions(t); r != nil && n.Regions == nil {
+		n.Regions = r
+		n.raw[TagRegion] = t
+		return true
+	}
+	if l := parseLanguages(t); l != nil && n.Languages == nil {
+		n.Languages = l
+		n.raw[TagLanguage] = t
+		return true
+	}
+	return false
+}
+
+// parseRegions parses a list of region names or codes like "USA, Europe" and
+// "US-EU", or the GoodTools region letters like "JUE".
+func parseRegions(t string) []string {
+	var r []string
+	for _, x := range listRE.Split(t, -1) {
+		c, ok := regions[x]
+		if !ok {
+			r = nil
+			break
+		}
+		r = append(r, c)
+	}
+	if r != nil || len(t) > 3 {
+		return r
+	}
+	for _, x := range t {
+		c, ok := goodRegions[x]
+		if !ok {
+			return nil
+		}
+		r = append(r, c)
+	}
+	return r
+}
+
+// parseLanguages parses a list of languages like "En,Fr" or "en-de". Uppercase
+// codes are TOSEC countries.
+func parseLanguages(t string) []string {
+	if t == strings.ToUpper(t) {
+		return nil
+	}
+	var l []string
+	for _, x := range listRE.Split(t, -1) {
+		x = strings.ToLower(x)
+		if !languages[x] {
+			return nil
+		}
+		l = append(l, x)
+	}
+	return l
+}
+
+// moveArticle moves the article at the end of the title, or the end of the main
+// title before " - ", to the front.
+func moveArticle(title string) string {
+	main, sub := title, ""
+	if i := strings.Index(title, " - "); i >= 0 {
+		main, sub = title[:i], title[i:]
+	}
+	for _, a := range articles {
+		if strings.HasSuffix(main, ", "+a) {
+			return a + " " + strings.TrimSuffix(main, ", "+a) + sub
+		}
+	}
+	return title
+}
+
+// Has returns true if one of the flags is f or f followed by a number or detail,
+// ie Has("b") is true for "[b1]" and Has("T") is true for "[T+Eng]".
+func (n Name) Has(f string) bool {
+	for _, x := range n.Flags {
+		if x == f {
+			return true
+		}
+		if strings.HasPrefix(x, f) {
+			r := []rune(x[len(f):])[0]
+			if !unicode.IsLower(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tags returns the tags of the kinds as written in the file name, ie " (USA) (Rev 1)".
+func (n Name) Tags(tags ...Tag) string {
+	var s string
+	for _, t := range tags {
+		if raw := n.raw[t]; raw != "" {
+			s += " (" + raw + ")"
+		}
+	}
+	return s
+}
+
+// Format returns the title followed by the tags of the kinds.
+func (n Name) Format(tags ...Tag) string {
+	return n.Title + n.Tags(tags...)
+}
+
+// Key returns the key used to compare the title to other titles.
+func (n Name) Key() string {
+	return key(n.Title)
+}
+
+// Key returns the key used to compare the title of the name to other titles. Names
+// that only differ in case, punctuation, tags or the position of the article have
+// the same key.
+func Key(s string) string {
+	return Parse(s).Key()
+}
+
+func key(title string) string {
+	s := strings.ToLower(title)
+	s = strings.Replace(s, "&", " and ", -1)
+	s = strings.TrimPrefix(s, "the ")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// Similarity returns how similar the titles of the names are from 0 to 1. It is the
+// Dice coefficient of the letter pairs of the keys.
+func Similarity(a, b string) float64 {
+	ka, kb := Key(a), Key(b)
+	pa, pb := pairs(ka), pairs(kb)
+	if len(pa) == 0 || len(pb) == 0 {
+		if ka == kb {
+			return 1
+		}
+		return 0
+	}
+	count := make(map[string]int)
+	for _, p := range pa {
+		count[p]++
+	}
+	var n int
+	for _, p := range pb {
+		if count[p] > 0 {
+			count[p]--
+			n++
+		}
+	}
+	return 2 * float64(n) / float64(len(pa)+len(pb))
+}
+
+func pairs(s string) []string {
+	r := []rune(s)
+	var out []string
+	for i := 0; i+1 < len(r); i++ {
+		out = append(out, string(r[i:i+2]))
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package naming
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Name
+	}{
+		{
+			"Legend of Zelda, The - A Link to the Past (USA, Europe) (Rev 1)",
+			Name{Title: "The Legend of Zelda - A Link to the Past", Regions: []string{"us", "eu"}, Revision: "1"},
+		},
+		{
+			"Super Mario Bros. (World) (En,Ja) (Beta) [T+Fre]",
+			Name{Title: "Super Mario Bros.", Regions: []string{"wor"}, Languages: []string{"en", "ja"}, Flags: []string{"Beta", "T+Fre"}},
+		},
+		{
+			"Sonic the Hedgehog (JUE) (V1.1) [!]",
+			Name{Title: "Sonic the Hedgehog", Regions: []string{"jp", "us", "eu"}, Version: "1.1", Flags: []string{"!"}},
+		},
+		{
+			"Defender of the Crown v1.2 (1987)(Cinemaware)(US)(Disk 1 of 2)[cr][h1]",
+			Name{Title: "Defender of the Crown", Version: "1.2", Year: "1987", Publisher: "Cinemaware", Regions: []string{"us"}, Disc: "1", Flags: []string{"cr", "h1"}},
+		},
+		{
+			"Elite (198x)(-)(de)",
+			Name{Title: "Elite", Year: "198x", Languages: []string{"de"}},
+		},
+		{
+			"Dr. Mario",
+			Name{Title: "Dr. Mario"},
+		},
+	}
+	for _, test := range tests {
+		got := Parse(test.in)
+		got.raw = nil
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) => %+v; want %+v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestHas(t *testing.T) {
+	n := Parse("Game (Beta 2) [b1] [T+Eng] [hI]")
+	for _, f := range []string{"Beta", "b", "T", "h"} {
+		if !n.Has(f) {
+			t.Errorf("Has(%q) => false; want true", f)
+		}
+	}
+	for _, f := range []string{"!", "Be", "a"} {
+		if n.Has(f) {
+			t.Errorf("Has(%q) => true; want false", f)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	n := Parse("Final Fantasy III (Japan) (Rev A) (Disc 2)")
+	tests := []struct {
+		tags []Tag
+		want string
+	}{
+		{nil, "Final Fantasy III"},
+		{[]Tag{TagRegion}, "Final Fantasy III (Japan)"},
+		{[]Tag{TagRegion, TagRevision, TagVersion, TagDisc}, "Final Fantasy III (Japan) (Rev A) (Disc 2)"},
+	}
+	for _, test := range tests {
+		if got := n.Format(test.tags...); got != test.want {
+			t.Errorf("Format(%v) => %q; want %q", test.tags, got, test.want)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got, err := ParseTags("region, Revision,")
+	if err != nil || !reflect.DeepEqual(got, []Tag{TagRegion, TagRevision}) {
+		t.Errorf("ParseTags() => %v, %v; want [region revision], nil", got, err)
+	}
+	if _, err := ParseTags("year"); err == nil {
+		t.Errorf("ParseTags(year) => err = nil; want error")
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"Legend of Zelda, The (USA)", "The Legend of Zelda"},
+		{"Mega Man 2 [!]", "MEGA MAN 2"},
+		{"Ghosts 'n Goblins", "Ghosts n Goblins"},
+		{"Mario & Luigi", "Mario and Luigi"},
+	}
+	for _, test := range tests {
+		if ka, kb := Key(test.a), Key(test.b); ka != kb {
+			t.Errorf("Key(%q) => %q; want Key(%q) = %q", test.a, ka, test.b, kb)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Mega Man 2", "MEGA MAN 2", 1},
+		{"Mega Man 2", "Contra", 0},
+		{"Q", "q", 1},
+		{"Q", "R", 0},
+		{"Night", "Nacht", 0.25},
+		{"Legend of Zelda, The (USA)", "The Legend of Zelda", 1},
+	}
+	for _, test := range tests {
+		if got := Similarity(test.a, test.b); got != test.want {
+			t.Errorf("Similarity(%q, %q) => %v; want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
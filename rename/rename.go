@@ -2,10 +2,10 @@ package main
 
 import (
 	"context"
-	"crypto/sha1"
 	"flag"
 	"fmt"
 	"github.com/sselph/scraper/ds"
+	"github.com/sselph/scraper/naming"
 	rh "github.com/sselph/scraper/rom/hash"
 	"log"
 	"os"
@@ -16,6 +16,16 @@ import (
 var romDir = flag.String("rom_dir", ".", "The directory containing the roms file to process.")
 var dryRun = flag.Bool("dry_run", true, "Print what will renamed.")
 
+// allTags are the kinds of tags compared by sameName.
+var allTags = []naming.Tag{naming.TagRegion, naming.TagLanguage, naming.TagRevision, naming.TagVersion, naming.TagDisc}
+
+// sameName returns true if the file is already named n, ignoring the case,
+// punctuation and position of the article of the title.
+func sameName(p, n string) bool {
+	a, b := naming.ParseFile(p), naming.Parse(n)
+	return a.Key() == b.Key() && a.Tags(allTags...) == b.Tags(allTags...)
+}
+
 // exists checks if a file exists and contains data.
 func exists(s string) bool {
 	fi, err := os.Stat(s)
@@ -41,7 +51,7 @@ func rename(source *ds.GDB, files []string) error {
 			continue
 		}
 		newPath := filepath.Join(dir, n+ext)
-		if newPath == p {
+		if newPath == p || sameName(p, n) {
 			continue
 		}
 		log.Printf("%s -> %s", p, newPath)
@@ -60,7 +70,7 @@ func main() {
 	flag.Parse()
 	ctx := context.Background()
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	hasher, err := ds.NewHasher(sha1.New, 1)
+	hasher, err := ds.NewHasher(1)
 	if err != nil {
 		fmt.Println(err)
 		return
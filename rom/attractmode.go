@@ -0,0 +1,166 @@
+package rom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rh "github.com/sselph/scraper/rom/hash"
+)
+
+// attractModeHeader is the header of an Attract-Mode romlist.
+const attractModeHeader = "#Name;Title;Emulator;CloneOf;Year;Manufacturer;Category;Players;Rotation;Control;Status;DisplayCount;DisplayType;AltRomname;AltTitle;Extra;Buttons;Series;Language;Region;Rating"
+
+// AttractMode is the romlist format of Attract-Mode.
+type AttractMode struct {
+	// Emulator is the name of the Attract-Mode emulator that runs the roms.
+	Emulator string
+	// Dir is the Attract-Mode directory with the romlists directory. If empty, the romlist is written next to the roms.
+	Dir string
+	// Opts are the options used to create the game list. They are needed to find local files.
+	Opts *XMLOpts
+}
+
+// amValue removes the characters that can't be used in a romlist field.
+func amValue(s string) string {
+	return strings.NewReplacer(";", ",", "\r", "", "\n", " ").Replace(s)
+}
+
+// Encode implements Format.
+func (am AttractMode) Encode(w io.Writer, gl *GameListXML) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, attractModeHeader)
+	for _, g := range gl.GameList {
+		b := filepath.Base(filepath.FromSlash(g.Path))
+		year := g.ReleaseDate
+		if len(year) > 4 {
+			year = year[:4]
+		}
+		manufacturer := g.Developer
+		if manufacturer == "" {
+			manufacturer = g.Publisher
+		}
+		fields := []string{
+			b[:len(b)-len(filepath.Ext(b))],
+			g.GameTitle,
+			am.Emulator,
+			g.CloneOf,
+			year,
+			manufacturer,
+			g.Genre,
+			g.Players,
+			"", "", "", "", "", "", "", "", "", "",
+			g.Lang,
+			g.Region,
+			"",
+		}
+		for i, f := range fields {
+			fields[i] = amValue(f)
+		}
+		fmt.Fprintln(bw, strings.Join(fields, ";"))
+	}
+	return bw.Flush()
+}
+
+// romRank returns the rank of the extension of a file the scraper lists, lower is
+// preferred. Playlists and cue sheets are preferred over the track files they list.
+func romRank(ext string) (int, bool) {
+	switch ext = strings.ToLower(ext); ext {
+	case ".m3u":
+		return 0, true
+	case ".cue", ".gdi":
+		return 1, true
+	case ".svm", ".daphne", ".7z":
+		return 2, true
+	}
+	if rh.KnownExt(ext) || rh.HasExtra(ext) {
+		return 2, true
+	}
+	return 0, false
+}
+
+// romNames maps the names without extension of the files under the rom directory
+// to their paths. Hidden files and files the scraper doesn't list are skipped.
+func romNames(dir string) map[string]string {
+	names := make(map[string]string)
+	ranks := make(map[string]int)
+	filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		b := filepath.Base(p)
+		if p != dir && strings.HasPrefix(b, ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(b)
+		rank, ok := romRank(ext)
+		if !ok {
+			return nil
+		}
+		n := b[:len(b)-len(ext)]
+		if r, ok := ranks[n]; !ok || rank < r {
+			names[n] = p
+			ranks[n] = rank
+		}
+		return nil
+	})
+	return names
+}
+
+// Decode implements Format. The romlist doesn't include the extension of the
+// rom so the rom directory is searched for a file with the same name.
+func (am AttractMode) Decode(r io.Reader, gl *GameListXML) error {
+	var names map[string]string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := s.Text()
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		f := strings.Split(l, ";")
+		if len(f) < 8 {
+			return fmt.Errorf("attractmode: invalid line %q", l)
+		}
+		if names == nil {
+			names = romNames(am.Opts.RomDir)
+		}
+		p, ok := names[f[0]]
+		if !ok {
+			continue
+		}
+		g := &GameXML{
+			Path:      fixPath(am.Opts.RomXMLDir, am.Opts.RomDir, p),
+			GameTitle: f[1],
+			CloneOf:   f[3],
+			Developer: f[5],
+			Genre:     f[6],
+			Players:   f[7],
+		}
+		if len(f[4]) == 4 {
+			g.ReleaseDate = f[4] + "0101T000000"
+		}
+		if len(f) >= 20 {
+			g.Lang = f[18]
+			g.Region = f[19]
+		}
+		gl.Append(g)
+	}
+	return s.Err()
+}
+
+// FileName implements Format.
+func (am AttractMode) FileName() string {
+	if am.Dir == "" {
+		return am.Emulator + ".txt"
+	}
+	return filepath.Join(am.Dir, "romlists", am.Emulator+".txt")
+}
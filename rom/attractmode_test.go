@@ -0,0 +1,78 @@
+package rom
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttractMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attractmode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "sf2j.zip"), []byte("rom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	am := AttractMode{Emulator: "mame", Opts: &XMLOpts{RomDir: dir, RomXMLDir: "."}}
+	gl := &GameListXML{}
+	gl.Append(&GameXML{
+		Path:        "./sf2j.zip",
+		GameTitle:   "Street Fighter II; The World Warrior",
+		CloneOf:     "sf2",
+		ReleaseDate: "19910101T000000",
+		Developer:   "Capcom",
+		Genre:       "Fighting",
+		Players:     "2",
+	})
+	var buf bytes.Buffer
+	if err := am.Encode(&buf, gl); err != nil {
+		t.Fatalf("Encode() => err = %v; want nil", err)
+	}
+	want := attractModeHeader + "\nsf2j;Street Fighter II, The World Warrior;mame;sf2;1991;Capcom;Fighting;2;;;;;;;;;;;;;\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Encode() => %q; want %q", got, want)
+	}
+	got := &GameListXML{}
+	if err := am.Decode(&buf, got); err != nil {
+		t.Fatalf("Decode() => err = %v; want nil", err)
+	}
+	gl.GameList[0].GameTitle = "Street Fighter II, The World Warrior"
+	if !reflect.DeepEqual(got, gl) {
+		t.Errorf("Decode() => %+v; want %+v", got.GameList[0], gl.GameList[0])
+	}
+}
+
+func TestAttractModeDecodeNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attractmode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"images/Zelda [!].png", "rpg/Zelda [!].nes", "Mario (*).nes", "Mario (a).nes", "FF7.bin", "FF7.cue", "Metroid.bak", "Metroid.nes"} {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("rom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	am := AttractMode{Emulator: "nes", Opts: &XMLOpts{RomDir: dir, RomXMLDir: "."}}
+	list := "Zelda [!];Zelda;nes;;;;;\nMario (*);Mario;nes;;;;;\nMissing;Missing;nes;;;;;\nFF7;FF7;nes;;;;;\nMetroid;Metroid;nes;;;;;\n"
+	gl := &GameListXML{}
+	if err := am.Decode(bytes.NewBufferString(list), gl); err != nil {
+		t.Fatalf("Decode() => err = %v; want nil", err)
+	}
+	var got []string
+	for _, g := range gl.GameList {
+		got = append(got, g.Path)
+	}
+	if want := []string{"./rpg/Zelda [!].nes", "./Mario (*).nes", "./FF7.cue", "./Metroid.nes"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() => %q; want %q", got, want)
+	}
+}
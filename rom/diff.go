@@ -0,0 +1,182 @@
+package rom
+
+import (
+	"fmt"
+	"io"
+)
+
+// Statuses of a game when comparing game lists.
+const (
+	DiffAdded     = "added"
+	DiffChanged   = "changed"
+	DiffRemoved   = "removed"
+	DiffUnchanged = "unchanged"
+)
+
+// maxDiffValue is the length values are truncated to when writing a diff as text.
+const maxDiffValue = 80
+
+// Change is an element of a game whose value changed.
+type Change struct {
+	Element string `json:"element"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+}
+
+// GameDiff is how a game in the list changed.
+type GameDiff struct {
+	Path    string   `json:"path"`
+	Status  string   `json:"status"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// ListDiff is how a game list changed. Unchanged games are only counted. Folders
+// are only listed when added, changed or removed and aren't counted.
+type ListDiff struct {
+	Games   []GameDiff     `json:"games"`
+	Folders []GameDiff     `json:"folders,omitempty"`
+	Summary map[string]int `json:"summary"`
+}
+
+// DiffGame returns the elements set by scraping, and whether the game is hidden,
+// whose values differ between old and g.
+func DiffGame(old, g *GameXML) []Change {
+	var changes []Change
+	ov, nv := old.scraped(), g.scraped()
+	for _, e := range elements {
+		o, n := value(ov[e]), value(nv[e])
+		if o != n {
+			changes = append(changes, Change{Element: e, Old: o, New: n})
+		}
+	}
+	if old.Hidden != g.Hidden {
+		changes = append(changes, Change{Element: "hidden", Old: old.Hidden, New: g.Hidden})
+	}
+	return changes
+}
+
+// diffFolder returns the elements whose values differ between the folders old and f.
+func diffFolder(old, f *FolderXML) []Change {
+	var changes []Change
+	for _, c := range []Change{{"name", old.Name, f.Name}, {"desc", old.Overview, f.Overview}, {"image", old.Image, f.Image}} {
+		if c.Old != c.New {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// diffFolders compares the folders of the lists with the same path.
+func diffFolders(old, gl *GameListXML) []GameDiff {
+	var diffs []GameDiff
+	before := make(map[string]*FolderXML)
+	for _, f := range old.Folders {
+		before[f.Path] = f
+	}
+	after := make(map[string]bool)
+	for _, f := range gl.Folders {
+		after[f.Path] = true
+		o, ok := before[f.Path]
+		if !ok {
+			o = &FolderXML{}
+		}
+		fd := GameDiff{Path: f.Path, Changes: diffFolder(o, f)}
+		switch {
+		case !ok:
+			fd.Status = DiffAdded
+		case len(fd.Changes) > 0:
+			fd.Status = DiffChanged
+		default:
+			continue
+		}
+		diffs = append(diffs, fd)
+	}
+	for _, f := range old.Folders {
+		if !after[f.Path] {
+			diffs = append(diffs, GameDiff{Path: f.Path, Status: DiffRemoved})
+		}
+	}
+	return diffs
+}
+
+// DiffList compares the games and folders of the lists with the same path.
+func DiffList(old, gl *GameListXML) *ListDiff {
+	d := &ListDiff{Summary: map[string]int{DiffAdded: 0, DiffChanged: 0, DiffRemoved: 0, DiffUnchanged: 0}}
+	before := make(map[string]*GameXML)
+	for _, g := range old.GameList {
+		before[g.Path] = g
+	}
+	after := make(map[string]bool)
+	for _, g := range gl.GameList {
+		after[g.Path] = true
+		o, ok := before[g.Path]
+		if !ok {
+			o = &GameXML{}
+		}
+		gd := GameDiff{Path: g.Path, Changes: DiffGame(o, g)}
+		switch {
+		case !ok:
+			gd.Status = DiffAdded
+		case len(gd.Changes) > 0:
+			gd.Status = DiffChanged
+		default:
+			d.Summary[DiffUnchanged]++
+			continue
+		}
+		d.Summary[gd.Status]++
+		d.Games = append(d.Games, gd)
+	}
+	for _, g := range old.GameList {
+		if after[g.Path] {
+			continue
+		}
+		d.Summary[DiffRemoved]++
+		d.Games = append(d.Games, GameDiff{Path: g.Path, Status: DiffRemoved})
+	}
+	d.Folders = diffFolders(old, gl)
+	return d
+}
+
+// WriteText writes the diff in a form meant for reading.
+func (d *ListDiff) WriteText(w io.Writer) error {
+	if err := writeDiffs(w, "", d.Games); err != nil {
+		return err
+	}
+	if err := writeDiffs(w, "folder ", d.Folders); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d added, %d changed, %d removed, %d unchanged\n", d.Summary[DiffAdded], d.Summary[DiffChanged], d.Summary[DiffRemoved], d.Summary[DiffUnchanged])
+	return err
+}
+
+// writeDiffs writes the diffs of the games or folders with the kind before the path.
+func writeDiffs(w io.Writer, kind string, diffs []GameDiff) error {
+	for _, g := range diffs {
+		if _, err := fmt.Fprintf(w, "%s %s%s\n", g.Status, kind, g.Path); err != nil {
+			return err
+		}
+		for _, c := range g.Changes {
+			var err error
+			switch {
+			case c.Old == "":
+				_, err = fmt.Fprintf(w, "  %s: %q\n", c.Element, truncate(c.New))
+			case c.New == "":
+				_, err = fmt.Fprintf(w, "  %s: %q removed\n", c.Element, truncate(c.Old))
+			default:
+				_, err = fmt.Fprintf(w, "  %s: %q => %q\n", c.Element, truncate(c.Old), truncate(c.New))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func truncate(s string) string {
+	r := []rune(s)
+	if len(r) <= maxDiffValue {
+		return s
+	}
+	return string(r[:maxDiffValue]) + "..."
+}
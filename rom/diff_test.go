@@ -0,0 +1,64 @@
+package rom
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffList(t *testing.T) {
+	old := &GameListXML{GameList: []*GameXML{
+		{Path: "./a.nes", GameTitle: "A", Overview: "Old"},
+		{Path: "./b.nes", GameTitle: "B"},
+		{Path: "./c.nes", GameTitle: "C"},
+	}, Folders: []*FolderXML{
+		{Path: "./rpg", Name: "rpg"},
+		{Path: "./old", Name: "old"},
+	}}
+	gl := &GameListXML{GameList: []*GameXML{
+		{Path: "./a.nes", GameTitle: "A", Overview: "New", Image: "./images/a.jpg"},
+		{Path: "./b.nes", GameTitle: "B", Hidden: "true"},
+		{Path: "./d.nes", GameTitle: "D", Rating: 0.5},
+	}, Folders: []*FolderXML{
+		{Path: "./rpg", Name: "rpg", Image: "./images/ff7.jpg"},
+	}}
+	d := DiffList(old, gl)
+	want := []GameDiff{
+		{Path: "./a.nes", Status: DiffChanged, Changes: []Change{
+			{Element: "desc", Old: "Old", New: "New"},
+			{Element: "image", New: "./images/a.jpg"},
+		}},
+		{Path: "./b.nes", Status: DiffChanged, Changes: []Change{
+			{Element: "hidden", New: "true"},
+		}},
+		{Path: "./d.nes", Status: DiffAdded, Changes: []Change{
+			{Element: "name", New: "D"},
+			{Element: "rating", New: "0.5"},
+		}},
+		{Path: "./c.nes", Status: DiffRemoved},
+	}
+	if !reflect.DeepEqual(d.Games, want) {
+		t.Errorf("DiffList() => %+v; want %+v", d.Games, want)
+	}
+	wantFolders := []GameDiff{
+		{Path: "./rpg", Status: DiffChanged, Changes: []Change{{Element: "image", New: "./images/ff7.jpg"}}},
+		{Path: "./old", Status: DiffRemoved},
+	}
+	if !reflect.DeepEqual(d.Folders, wantFolders) {
+		t.Errorf("DiffList() => folders %+v; want %+v", d.Folders, wantFolders)
+	}
+	wantSummary := map[string]int{DiffAdded: 1, DiffChanged: 2, DiffRemoved: 1, DiffUnchanged: 0}
+	if !reflect.DeepEqual(d.Summary, wantSummary) {
+		t.Errorf("DiffList() => summary %v; want %v", d.Summary, wantSummary)
+	}
+	var b bytes.Buffer
+	if err := d.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() => err = %v; want nil", err)
+	}
+	for _, s := range []string{"changed ./a.nes\n", `  desc: "Old" => "New"`, "removed ./c.nes\n", "changed folder ./rpg\n", "1 added, 2 changed, 1 removed, 0 unchanged\n"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("WriteText() => %q; want it to contain %q", b.String(), s)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package rom
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sselph/scraper/ds"
+	"github.com/sselph/scraper/naming"
+)
+
+// DiscGroup is a game split across files with disc or side tags, ie
+// "Final Fantasy VII (USA) (Disc 1).cue" and "Final Fantasy VII (USA) (Disc 2).cue".
+type DiscGroup struct {
+	// Name is the base name of the files without the disc tag.
+	Name string
+	// Dir is the directory of the files.
+	Dir string
+	// Discs are the files of the game in disc order.
+	Discs []*ROM
+}
+
+// discName returns the base name without the disc tag and the disc of the base name.
+func discName(base string) (string, string) {
+	n := naming.Parse(base)
+	if n.Disc == "" {
+		return base, ""
+	}
+	t := n.Tags(naming.TagDisc)
+	name := strings.Replace(base, t, "", 1)
+	if name == base {
+		name = strings.Replace(base, strings.TrimSpace(t), "", 1)
+	}
+	return strings.TrimSpace(name), n.Disc
+}
+
+// byDisc sorts ROMs by the disc in their names, numerically when possible.
+type byDisc []*ROM
+
+func (d byDisc) Len() int      { return len(d) }
+func (d byDisc) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byDisc) Less(i, j int) bool {
+	_, a := discName(d[i].BaseName)
+	_, b := discName(d[j].BaseName)
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+// GroupDiscs groups the ROMs in the same directory whose names only differ by the
+// disc tag. ROMs without a disc tag or without other discs are returned in rest.
+func GroupDiscs(roms []*ROM) (groups []*DiscGroup, rest []*ROM) {
+	byKey := make(map[string]*DiscGroup)
+	var keys []string
+	for _, r := range roms {
+		name, disc := discName(r.BaseName)
+		if disc == "" {
+			rest = append(rest, r)
+			continue
+		}
+		k := filepath.Join(r.Dir, name) + r.Ext
+		g, ok := byKey[k]
+		if !ok {
+			g = &DiscGroup{Name: name, Dir: r.Dir}
+			byKey[k] = g
+			keys = append(keys, k)
+		}
+		g.Discs = append(g.Discs, r)
+	}
+	for _, k := range keys {
+		g := byKey[k]
+		if len(g.Discs) == 1 {
+			rest = append(rest, g.Discs[0])
+			continue
+		}
+		sort.Stable(byDisc(g.Discs))
+		groups = append(groups, g)
+	}
+	return groups, rest
+}
+
+// M3U returns the ROM of a playlist of the discs named after the game. The playlist
+// is only written by WriteM3U.
+func (g *DiscGroup) M3U() *ROM {
+	r := &ROM{Path: filepath.Join(g.Dir, g.Name+".m3u"), Cue: true, Discs: g.Discs}
+	r.populatePaths()
+	for _, d := range g.Discs {
+		r.Bins = append(r.Bins, d.Path)
+		r.Bins = append(r.Bins, d.Bins...)
+	}
+	return r
+}
+
+// WriteM3U writes the playlist of the discs. An existing playlist isn't changed.
+func (g *DiscGroup) WriteM3U() error {
+	p := g.M3U().Path
+	if exists(p) {
+		return nil
+	}
+	var b bytes.Buffer
+	for _, d := range g.Discs {
+		b.WriteString(d.FileName)
+		b.WriteString("\n")
+	}
+	return ioutil.WriteFile(p, b.Bytes(), 0664)
+}
+
+// Hidden returns the entries of the discs that aren't the entry of the game. They
+// are copies of the entry of the game marked hidden so only the game is listed.
+func (g *DiscGroup) Hidden(game *GameXML, opts *XMLOpts) []*GameXML {
+	var out []*GameXML
+	for _, d := range g.Discs {
+		p := fixPath(opts.RomXMLDir, opts.RomDir, d.Path)
+		if p == game.Path {
+			continue
+		}
+		h := *game
+		h.Path = p
+		h.Hidden = "true"
+		h.Lock = ""
+		h.CRC32 = ""
+		h.Attrs = nil
+		h.Extra = nil
+		h.Provenance = make(map[string]ds.Provenance)
+		for k, v := range game.Provenance {
+			h.Provenance[k] = v
+		}
+		out = append(out, &h)
+	}
+	return out
+}
+
+// HideDiscs marks the entries of the discs in the list hidden except the entry of
+// the game, the ROM sent to be scraped. They are entries from a run that didn't
+// group the discs.
+func (g *DiscGroup) HideDiscs(gl *GameListXML, entry *ROM, opts *XMLOpts) {
+	hide := make(map[string]bool)
+	for _, d := range g.Discs {
+		if d.Path != entry.Path {
+			hide[fixPath(opts.RomXMLDir, opts.RomDir, d.Path)] = true
+		}
+	}
+	for _, x := range gl.GameList {
+		if hide[x.Path] {
+			x.Hidden = "true"
+		}
+	}
+}
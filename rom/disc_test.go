@@ -0,0 +1,126 @@
+package rom
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupDiscs(t *testing.T) {
+	var roms []*ROM
+	for _, p := range []string{
+		"rpg/FF7 (USA) (Disc 2).cue",
+		"rpg/FF7 (USA) (Disc 10).cue",
+		"rpg/FF7 (USA) (Disc 1).cue",
+		"rpg/FF7 (Japan) (Disc 1).cue",
+		"Chrono Cross (USA).cue",
+		"Dungeon Master (Disk 1 of 2).adf",
+		"Dungeon Master (Disk 2 of 2).adf",
+	} {
+		r := &ROM{Path: filepath.FromSlash(p)}
+		r.populatePaths()
+		roms = append(roms, r)
+	}
+	groups, rest := GroupDiscs(roms)
+	if len(groups) != 2 {
+		t.Fatalf("GroupDiscs() => %d groups; want 2", len(groups))
+	}
+	tests := []struct {
+		name  string
+		discs []string
+	}{
+		{"FF7 (USA)", []string{"FF7 (USA) (Disc 1).cue", "FF7 (USA) (Disc 2).cue", "FF7 (USA) (Disc 10).cue"}},
+		{"Dungeon Master", []string{"Dungeon Master (Disk 1 of 2).adf", "Dungeon Master (Disk 2 of 2).adf"}},
+	}
+	for i, test := range tests {
+		g := groups[i]
+		var discs []string
+		for _, d := range g.Discs {
+			discs = append(discs, d.FileName)
+		}
+		if g.Name != test.name || len(discs) != len(test.discs) {
+			t.Errorf("GroupDiscs() => %q %v; want %q %v", g.Name, discs, test.name, test.discs)
+			continue
+		}
+		for j := range discs {
+			if discs[j] != test.discs[j] {
+				t.Errorf("GroupDiscs() => %q %v; want %q %v", g.Name, discs, test.name, test.discs)
+				break
+			}
+		}
+	}
+	if len(rest) != 2 || rest[0].FileName != "Chrono Cross (USA).cue" || rest[1].FileName != "FF7 (Japan) (Disc 1).cue" {
+		t.Errorf("GroupDiscs() => %d ROMs left; want Chrono Cross and FF7 (Japan)", len(rest))
+	}
+}
+
+func TestDiscGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g := &DiscGroup{Name: "FF7 (USA)", Dir: dir}
+	for _, f := range []string{"FF7 (USA) (Disc 1).chd", "FF7 (USA) (Disc 2).chd"} {
+		r := &ROM{Path: filepath.Join(dir, f)}
+		r.populatePaths()
+		g.Discs = append(g.Discs, r)
+	}
+	if err := g.WriteM3U(); err != nil {
+		t.Fatalf("WriteM3U() => err = %v; want nil", err)
+	}
+	m := g.M3U()
+	b, err := ioutil.ReadFile(m.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "FF7 (USA) (Disc 1).chd\nFF7 (USA) (Disc 2).chd\n"; string(b) != want {
+		t.Errorf("WriteM3U() => %q; want %q", b, want)
+	}
+	opts := &XMLOpts{RomDir: dir, RomXMLDir: "."}
+	game := &GameXML{Path: "./FF7 (USA).m3u", GameTitle: "Final Fantasy VII", Image: "./images/ff7.jpg"}
+	hidden := g.Hidden(game, opts)
+	if len(hidden) != 2 {
+		t.Fatalf("Hidden() => %d games; want 2", len(hidden))
+	}
+	for i, h := range hidden {
+		if h.Path != fixPath(".", dir, g.Discs[i].Path) || h.Hidden != "true" || h.GameTitle != game.GameTitle || h.Image != game.Image {
+			t.Errorf("Hidden() => %+v; want a hidden copy of the game for disc %d", h, i+1)
+		}
+	}
+	game.Path = hidden[0].Path
+	if hidden = g.Hidden(game, opts); len(hidden) != 1 {
+		t.Errorf("Hidden() with the first disc listed => %d games; want 1", len(hidden))
+	}
+}
+
+func TestHideDiscs(t *testing.T) {
+	g := &DiscGroup{Name: "FF7 (USA)", Dir: "/roms"}
+	for _, f := range []string{"FF7 (USA) (Disc 1).cue", "FF7 (USA) (Disc 2).cue"} {
+		r := &ROM{Path: filepath.Join("/roms", f)}
+		r.populatePaths()
+		g.Discs = append(g.Discs, r)
+	}
+	opts := &XMLOpts{RomDir: "/roms", RomXMLDir: "."}
+	tests := []struct {
+		entry *ROM
+		want  []string
+	}{
+		{g.Discs[0], []string{"", "true", ""}},
+		{g.M3U(), []string{"true", "true", ""}},
+	}
+	for _, test := range tests {
+		gl := &GameListXML{GameList: []*GameXML{
+			{Path: "./FF7 (USA) (Disc 1).cue"},
+			{Path: "./FF7 (USA) (Disc 2).cue"},
+			{Path: "./Chrono Cross (USA).cue"},
+		}}
+		g.HideDiscs(gl, test.entry, opts)
+		for i, x := range gl.GameList {
+			if x.Hidden != test.want[i] {
+				t.Errorf("HideDiscs(%q) => %s hidden = %q; want %q", test.entry.FileName, x.Path, x.Hidden, test.want[i])
+			}
+		}
+	}
+}
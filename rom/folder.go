@@ -0,0 +1,137 @@
+package rom
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sselph/scraper/naming"
+)
+
+// folderImage is the name, without extension, of a local image used for a folder.
+const folderImage = "folder"
+
+// folderGames are the games under a directory.
+type folderGames struct {
+	games []*GameXML
+	keys  map[string]bool
+	// direct is true if some of the games aren't in a subdirectory.
+	direct bool
+}
+
+// game returns the game when the directory holds a single one, like a ScummVM or
+// Daphne game or the discs of a multi-disc game. A directory only holding a
+// subdirectory with a single game isn't that game.
+func (f *folderGames) game() *GameXML {
+	if len(f.keys) != 1 || !f.direct {
+		return nil
+	}
+	for _, g := range f.games {
+		if g.Hidden != "true" {
+			return g
+		}
+	}
+	return f.games[0]
+}
+
+// image returns the first image of the games.
+func (f *folderGames) image() string {
+	for _, g := range f.games {
+		if g.Image != "" {
+			return g.Image
+		}
+	}
+	return ""
+}
+
+// isGameDir returns true if the directory is a game, like a Daphne game.
+func isGameDir(p string) bool {
+	switch filepath.Ext(p) {
+	case ".daphne", ".svm":
+		fi, err := os.Stat(p)
+		return err == nil && fi.IsDir()
+	}
+	return false
+}
+
+// AddFolders adds a <folder> for each subdirectory of the rom directory holding games
+// in the list. A folder holding a single game, or that is a game like a Daphne game,
+// is given the name, description and image of that game. Other folders are named
+// after the directory and use the first image of the games in them. A local
+// folder.jpg is used over scraped images. Folders already in the list only have
+// their empty elements filled so edits are kept. Folders of directories that no
+// longer exist are removed.
+func (gl *GameListXML) AddFolders(opts *XMLOpts) {
+	dirs := make(map[string]*folderGames)
+	for _, g := range gl.GameList {
+		p, err := filepath.Rel(opts.RomXMLDir, g.Path)
+		if err != nil || strings.HasPrefix(p, "..") {
+			continue
+		}
+		f := filepath.Join(opts.RomDir, p)
+		k := naming.ParseFile(f).Key()
+		parent := filepath.Dir(f)
+		if isGameDir(f) {
+			parent = f
+		}
+		for d := parent; d != filepath.Clean(opts.RomDir) && d != filepath.Dir(d); d = filepath.Dir(d) {
+			fg, ok := dirs[d]
+			if !ok {
+				fg = &folderGames{keys: make(map[string]bool)}
+				dirs[d] = fg
+			}
+			fg.games = append(fg.games, g)
+			fg.keys[k] = true
+			fg.direct = fg.direct || d == parent
+		}
+	}
+	var paths []string
+	for d := range dirs {
+		paths = append(paths, d)
+	}
+	sort.Strings(paths)
+	existing := make(map[string]*FolderXML)
+	var kept []*FolderXML
+	for _, f := range gl.Folders {
+		p, err := filepath.Rel(opts.RomXMLDir, f.Path)
+		if err == nil && !strings.HasPrefix(p, "..") {
+			if fi, err := os.Stat(filepath.Join(opts.RomDir, p)); err != nil || !fi.IsDir() {
+				continue
+			}
+		}
+		existing[f.Path] = f
+		kept = append(kept, f)
+	}
+	gl.Folders = kept
+	for _, d := range paths {
+		fg := dirs[d]
+		p := fixPath(opts.RomXMLDir, opts.RomDir, d)
+		f, ok := existing[p]
+		if !ok {
+			f = &FolderXML{Path: p}
+			gl.Folders = append(gl.Folders, f)
+		}
+		name, img := filepath.Base(d), fg.image()
+		if g := fg.game(); g != nil {
+			if g.GameTitle != "" {
+				name = g.GameTitle
+			}
+			if f.Overview == "" {
+				f.Overview = g.Overview
+			}
+			if g.Image != "" {
+				img = g.Image
+			}
+		}
+		if local, ok := fileExists(filepath.Join(d, folderImage+imgExts[0]), imgExts...); ok {
+			img = fixPath(opts.RomXMLDir, opts.RomDir, local)
+		}
+		if f.Name == "" {
+			f.Name = name
+		}
+		if f.Image == "" {
+			f.Image = img
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package rom
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAddFolders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "folders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"rpg/ff7", "sports", "action/mario", "lair.daphne"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "rpg", "folder.png"), []byte("img"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gl := &GameListXML{
+		GameList: []*GameXML{
+			{Path: "./a.cue", GameTitle: "A"},
+			{Path: "./rpg/ff7/Final Fantasy VII (USA) (Disc 1).cue", GameTitle: "Final Fantasy VII", Overview: "Cloud", Image: "./images/ff7-1.jpg"},
+			{Path: "./rpg/ff7/Final Fantasy VII (USA) (Disc 2).cue", GameTitle: "Final Fantasy VII", Overview: "Cloud", Hidden: "true"},
+			{Path: "./rpg/Chrono Cross (USA).cue", GameTitle: "Chrono Cross", Image: "./images/cc.jpg"},
+			{Path: "./sports/Madden (USA).cue", GameTitle: "Madden", Image: "./images/madden.jpg"},
+			{Path: "./action/mario/Mario (USA).nes", GameTitle: "Mario", Image: "./images/mario.jpg"},
+			{Path: "./lair.daphne", GameTitle: "Dragon's Lair", Overview: "Dirk"},
+		},
+		Folders: []*FolderXML{{Path: "./sports", Name: "Sport"}, {Path: "./racing", Name: "Racing"}},
+	}
+	gl.AddFolders(&XMLOpts{RomDir: dir, RomXMLDir: "."})
+	want := []*FolderXML{
+		{Path: "./sports", Name: "Sport", Image: "./images/madden.jpg"},
+		{Path: "./action", Name: "action", Image: "./images/mario.jpg"},
+		{Path: "./action/mario", Name: "Mario", Image: "./images/mario.jpg"},
+		{Path: "./lair.daphne", Name: "Dragon's Lair", Overview: "Dirk"},
+		{Path: "./rpg", Name: "rpg", Image: "./rpg/folder.png"},
+		{Path: "./rpg/ff7", Name: "Final Fantasy VII", Overview: "Cloud", Image: "./images/ff7-1.jpg"},
+	}
+	if len(gl.Folders) != len(want) {
+		t.Fatalf("AddFolders() => %d folders; want %d", len(gl.Folders), len(want))
+	}
+	for i, f := range gl.Folders {
+		if !reflect.DeepEqual(f, want[i]) {
+			t.Errorf("AddFolders() => %+v; want %+v", f, want[i])
+		}
+	}
+}
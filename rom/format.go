@@ -0,0 +1,87 @@
+package rom
+
+import (
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format reads and writes the game list of a frontend. The GameListXML is used as the
+// common representation so every format supports appending to and refreshing a list.
+type Format interface {
+	// Decode reads an existing game list into gl.
+	Decode(r io.Reader, gl *GameListXML) error
+	// Encode writes the game list.
+	Encode(w io.Writer, gl *GameListXML) error
+	// FileName is the default name of the game list file.
+	FileName() string
+}
+
+// GameWriter is implemented by formats that write files for each game, e.g. the
+// thumbnails of RetroArch. WriteGame is called once the images of the game are downloaded
+// and may set the fields of g the format needs.
+type GameWriter interface {
+	WriteGame(r *ROM, g *GameXML) error
+}
+
+// ESFormat is the gamelist.xml format of EmulationStation.
+type ESFormat struct{}
+
+// Decode implements Format.
+func (ESFormat) Decode(r io.Reader, gl *GameListXML) error {
+	return xml.NewDecoder(r).Decode(gl)
+}
+
+// Encode implements Format.
+func (ESFormat) Encode(w io.Writer, gl *GameListXML) error {
+	output, err := xml.MarshalIndent(gl, "  ", "    ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(output)
+	return err
+}
+
+// FileName implements Format.
+func (ESFormat) FileName() string {
+	return "gamelist.xml"
+}
+
+// localPath converts a path in the game list to the local path.
+func localPath(xmlDir, localDir, p string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(xmlDir), filepath.FromSlash(p))
+	if err != nil {
+		return filepath.FromSlash(p)
+	}
+	return filepath.Join(localDir, rel)
+}
+
+// absPath converts the rom path in the game list to an absolute path for frontends
+// that need one. If the path is relative, the local path is used.
+func absPath(opts *XMLOpts, p string) string {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") {
+		return p
+	}
+	ap, err := filepath.Abs(localPath(opts.RomXMLDir, opts.RomDir, p))
+	if err != nil {
+		return p
+	}
+	return ap
+}
+
+// relPath reverses absPath so local paths under the rom directory match the
+// paths created for the game list.
+func relPath(opts *XMLOpts, p string) string {
+	romDir, err := filepath.Abs(opts.RomDir)
+	if err != nil {
+		return p
+	}
+	if strings.HasPrefix(filepath.Clean(p), romDir+string(filepath.Separator)) {
+		return fixPath(opts.RomXMLDir, romDir, p)
+	}
+	return p
+}
@@ -0,0 +1,156 @@
+package rom
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/sselph/scraper/ds"
+)
+
+// Element is an XML element the scraper doesn't know, kept as written so it
+// survives appending to and refreshing a game list.
+type Element struct {
+	XMLName xml.Name
+	Attr    []xml.Attr `json:",omitempty"`
+	Inner   string     `json:",omitempty"`
+}
+
+type innerXML struct {
+	Inner string `xml:",innerxml"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (e *Element) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v innerXML
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	e.XMLName = start.Name
+	e.Attr = start.Attr
+	e.Inner = v.Inner
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler.
+func (e *Element) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name = e.XMLName
+	start.Attr = e.Attr
+	return enc.EncodeElement(innerXML{e.Inner}, start)
+}
+
+// unknownAttrs returns the attributes not in known.
+func unknownAttrs(attrs []xml.Attr, known ...string) []xml.Attr {
+	var out []xml.Attr
+Loop:
+	for _, a := range attrs {
+		for _, k := range known {
+			if a.Name.Space == "" && a.Name.Local == k {
+				continue Loop
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// UnmarshalXML implements xml.Unmarshaler keeping the unknown attributes.
+func (g *GameXML) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type game GameXML
+	if err := d.DecodeElement((*game)(g), &start); err != nil {
+		return err
+	}
+	g.Attrs = unknownAttrs(start.Attr, "id", "source", "fuzzy", "lock")
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler writing the unknown attributes.
+func (g *GameXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type game GameXML
+	start.Attr = append(start.Attr, g.Attrs...)
+	return e.EncodeElement((*game)(g), start)
+}
+
+// FolderXML is the object used to export the <folder> elements of the gamelist.xml.
+type FolderXML struct {
+	XMLName  xml.Name `xml:"folder"`
+	Path     string   `xml:"path"`
+	Name     string   `xml:"name"`
+	Overview string   `xml:"desc,omitempty"`
+	Image    string   `xml:"image,omitempty"`
+	// Attrs and Extra are the attributes and elements not known to the scraper.
+	Attrs []xml.Attr `xml:"-" json:",omitempty"`
+	Extra []Element  `xml:",any" json:",omitempty"`
+}
+
+// UnmarshalXML implements xml.Unmarshaler keeping the unknown attributes.
+func (f *FolderXML) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type folder FolderXML
+	if err := d.DecodeElement((*folder)(f), &start); err != nil {
+		return err
+	}
+	f.Attrs = unknownAttrs(start.Attr)
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler writing the unknown attributes.
+func (f *FolderXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type folder FolderXML
+	start.Attr = append(start.Attr, f.Attrs...)
+	return e.EncodeElement((*folder)(f), start)
+}
+
+// Locked returns the elements listed in the lock attribute, a comma-separated list of
+// the elements refreshing doesn't change.
+func (g *GameXML) Locked() []string {
+	var out []string
+	for _, x := range strings.Split(g.Lock, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// lock adds the element to the lock attribute.
+func (g *GameXML) lock(name string) {
+	for _, x := range g.Locked() {
+		if x == name {
+			return
+		}
+	}
+	g.Lock = strings.Join(append(g.Locked(), name), ",")
+}
+
+// Keep copies from old, the game in the list before refreshing, what scraping doesn't
+// set: the favorite, play count and last played values, the hidden and kid game
+// flags, the unknown attributes and elements, and the locked elements.
+func (g *GameXML) Keep(old *GameXML) {
+	g.Favorite = old.Favorite
+	g.LastPlayed = old.LastPlayed
+	g.PlayCount = old.PlayCount
+	if g.Hidden == "" {
+		g.Hidden = old.Hidden
+	}
+	if g.KidGame == "" {
+		g.KidGame = old.KidGame
+	}
+	g.Attrs = old.Attrs
+	g.Extra = old.Extra
+	if g.Provenance == nil {
+		g.Provenance = make(map[string]ds.Provenance)
+	}
+	values, ov := g.scraped(), old.scraped()
+	for _, name := range old.Locked() {
+		g.lock(name)
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		setValue(v, ov[name])
+		if p, ok := old.Provenance[name]; ok {
+			g.Provenance[name] = p
+		} else {
+			delete(g.Provenance, name)
+		}
+	}
+}
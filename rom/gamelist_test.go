@@ -0,0 +1,88 @@
+package rom
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sselph/scraper/ds"
+)
+
+const testGameList = `<gameList>
+	<provider><System>NES</System></provider>
+	<game id="1" source="theGamesDB.net" lock="desc" custom="x">
+		<path>./a.nes</path>
+		<name>A</name>
+		<desc>Edited</desc>
+		<sortname>a, the</sortname>
+	</game>
+	<folder hidden="true">
+		<path>./b</path>
+		<name>B</name>
+		<image>./b.png</image>
+	</folder>
+</gameList>`
+
+func TestGameListRoundTrip(t *testing.T) {
+	gl := &GameListXML{}
+	if err := xml.Unmarshal([]byte(testGameList), gl); err != nil {
+		t.Fatalf("xml.Unmarshal() => err = %v; want nil", err)
+	}
+	if len(gl.GameList) != 1 || len(gl.Folders) != 1 || len(gl.Extra) != 1 {
+		t.Fatalf("xml.Unmarshal() => %d games, %d folders, %d extra; want 1, 1, 1", len(gl.GameList), len(gl.Folders), len(gl.Extra))
+	}
+	g := gl.GameList[0]
+	if g.ID != "1" || g.Lock != "desc" || len(g.Attrs) != 1 || len(g.Extra) != 1 {
+		t.Errorf("xml.Unmarshal() => %+v; want id, lock, one attribute and one element", g)
+	}
+	b, err := xml.Marshal(gl)
+	if err != nil {
+		t.Fatalf("xml.Marshal() => err = %v; want nil", err)
+	}
+	for _, s := range []string{
+		`<provider><System>NES</System></provider>`,
+		`custom="x"`,
+		`lock="desc"`,
+		`<sortname>a, the</sortname>`,
+		`<folder hidden="true"><path>./b</path><name>B</name><image>./b.png</image></folder>`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("xml.Marshal() => %s; want it to contain %s", b, s)
+		}
+	}
+}
+
+func TestKeep(t *testing.T) {
+	p := ds.Provenance{Source: "gdb", Match: ds.MatchSHA1}
+	old := &GameXML{
+		Lock:       "desc,players",
+		GameTitle:  "Old",
+		Overview:   "Mine",
+		PlayCount:  "3",
+		Favorite:   "true",
+		Attrs:      []xml.Attr{{Name: xml.Name{Local: "custom"}, Value: "x"}},
+		Extra:      []Element{{XMLName: xml.Name{Local: "sortname"}, Inner: "a"}},
+		Provenance: map[string]ds.Provenance{"name": p},
+	}
+	g := &GameXML{
+		GameTitle:  "New",
+		Overview:   "Scraped",
+		Players:    "2",
+		Provenance: map[string]ds.Provenance{"name": p, "desc": p, "players": p},
+	}
+	g.Keep(old)
+	want := &GameXML{
+		Lock:       "desc,players",
+		GameTitle:  "New",
+		Overview:   "Mine",
+		PlayCount:  "3",
+		Favorite:   "true",
+		Attrs:      old.Attrs,
+		Extra:      old.Extra,
+		Provenance: map[string]ds.Provenance{"name": p},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("Keep() => %+v; want %+v", g, want)
+	}
+}
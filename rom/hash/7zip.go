@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/kjk/lzmadec"
 )
@@ -21,14 +22,14 @@ func init() {
 	has7z = err == nil
 }
 
-func decode7Zip(f string) (io.ReadCloser, error) {
+func decode7Zip(f string, get getter) (io.ReadCloser, string, error) {
 	r, err := lzmadec.NewArchive(f)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	for _, e := range r.Entries {
-		ext := filepath.Ext(e.Path)
-		if decoder, ok := getDecoder(ext); ok {
+		ext := strings.ToLower(filepath.Ext(e.Path))
+		if decoder, ok := get(ext); ok {
 			rf, err := r.GetFileReader(e.Path)
 			if err != nil {
 				continue
@@ -37,8 +38,8 @@ func decode7Zip(f string) (io.ReadCloser, error) {
 			if err != nil {
 				continue
 			}
-			return rom, nil
+			return rom, ext, nil
 		}
 	}
-	return nil, fmt.Errorf("No valid roms found in 7zip.")
+	return nil, "", fmt.Errorf("No valid roms found in 7zip.")
 }
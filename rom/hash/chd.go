@@ -0,0 +1,742 @@
+package hash
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	chdTag       = "MComprHD"
+	chdV5Length  = 124
+	chdMaxMeta   = 1024
+	chdMetaCHT2  = "CHT2"
+	chdMetaCHTR  = "CHTR"
+	chdMetaCHGD  = "CHGD"
+	chdMetaEntry = 16
+
+	chdFrameSize    = 2448
+	chdSectorSize   = 2352
+	chdSubcodeSize  = 96
+	chdMapHeader    = 16
+	chdMapEntry     = 4
+	chdHuffmanCodes = 16
+	chdHuffmanBits  = 8
+
+	// chdMaxHunkBytes is the largest hunk chdman creates.
+	chdMaxHunkBytes = 1 << 20
+	// chdMaxRepeat is the most hunks a bit of a compressed map describes: a run of
+	// 2+16+255 hunks coded with three codes of at least one bit.
+	chdMaxRepeat = 91
+)
+
+// The ways a hunk is stored in the map of a v5 CHD. The first four use the
+// compressors of the header in order.
+const (
+	chdCompType0 = iota
+	chdCompType1
+	chdCompType2
+	chdCompType3
+	chdCompNone
+	chdCompSelf
+	chdCompParent
+	chdCompRLESmall
+	chdCompRLELarge
+	chdCompSelf0
+	chdCompSelf1
+	chdCompParentSelf
+	chdCompParent0
+	chdCompParent1
+)
+
+var errCHDMap = errors.New("chd: invalid map")
+
+// cdSyncHeader is the sync header of a CD sector, removed by the CD codecs along
+// with the ECC when they can be regenerated.
+var cdSyncHeader = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// chdTrackData are the bytes of each frame a track of each type uses, the same
+// as the sector size of the track in a .cue.
+var chdTrackData = map[string]int{
+	"MODE1":          2048,
+	"MODE1_RAW":      2352,
+	"MODE2":          2336,
+	"MODE2_FORM1":    2048,
+	"MODE2_FORM2":    2324,
+	"MODE2_FORM_MIX": 2336,
+	"MODE2_RAW":      2352,
+	"AUDIO":          2352,
+}
+
+// CHDTrack is the metadata for a single CD or GD-ROM track stored in a CHD.
+type CHDTrack struct {
+	Number     int
+	Type       string
+	SubType    string
+	Frames     int
+	Pad        int
+	Pregap     int
+	PregapType string
+	PregapSub  string
+	Postgap    int
+}
+
+// CHD is the information stored in the header of a MAME Compressed Hunks of Data file.
+type CHD struct {
+	Version      int
+	LogicalBytes int64
+	HunkBytes    int
+	UnitBytes    int
+	// RawSHA1 is the SHA1 of the uncompressed data only.
+	RawSHA1 string
+	// SHA1 is the SHA1 of the data and metadata. This is the value found in MAME and Redump CHD DATs.
+	SHA1       string
+	ParentSHA1 string
+	Tracks     []CHDTrack
+
+	compressors [4]string
+	mapOffset   int64
+	// size is the size of the file.
+	size int64
+}
+
+// ReadCHD reads the header and track metadata of a v5 CHD file.
+func ReadCHD(p string) (*CHD, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readCHD(f, fi.Size())
+}
+
+// readCHD reads the header of the CHD of size bytes. The sizes and offsets of the
+// header are checked so a corrupt file doesn't make the map or metadata huge.
+func readCHD(r io.ReaderAt, size int64) (*CHD, error) {
+	h := make([]byte, chdV5Length)
+	if _, err := r.ReadAt(h, 0); err != nil {
+		return nil, fmt.Errorf("chd: can't read header: %v", err)
+	}
+	if !bytes.Equal(h[:8], []byte(chdTag)) {
+		return nil, fmt.Errorf("chd: invalid tag")
+	}
+	version := int(binary.BigEndian.Uint32(h[12:16]))
+	if version != 5 || binary.BigEndian.Uint32(h[8:12]) != chdV5Length {
+		return nil, fmt.Errorf("chd: unsupported version %d", version)
+	}
+	c := &CHD{
+		Version:      version,
+		LogicalBytes: int64(binary.BigEndian.Uint64(h[32:40])),
+		HunkBytes:    int(binary.BigEndian.Uint32(h[56:60])),
+		UnitBytes:    int(binary.BigEndian.Uint32(h[60:64])),
+		RawSHA1:      hex.EncodeToString(h[64:84]),
+		SHA1:         hex.EncodeToString(h[84:104]),
+		size:         size,
+	}
+	if c.UnitBytes <= 0 || c.HunkBytes <= 0 || c.HunkBytes > chdMaxHunkBytes || c.HunkBytes%c.UnitBytes != 0 {
+		return nil, fmt.Errorf("chd: invalid hunk size %d for units of %d bytes", c.HunkBytes, c.UnitBytes)
+	}
+	if c.LogicalBytes < 0 {
+		return nil, fmt.Errorf("chd: invalid size %d", c.LogicalBytes)
+	}
+	for i := range c.compressors {
+		if tag := h[16+4*i : 20+4*i]; !bytes.Equal(tag, make([]byte, 4)) {
+			c.compressors[i] = string(tag)
+		}
+	}
+	c.mapOffset = int64(binary.BigEndian.Uint64(h[40:48]))
+	if parent := h[104:124]; !bytes.Equal(parent, make([]byte, 20)) {
+		c.ParentSHA1 = hex.EncodeToString(parent)
+	}
+	meta := binary.BigEndian.Uint64(h[48:56])
+	for i := 0; meta != 0 && i < chdMaxMeta; i++ {
+		e := make([]byte, chdMetaEntry)
+		if _, err := r.ReadAt(e, int64(meta)); err != nil {
+			return nil, fmt.Errorf("chd: can't read metadata: %v", err)
+		}
+		tag := string(e[:4])
+		length := int(e[5])<<16 | int(e[6])<<8 | int(e[7])
+		next := binary.BigEndian.Uint64(e[8:16])
+		if meta+chdMetaEntry+uint64(length) > uint64(size) {
+			return nil, errors.New("chd: metadata past the end of the file")
+		}
+		switch tag {
+		case chdMetaCHT2, chdMetaCHTR, chdMetaCHGD:
+			d := make([]byte, length)
+			if _, err := r.ReadAt(d, int64(meta)+chdMetaEntry); err != nil {
+				return nil, fmt.Errorf("chd: can't read metadata: %v", err)
+			}
+			c.Tracks = append(c.Tracks, parseCHDTrack(string(bytes.TrimRight(d, "\x00"))))
+		}
+		meta = next
+	}
+	return c, nil
+}
+
+// parseCHDTrack parses track metadata of the form "TRACK:1 TYPE:MODE2_RAW SUBTYPE:NONE FRAMES:1234 ...".
+func parseCHDTrack(s string) CHDTrack {
+	var t CHDTrack
+	for _, f := range strings.Fields(s) {
+		kv := strings.SplitN(f, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		i, _ := strconv.Atoi(kv[1])
+		switch kv[0] {
+		case "TRACK":
+			t.Number = i
+		case "TYPE":
+			t.Type = kv[1]
+		case "SUBTYPE":
+			t.SubType = kv[1]
+		case "FRAMES":
+			t.Frames = i
+		case "PAD":
+			t.Pad = i
+		case "PREGAP":
+			t.Pregap = i
+		case "PGTYPE":
+			t.PregapType = kv[1]
+		case "PGSUB":
+			t.PregapSub = kv[1]
+		case "POSTGAP":
+			t.Postgap = i
+		}
+	}
+	return t
+}
+
+// chdHunk is how and where a hunk is stored.
+type chdHunk struct {
+	comp   int
+	length uint32
+	offset uint64
+}
+
+// bitReader reads the bits of the map most significant first. Reading past the end
+// returns zeros.
+type bitReader struct {
+	b    []byte
+	pos  int
+	buf  uint32
+	bits uint
+}
+
+func (r *bitReader) peek(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	for n > r.bits && r.bits <= 24 {
+		var b uint32
+		if r.pos < len(r.b) {
+			b = uint32(r.b[r.pos])
+		}
+		r.pos++
+		r.buf |= b << (24 - r.bits)
+		r.bits += 8
+	}
+	return r.buf >> (32 - n)
+}
+
+func (r *bitReader) read(n uint) uint32 {
+	v := r.peek(n)
+	r.buf <<= n
+	r.bits -= n
+	return v
+}
+
+// chdHuffman decodes the compression types of the map.
+type chdHuffman struct {
+	// lookup holds the value and length of the code for every possible next 8 bits.
+	lookup [1 << chdHuffmanBits]uint16
+}
+
+// readCHDHuffman reads the code lengths, run-length encoded, and builds the
+// canonical codes.
+func readCHDHuffman(r *bitReader) (*chdHuffman, error) {
+	var lens [chdHuffmanCodes]uint32
+	for cur := 0; cur < chdHuffmanCodes; {
+		n := r.read(4)
+		if n != 1 {
+			lens[cur] = n
+			cur++
+			continue
+		}
+		if n = r.read(4); n == 1 {
+			lens[cur] = n
+			cur++
+			continue
+		}
+		count := int(r.read(4)) + 3
+		if cur+count > chdHuffmanCodes {
+			return nil, errCHDMap
+		}
+		for ; count > 0; count-- {
+			lens[cur] = n
+			cur++
+		}
+	}
+	var start [33]uint32
+	for _, l := range lens {
+		if l > chdHuffmanBits {
+			return nil, errCHDMap
+		}
+		start[l]++
+	}
+	var cur uint32
+	for l := 32; l > 0; l-- {
+		next := (cur + start[l]) >> 1
+		if l != 1 && next*2 != cur+start[l] {
+			return nil, errCHDMap
+		}
+		start[l] = cur
+		cur = next
+	}
+	h := &chdHuffman{}
+	for v, l := range lens {
+		if l == 0 {
+			continue
+		}
+		code := start[l]
+		start[l]++
+		shift := chdHuffmanBits - l
+		for i := code << shift; i < (code+1)<<shift; i++ {
+			h.lookup[i] = uint16(v)<<4 | uint16(l)
+		}
+	}
+	return h, nil
+}
+
+func (h *chdHuffman) decode(r *bitReader) int {
+	e := h.lookup[r.peek(chdHuffmanBits)]
+	r.read(uint(e & 0xf))
+	return int(e >> 4)
+}
+
+// hunkCount returns the number of hunks of the CHD.
+func (c *CHD) hunkCount() int64 {
+	n := c.LogicalBytes / int64(c.HunkBytes)
+	if c.LogicalBytes%int64(c.HunkBytes) != 0 {
+		n++
+	}
+	return n
+}
+
+// readMap reads where and how each hunk is stored. The number of hunks is checked
+// against the size of the map before it is allocated.
+func (c *CHD) readMap(r io.ReaderAt) ([]chdHunk, error) {
+	n := c.hunkCount()
+	if c.mapOffset < chdV5Length || c.mapOffset > c.size {
+		return nil, errCHDMap
+	}
+	left := c.size - c.mapOffset
+	if c.compressors[0] == "" {
+		if n > left/chdMapEntry {
+			return nil, errCHDMap
+		}
+		hunks := make([]chdHunk, n)
+		m := make([]byte, n*chdMapEntry)
+		if _, err := r.ReadAt(m, c.mapOffset); err != nil {
+			return nil, fmt.Errorf("chd: can't read map: %v", err)
+		}
+		for i := range hunks {
+			off := uint64(binary.BigEndian.Uint32(m[i*chdMapEntry:])) * uint64(c.HunkBytes)
+			hunks[i] = chdHunk{comp: chdCompNone, length: uint32(c.HunkBytes), offset: off}
+		}
+		return hunks, nil
+	}
+	h := make([]byte, chdMapHeader)
+	if _, err := r.ReadAt(h, c.mapOffset); err != nil {
+		return nil, fmt.Errorf("chd: can't read map: %v", err)
+	}
+	length := int64(binary.BigEndian.Uint32(h[0:4]))
+	if length > left-chdMapHeader || n > (length+1)*8*chdMaxRepeat {
+		return nil, errCHDMap
+	}
+	hunks := make([]chdHunk, n)
+	m := make([]byte, length)
+	if _, err := r.ReadAt(m, c.mapOffset+chdMapHeader); err != nil {
+		return nil, fmt.Errorf("chd: can't read map: %v", err)
+	}
+	cur := uint64(h[4])<<40 | uint64(h[5])<<32 | uint64(binary.BigEndian.Uint32(h[6:10]))
+	lengthBits, selfBits, parentBits := uint(h[12]), uint(h[13]), uint(h[14])
+	br := &bitReader{b: m}
+	huff, err := readCHDHuffman(br)
+	if err != nil {
+		return nil, err
+	}
+	var last, repeat int
+	for i := range hunks {
+		if repeat > 0 {
+			hunks[i].comp = last
+			repeat--
+			continue
+		}
+		switch v := huff.decode(br); v {
+		case chdCompRLESmall:
+			hunks[i].comp = last
+			repeat = 2 + huff.decode(br)
+		case chdCompRLELarge:
+			hunks[i].comp = last
+			repeat = 2 + 16 + huff.decode(br)<<4
+			repeat += huff.decode(br)
+		default:
+			hunks[i].comp = v
+			last = v
+		}
+	}
+	var lastSelf, lastParent uint64
+	unitsPerHunk := uint64(c.HunkBytes / c.UnitBytes)
+	for i := range hunks {
+		x := &hunks[i]
+		x.offset = cur
+		switch x.comp {
+		case chdCompType0, chdCompType1, chdCompType2, chdCompType3:
+			x.length = br.read(lengthBits)
+			cur += uint64(x.length)
+			br.read(16)
+		case chdCompNone:
+			x.length = uint32(c.HunkBytes)
+			cur += uint64(x.length)
+			br.read(16)
+		case chdCompSelf:
+			x.offset = uint64(br.read(selfBits))
+			lastSelf = x.offset
+		case chdCompParent:
+			x.offset = uint64(br.read(parentBits))
+			lastParent = x.offset
+		case chdCompSelf1:
+			lastSelf++
+			fallthrough
+		case chdCompSelf0:
+			x.comp = chdCompSelf
+			x.offset = lastSelf
+		case chdCompParentSelf:
+			x.comp = chdCompParent
+			x.offset = uint64(i) * unitsPerHunk
+			lastParent = x.offset
+		case chdCompParent1:
+			lastParent += unitsPerHunk
+			fallthrough
+		case chdCompParent0:
+			x.comp = chdCompParent
+			x.offset = lastParent
+		default:
+			return nil, errCHDMap
+		}
+	}
+	return hunks, nil
+}
+
+// readHunk reads hunk i into dst which is HunkBytes long.
+func (c *CHD) readHunk(r io.ReaderAt, hunks []chdHunk, i int, dst []byte) error {
+	h := hunks[i]
+	switch h.comp {
+	case chdCompType0, chdCompType1, chdCompType2, chdCompType3:
+		if h.offset+uint64(h.length) > uint64(c.size) {
+			return errCHDMap
+		}
+		src := make([]byte, h.length)
+		if _, err := r.ReadAt(src, int64(h.offset)); err != nil {
+			return fmt.Errorf("chd: can't read hunk %d: %v", i, err)
+		}
+		return chdDecompress(c.compressors[h.comp], src, dst)
+	case chdCompNone:
+		// Offset 0 is the header so the hunk was never written.
+		if h.offset == 0 {
+			for j := range dst {
+				dst[j] = 0
+			}
+			return nil
+		}
+		if _, err := r.ReadAt(dst, int64(h.offset)); err != nil {
+			return fmt.Errorf("chd: can't read hunk %d: %v", i, err)
+		}
+		return nil
+	case chdCompSelf:
+		if h.offset >= uint64(i) {
+			return errCHDMap
+		}
+		return c.readHunk(r, hunks, int(h.offset), dst)
+	}
+	return errors.New("chd: chds with a parent aren't supported")
+}
+
+// chdDecompress decompresses a hunk with the codec of the tag. Only zlib, lzma and
+// the CD codecs using them, cdzl and cdlz, are supported. The FLAC, Huffman and
+// Zstandard codecs aren't, including cdfl which chdman uses by default for CDs along
+// with cdlz and cdzl, so a CHD with hunks it compressed best can't be hashed.
+func chdDecompress(tag string, src, dst []byte) error {
+	switch tag {
+	case "zlib":
+		return inflate(src, dst)
+	case "lzma":
+		return lzmaDecode(src, dst)
+	case "cdzl":
+		return cdDecompress(src, dst, inflate)
+	case "cdlz":
+		return cdDecompress(src, dst, lzmaDecode)
+	}
+	return fmt.Errorf("chd: unsupported codec %q", tag)
+}
+
+// inflate decompresses the raw deflate data in src into dst.
+func inflate(src, dst []byte) error {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	_, err := io.ReadFull(r, dst)
+	return err
+}
+
+// cdDecompress decompresses the frames of a hunk of a CD. The sectors are compressed
+// with base and the subcodes with deflate, and sectors whose ECC could be
+// regenerated had it removed along with the sync header.
+func cdDecompress(src, dst []byte, base func(src, dst []byte) error) error {
+	frames := len(dst) / chdFrameSize
+	eccBytes, lenBytes := (frames+7)/8, 2
+	if len(dst) >= 65536 {
+		lenBytes = 3
+	}
+	header := eccBytes + lenBytes
+	if len(src) < header {
+		return errors.New("chd: invalid cd hunk")
+	}
+	baseLen := int(src[eccBytes])<<8 | int(src[eccBytes+1])
+	if lenBytes > 2 {
+		baseLen = baseLen<<8 | int(src[eccBytes+2])
+	}
+	if header+baseLen > len(src) {
+		return errors.New("chd: invalid cd hunk")
+	}
+	sectors := make([]byte, frames*chdSectorSize)
+	subcodes := make([]byte, frames*chdSubcodeSize)
+	if err := base(src[header:header+baseLen], sectors); err != nil {
+		return err
+	}
+	if err := inflate(src[header+baseLen:], subcodes); err != nil {
+		return err
+	}
+	for i := 0; i < frames; i++ {
+		frame := dst[i*chdFrameSize : (i+1)*chdFrameSize]
+		copy(frame, sectors[i*chdSectorSize:(i+1)*chdSectorSize])
+		copy(frame[chdSectorSize:], subcodes[i*chdSubcodeSize:(i+1)*chdSubcodeSize])
+		if src[i/8]&(1<<uint(i%8)) != 0 {
+			copy(frame, cdSyncHeader)
+			eccGenerate(frame)
+		}
+	}
+	return nil
+}
+
+// The P and Q parity of a CD sector.
+const (
+	eccPOffset = 0x81c
+	eccPBytes  = 86
+	eccPComp   = 24
+	eccQOffset = eccPOffset + 2*eccPBytes
+	eccQBytes  = 52
+	eccQComp   = 43
+)
+
+// eccLow multiplies by 2 and eccHigh divides by 3 in the Galois field of the ECC.
+var eccLow, eccHigh [256]byte
+
+func init() {
+	for i := 0; i < 256; i++ {
+		j := i << 1
+		if i&0x80 != 0 {
+			j ^= 0x11d
+		}
+		eccLow[i] = byte(j)
+		eccHigh[byte(j)^byte(i)] = byte(i)
+	}
+}
+
+// eccSource returns the byte of the sector at off from the header. The header of a
+// mode 2 sector counts as zeros.
+func eccSource(sector []byte, off int) byte {
+	if sector[15] == 2 && off < 4 {
+		return 0
+	}
+	return sector[12+off]
+}
+
+// eccCompute computes the two parity bytes of a P or Q vector.
+func eccCompute(sector []byte, n int, off func(i int) int) (byte, byte) {
+	var v1, v2 byte
+	for i := 0; i < n; i++ {
+		b := eccSource(sector, off(i))
+		v1 = eccLow[v1^b]
+		v2 ^= b
+	}
+	v1 = eccHigh[eccLow[v1]^v2]
+	return v1, v2 ^ v1
+}
+
+// eccGenerate sets the P and Q parity of the sector.
+func eccGenerate(sector []byte) {
+	for b := 0; b < eccPBytes; b++ {
+		sector[eccPOffset+b], sector[eccPOffset+eccPBytes+b] = eccCompute(sector, eccPComp, func(i int) int {
+			return b + eccPBytes*i
+		})
+	}
+	for b := 0; b < eccQBytes; b++ {
+		sector[eccQOffset+b], sector[eccQOffset+eccQBytes+b] = eccCompute(sector, eccQComp, func(i int) int {
+			return 2*((eccQComp*(b/2)+(eccQComp+1)*i)%(eccQComp*26)) + b&1
+		})
+	}
+}
+
+// chdData reads the data of a CHD as it is hashed: the first track of a CD with the
+// sectors as they are in a .bin, or all the data of other CHDs.
+type chdData struct {
+	f     *os.File
+	c     *CHD
+	hunks []chdHunk
+	hunk  []byte
+	cur   int
+	// frame is the next frame to read and frames the number of frames.
+	frame, frames int
+	// frameSize is the size of a frame in the CHD and dataSize the size read from it.
+	frameSize, dataSize int
+	audio               bool
+	rest                []byte
+}
+
+// openCHD opens the data of the CHD at p.
+func openCHD(p string) (*chdData, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c, err := readCHD(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	hunks, err := c.readMap(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d := &chdData{f: f, c: c, hunks: hunks, hunk: make([]byte, c.HunkBytes), cur: -1}
+	if len(c.Tracks) == 0 {
+		d.frameSize, d.dataSize = c.HunkBytes, c.HunkBytes
+		d.frames = int(c.hunkCount())
+		return d, nil
+	}
+	t := c.Tracks[0]
+	for _, x := range c.Tracks {
+		if x.Number == 1 {
+			t = x
+		}
+	}
+	d.frameSize, d.frames = chdFrameSize, t.Frames
+	d.dataSize = chdSectorSize
+	if n, ok := chdTrackData[t.Type]; ok {
+		d.dataSize = n
+	}
+	d.audio = t.Type == "AUDIO"
+	if d.frameSize > c.HunkBytes || c.HunkBytes%d.frameSize != 0 {
+		f.Close()
+		return nil, fmt.Errorf("chd: hunks of %d bytes don't hold whole frames", c.HunkBytes)
+	}
+	return d, nil
+}
+
+// next reads the next frame.
+func (d *chdData) next() ([]byte, error) {
+	b, err := d.readFrame(d.frame)
+	d.frame++
+	return b, err
+}
+
+// readFrame reads the data of frame i.
+func (d *chdData) readFrame(i int) ([]byte, error) {
+	off := int64(i) * int64(d.frameSize)
+	h := int(off / int64(d.c.HunkBytes))
+	if h >= len(d.hunks) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if h != d.cur {
+		if err := d.c.readHunk(d.f, d.hunks, h, d.hunk); err != nil {
+			return nil, err
+		}
+		d.cur = h
+	}
+	start := int(off % int64(d.c.HunkBytes))
+	n := d.dataSize
+	if left := d.c.LogicalBytes - off; int64(n) > left {
+		n = int(left)
+	}
+	b := make([]byte, n)
+	copy(b, d.hunk[start:])
+	if d.audio {
+		// Audio is stored big-endian and little-endian in a .bin.
+		for j := 0; j+1 < len(b); j += 2 {
+			b[j], b[j+1] = b[j+1], b[j]
+		}
+	}
+	return b, nil
+}
+
+// ReadAt implements io.ReaderAt. Offsets are in the data as it is read.
+func (d *chdData) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		i := int(off / int64(d.dataSize))
+		if i >= d.frames {
+			return n, io.EOF
+		}
+		b, err := d.readFrame(i)
+		if err != nil {
+			return n, err
+		}
+		start := int(off % int64(d.dataSize))
+		if start >= len(b) {
+			return n, io.EOF
+		}
+		c := copy(p[n:], b[start:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (d *chdData) Read(p []byte) (int, error) {
+	for len(d.rest) == 0 {
+		if d.frame >= d.frames {
+			return 0, io.EOF
+		}
+		b, err := d.next()
+		if err != nil {
+			return 0, err
+		}
+		d.rest = b
+	}
+	n := copy(p, d.rest)
+	d.rest = d.rest[n:]
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (d *chdData) Close() error {
+	return d.f.Close()
+}
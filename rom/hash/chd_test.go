@@ -0,0 +1,332 @@
+package hash
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCHD(t *testing.T) {
+	h := make([]byte, chdV5Length)
+	copy(h, chdTag)
+	binary.BigEndian.PutUint32(h[8:12], chdV5Length)
+	binary.BigEndian.PutUint32(h[12:16], 5)
+	binary.BigEndian.PutUint64(h[32:40], 2352*10)
+	binary.BigEndian.PutUint64(h[48:56], chdV5Length)
+	binary.BigEndian.PutUint32(h[56:60], 2448*8)
+	binary.BigEndian.PutUint32(h[60:64], 2448)
+	copy(h[64:84], bytes.Repeat([]byte{0x11}, 20))
+	copy(h[84:104], bytes.Repeat([]byte{0x22}, 20))
+	track := []byte("TRACK:1 TYPE:MODE2_RAW SUBTYPE:NONE FRAMES:10 PREGAP:150 PGTYPE:MODE2_RAW PGSUB:RW POSTGAP:0\x00")
+	m := make([]byte, chdMetaEntry)
+	copy(m, chdMetaCHT2)
+	m[7] = byte(len(track))
+	h = append(h, m...)
+	h = append(h, track...)
+
+	dir, err := ioutil.TempDir("", "chd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "test.chd")
+	if err := ioutil.WriteFile(p, h, 0664); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadCHD(p)
+	if err != nil {
+		t.Fatalf("ReadCHD(%q) => err = %v; want nil", p, err)
+	}
+	if want := "1111111111111111111111111111111111111111"; c.RawSHA1 != want {
+		t.Errorf("ReadCHD(%q).RawSHA1 => %q; want %q", p, c.RawSHA1, want)
+	}
+	if want := "2222222222222222222222222222222222222222"; c.SHA1 != want {
+		t.Errorf("ReadCHD(%q).SHA1 => %q; want %q", p, c.SHA1, want)
+	}
+	if c.ParentSHA1 != "" {
+		t.Errorf("ReadCHD(%q).ParentSHA1 => %q; want \"\"", p, c.ParentSHA1)
+	}
+	want := CHDTrack{Number: 1, Type: "MODE2_RAW", SubType: "NONE", Frames: 10, Pregap: 150, PregapType: "MODE2_RAW", PregapSub: "RW"}
+	if len(c.Tracks) != 1 || c.Tracks[0] != want {
+		t.Errorf("ReadCHD(%q).Tracks => %+v; want [%+v]", p, c.Tracks, want)
+	}
+	if !KnownExt(".chd") {
+		t.Errorf("KnownExt(\".chd\") => false; want true")
+	}
+}
+
+func TestReadCHDInvalid(t *testing.T) {
+	header := func(f func(h []byte)) []byte {
+		// The header is followed by the map header or a metadata entry.
+		h := make([]byte, chdV5Length+chdMapHeader)
+		copy(h, chdTag)
+		binary.BigEndian.PutUint32(h[8:12], chdV5Length)
+		binary.BigEndian.PutUint32(h[12:16], 5)
+		binary.BigEndian.PutUint64(h[32:40], 2448*8)
+		binary.BigEndian.PutUint64(h[40:48], chdV5Length)
+		binary.BigEndian.PutUint32(h[56:60], 2448*8)
+		binary.BigEndian.PutUint32(h[60:64], 2448)
+		f(h)
+		return h
+	}
+	tests := []struct {
+		name string
+		chd  []byte
+	}{
+		{"no unit", header(func(h []byte) { binary.BigEndian.PutUint32(h[60:64], 0) })},
+		{"no hunk", header(func(h []byte) { binary.BigEndian.PutUint32(h[56:60], 0) })},
+		{"partial unit", header(func(h []byte) { binary.BigEndian.PutUint32(h[56:60], 2448*8+1) })},
+		{"huge hunk", header(func(h []byte) { binary.BigEndian.PutUint32(h[56:60], 2448*1000) })},
+		{"metadata past end", header(func(h []byte) {
+			binary.BigEndian.PutUint64(h[48:56], chdV5Length)
+			copy(h[chdV5Length:], chdMetaCHT2)
+			h[chdV5Length+5] = 0xff
+		})},
+		{"map past end", header(func(h []byte) { binary.BigEndian.PutUint64(h[40:48], 1<<40) })},
+		{"too many hunks", header(func(h []byte) { binary.BigEndian.PutUint64(h[32:40], 1<<50) })},
+		{"compressed map past end", header(func(h []byte) {
+			copy(h[16:], "zlib")
+			binary.BigEndian.PutUint32(h[chdV5Length:], 1<<30)
+		})},
+	}
+	for _, tt := range tests {
+		r := bytes.NewReader(tt.chd)
+		c, err := readCHD(r, r.Size())
+		if err == nil {
+			_, err = c.readMap(r)
+		}
+		if err == nil {
+			t.Errorf("readCHD(%s) => err = nil; want an error", tt.name)
+		}
+	}
+}
+
+// lzmaTest is lzmaTestData() compressed as raw LZMA with lc=3, lp=0 and pb=2.
+const lzmaTest = "00000a191f707977ac843fdd77cf2bbcfb10b47ec1f865e314c51a0dca7477103f4b7488573b2c48544168dc2258c331cbf3e9b51bb7838dd1c12780c8d652e483ef6507a88b935ed9b365a6f466645105d870cabddefaa6ca3bdce91ab5ef46be4c8c9f9e5fa68396c0f94016f9f440230cd5e3bc2f1dbe0c7365fa388c0674919db395f610d023d20704efe2383a58ff14afe31214e7eb84795a4333a2d0073c6235ac7585f36b9cfb9b23ee00d3bf1344e24d4411f8c30e49b253f97dc26f9c91cea57ccdd3a2291fc1e153085576e1d04990f6f18b467b1554e6550dd9bbb0889fd6fe632c903e0f9ec2259deabb622a9e61773f1386cad04e2034b84e7b910540672e6f7ac2a707768031340a755aa0aa199c1c6607147205be1fc0873a69f6959fcbdd6634561cfed7fbac51aa41ad2911f325e32f4b87e5a04dbd9580f81929fffe92f400"
+
+func lzmaTestData() []byte {
+	var b []byte
+	for i := 0; i < 300; i++ {
+		b = append(b, byte((i*37)^(i>>3)))
+	}
+	d := append(append(append([]byte{}, b...), "gap"...), b...)
+	d = append(d, bytes.Repeat([]byte("CHD hunk data "), 20)...)
+	return append(d, bytes.Repeat([]byte("abcabcabd"), 30)...)
+}
+
+func TestLZMADecode(t *testing.T) {
+	src, err := hex.DecodeString(lzmaTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lzmaTestData()
+	got := make([]byte, len(want))
+	if err := lzmaDecode(src, got); err != nil {
+		t.Fatalf("lzmaDecode() => err = %v; want nil", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("lzmaDecode() => %q; want %q", got, want)
+	}
+}
+
+// testSector returns a mode 1 sector with its P and Q parity.
+func testSector(n int) []byte {
+	s := make([]byte, chdSectorSize)
+	copy(s, cdSyncHeader)
+	s[12], s[13], s[14], s[15] = 0x00, 0x02, byte(n), 1
+	for i := 16; i < 16+2048; i++ {
+		s[i] = byte(i * (n + 1))
+	}
+	eccGenerate(s)
+	return s
+}
+
+func TestECCGenerate(t *testing.T) {
+	s := testSector(3)
+	// Each P and Q vector followed by its two parity bytes is a Reed-Solomon code
+	// word so both syndromes are zero.
+	check := func(name string, n int, off func(i int) int, p0, p1 int) {
+		var s0, s1 byte
+		for i := 0; i < n; i++ {
+			s0 ^= eccSource(s, off(i))
+			s1 = eccLow[s1^eccSource(s, off(i))]
+		}
+		s0 ^= s[p0] ^ s[p1]
+		s1 = eccLow[s1^s[p0]] ^ s[p1]
+		if s0 != 0 || s1 != 0 {
+			t.Errorf("eccGenerate() %s => syndromes %d, %d; want 0, 0", name, s0, s1)
+		}
+	}
+	for b := 0; b < eccPBytes; b++ {
+		check("P", eccPComp, func(i int) int { return b + eccPBytes*i }, eccPOffset+b, eccPOffset+eccPBytes+b)
+	}
+	for b := 0; b < eccQBytes; b++ {
+		check("Q", eccQComp, func(i int) int { return 2*((eccQComp*(b/2)+(eccQComp+1)*i)%(eccQComp*26)) + b&1 }, eccQOffset+b, eccQOffset+eccQBytes+b)
+	}
+}
+
+// bitWriter writes bits most significant first.
+type bitWriter struct {
+	b    []byte
+	bits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		if w.bits%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>(i-1)&1 != 1 {
+			w.bits++
+			continue
+		}
+		w.b[len(w.b)-1] |= 0x80 >> (w.bits % 8)
+		w.bits++
+	}
+}
+
+func deflate(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestCHDHash(t *testing.T) {
+	const (
+		frames       = 14
+		framesInHunk = 4
+		hunkBytes    = framesInHunk * chdFrameSize
+		hunks        = 4
+	)
+	// The .bin of the track and the frames of the CHD. The last hunk is a copy of
+	// the third and the track is padded to a multiple of 4 frames.
+	var bin []byte
+	var chdFrames [][]byte
+	for i := 0; i < hunks*framesInHunk; i++ {
+		var s []byte
+		switch {
+		case i >= 3*framesInHunk:
+			s = chdFrames[i-framesInHunk][:chdSectorSize]
+		case i%2 == 0:
+			s = testSector(i)
+		default:
+			s = bytes.Repeat([]byte{byte(i)}, chdSectorSize)
+		}
+		if i < frames {
+			bin = append(bin, s...)
+		}
+		f := make([]byte, chdFrameSize)
+		copy(f, s)
+		chdFrames = append(chdFrames, f)
+	}
+	hunk := func(i int) []byte {
+		return bytes.Join(chdFrames[i*framesInHunk:(i+1)*framesInHunk], nil)
+	}
+
+	// Hunk 0 uses cdzl with the sync header and ECC of the even frames removed,
+	// hunk 1 zlib, hunk 2 is stored and hunk 3 refers to hunk 2.
+	var sectors, subcodes []byte
+	ecc := byte(0)
+	for i := 0; i < framesInHunk; i++ {
+		s := append([]byte{}, chdFrames[i][:chdSectorSize]...)
+		if i%2 == 0 {
+			ecc |= 1 << uint(i)
+			copy(s, make([]byte, len(cdSyncHeader)))
+			copy(s[eccPOffset:], make([]byte, 2*(eccPBytes+eccQBytes)))
+		}
+		sectors = append(sectors, s...)
+		subcodes = append(subcodes, chdFrames[i][chdSectorSize:]...)
+	}
+	base := deflate(t, sectors)
+	cd := append([]byte{ecc, byte(len(base) >> 8), byte(len(base))}, base...)
+	cd = append(cd, deflate(t, subcodes)...)
+	zl := deflate(t, hunk(1))
+	data := append(append(append([]byte{}, cd...), zl...), hunk(2)...)
+
+	w := &bitWriter{}
+	for i := 0; i < chdHuffmanCodes; i++ {
+		w.write(4, 4)
+	}
+	for _, c := range []uint32{chdCompType0, chdCompType1, chdCompNone, chdCompSelf} {
+		w.write(c, 4)
+	}
+	w.write(uint32(len(cd)), 24)
+	w.write(0, 16)
+	w.write(uint32(len(zl)), 24)
+	w.write(0, 16)
+	w.write(0, 16)
+	w.write(2, 8)
+
+	track := []byte("TRACK:1 TYPE:MODE1_RAW SUBTYPE:NONE FRAMES:14 PREGAP:0 PGTYPE:MODE1 PGSUB:RW POSTGAP:0\x00")
+	mapOffset := chdV5Length
+	metaOffset := mapOffset + chdMapHeader + len(w.b)
+	dataOffset := metaOffset + chdMetaEntry + len(track)
+
+	h := make([]byte, chdV5Length)
+	copy(h, chdTag)
+	binary.BigEndian.PutUint32(h[8:12], chdV5Length)
+	binary.BigEndian.PutUint32(h[12:16], 5)
+	copy(h[16:], "cdzlzlib")
+	binary.BigEndian.PutUint64(h[32:40], hunks*hunkBytes)
+	binary.BigEndian.PutUint64(h[40:48], uint64(mapOffset))
+	binary.BigEndian.PutUint64(h[48:56], uint64(metaOffset))
+	binary.BigEndian.PutUint32(h[56:60], hunkBytes)
+	binary.BigEndian.PutUint32(h[60:64], chdFrameSize)
+	m := make([]byte, chdMapHeader)
+	binary.BigEndian.PutUint32(m[0:4], uint32(len(w.b)))
+	binary.BigEndian.PutUint32(m[6:10], uint32(dataOffset))
+	m[12], m[13] = 24, 8
+	meta := make([]byte, chdMetaEntry)
+	copy(meta, chdMetaCHT2)
+	meta[7] = byte(len(track))
+	var chd []byte
+	for _, b := range [][]byte{h, m, w.b, meta, track, data} {
+		chd = append(chd, b...)
+	}
+
+	dir, err := ioutil.TempDir("", "chd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	chdPath, binPath := filepath.Join(dir, "test.chd"), filepath.Join(dir, "test.bin")
+	if err := ioutil.WriteFile(chdPath, chd, 0664); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(binPath, bin, 0664); err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashAll(binPath, make([]byte, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := HashAll(chdPath, make([]byte, 1024))
+	if err != nil {
+		t.Fatalf("HashAll(%q) => err = %v; want nil", chdPath, err)
+	}
+	if got != want {
+		t.Errorf("HashAll(%q) => %+v; want %+v", chdPath, got, want)
+	}
+	d, err := openCHD(chdPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	b := make([]byte, 3000)
+	if _, err := d.ReadAt(b, 5000); err != nil {
+		t.Fatalf("ReadAt(5000) => err = %v; want nil", err)
+	}
+	if !bytes.Equal(b, bin[5000:8000]) {
+		t.Errorf("ReadAt(5000) doesn't match the .bin")
+	}
+}
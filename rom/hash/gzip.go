@@ -8,27 +8,29 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
-func decodeGZip(f string) (io.ReadCloser, error) {
+func decodeGZip(f string, get getter) (io.ReadCloser, string, error) {
 	file, err := os.Open(f)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer file.Close()
 	gzr, err := gzip.NewReader(file)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer gzr.Close()
-	ext := filepath.Ext(gzr.Header.Name)
-	if decoder, ok := getDecoder(ext); ok {
+	ext := strings.ToLower(filepath.Ext(gzr.Header.Name))
+	if decoder, ok := get(ext); ok {
 		d, err := ioutil.ReadAll(gzr)
 		if err != nil {
-			return nil, err
+			return nil, ext, err
 		}
 		r := bytes.NewReader(d)
-		return decoder(ioutil.NopCloser(r), int64(r.Len()))
+		rom, err := decoder(ioutil.NopCloser(r), int64(r.Len()))
+		return rom, ext, err
 	}
-	return nil, fmt.Errorf("No valid roms found in gzip.")
+	return nil, "", fmt.Errorf("No valid roms found in gzip.")
 }
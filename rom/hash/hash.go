@@ -2,9 +2,12 @@ package hash
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"os"
@@ -348,7 +351,7 @@ func getDecoder(ext string) (decoder, bool) {
 // KnownExt returns true if the ext is recognized.
 func KnownExt(ext string) bool {
 	ext = strings.ToLower(ext)
-	if ext == ".zip" || ext == ".gz" {
+	if ext == ".zip" || ext == ".gz" || ext == ".chd" {
 		return true
 	}
 	if ext == ".7z" && has7z {
@@ -358,46 +361,108 @@ func KnownExt(ext string) bool {
 	return ok
 }
 
-// decode takes a path and returns a reader for the inner rom data.
-func decode(p string) (io.ReadCloser, error) {
+// getter returns the decoder for an extension.
+type getter func(string) (decoder, bool)
+
+// rawDecoder is a getter that recognizes the same extensions as getDecoder
+// but leaves the data untouched.
+func rawDecoder(ext string) (decoder, bool) {
+	_, ok := getDecoder(ext)
+	return noop, ok
+}
+
+// decode takes a path and returns a reader for the inner rom data and the extension of the rom.
+func decode(p string, get getter) (io.ReadCloser, string, error) {
 	ext := strings.ToLower(path.Ext(p))
 	if ext == ".zip" {
-		return decodeZip(p)
+		return decodeZip(p, get)
 	}
 	if ext == ".gz" {
-		return decodeGZip(p)
+		return decodeGZip(p, get)
+	}
+	if ext == ".chd" {
+		d, err := openCHD(p)
+		return d, ext, err
 	}
 	if ext == ".7z" && has7z {
-		return decode7Zip(p)
+		return decode7Zip(p, get)
 	}
-	decode, _ := getDecoder(ext)
+	decode, _ := get(ext)
 	r, err := os.Open(p)
 	if err != nil {
-		return nil, err
+		return nil, ext, err
 	}
 	fi, err := r.Stat()
 	if err != nil {
-		return nil, err
+		return nil, ext, err
 	}
-	return decode(r, fi.Size())
+	d, err := decode(r, fi.Size())
+	return d, ext, err
 }
 
-// Hash returns the hash of a rom given a path to the file and hash function.
-func Hash(p string, h hash.Hash, buf []byte) (string, error) {
-	r, err := decode(p)
+// Open returns a reader for the rom data exactly as it is hashed along with the
+// extension of the rom. For archives the extension is the one of the rom inside.
+func Open(p string) (io.ReadCloser, string, error) {
+	return decode(p, getDecoder)
+}
+
+// OpenRaw is like Open but doesn't remove headers or fix the byte order of the rom.
+func OpenRaw(p string) (io.ReadCloser, string, error) {
+	return decode(p, rawDecoder)
+}
+
+// Digests are the common digests of a rom computed in a single pass.
+type Digests struct {
+	CRC32 string
+	MD5   string
+	SHA1  string
+	// Size is the size of the decoded rom data.
+	Size int64
+}
+
+// read decodes the rom at p and writes the rom data to w.
+func read(p string, w io.Writer, buf []byte) (int64, error) {
+	r, _, err := decode(p, getDecoder)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	defer r.Close()
+	var size int64
 	for {
 		n, err := r.Read(buf)
 		if err != nil && err != io.EOF {
-			return "", err
+			return size, err
 		}
 		if n == 0 {
 			break
 		}
-		h.Write(buf[:n])
+		w.Write(buf[:n])
+		size += int64(n)
+	}
+	return size, nil
+}
+
+// Hash returns the hash of a rom given a path to the file and hash function.
+func Hash(p string, h hash.Hash, buf []byte) (string, error) {
+	if _, err := read(p, h, buf); err != nil {
+		return "", err
 	}
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+// HashAll returns the CRC32, MD5 and SHA1 of a rom reading the file only once.
+// For a CHD of a CD the first track is hashed so it matches the .bin it was made
+// from, and for other CHDs all of the data.
+func HashAll(p string, buf []byte) (Digests, error) {
+	c, m, s := crc32.NewIEEE(), md5.New(), sha1.New()
+	size, err := read(p, io.MultiWriter(c, m, s), buf)
+	if err != nil {
+		return Digests{}, err
+	}
+	return Digests{
+		CRC32: hex.EncodeToString(c.Sum(nil)),
+		MD5:   hex.EncodeToString(m.Sum(nil)),
+		SHA1:  hex.EncodeToString(s.Sum(nil)),
+		Size:  size,
+	}, nil
+}
@@ -25,3 +25,30 @@ func TestSHA1(t *testing.T) {
 		}
 	}
 }
+
+func TestHashAll(t *testing.T) {
+	d, err := testdata.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	buf := make([]byte, 4*1024*1024)
+	for _, f := range d.Files {
+		got, err := HashAll(f.Path, buf)
+		if err != nil {
+			t.Errorf("HashAll(%q) => err = %v; want nil", f.Path, err)
+		} else if got.SHA1 != f.SHA1 {
+			t.Errorf("HashAll(%q).SHA1 => %q; want %q", f.Path, got.SHA1, f.SHA1)
+		}
+	}
+	p := filepath.Join(d.Dir, "test.bin")
+	want := Digests{
+		CRC32: "b2aa7578",
+		MD5:   "bf619eac0cdf3f68d496ea9344137e8b",
+		SHA1:  "5c3eb80066420002bc3dcc7ca4ab6efad7ed4ae5",
+		Size:  512,
+	}
+	if got, err := HashAll(p, buf); err != nil || got != want {
+		t.Errorf("HashAll(%q) => %+v, %v; want %+v, nil", p, got, err, want)
+	}
+}
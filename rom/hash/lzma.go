@@ -0,0 +1,279 @@
+package hash
+
+import "errors"
+
+// The LZMA decoder only supports what CHD uses: raw data without a header, with
+// lc=3, lp=0 and pb=2, decoded into a buffer of a known size.
+const (
+	lzmaLC              = 3
+	lzmaPB              = 2
+	lzmaStates          = 12
+	lzmaPosStates       = 1 << lzmaPB
+	lzmaProbInit        = 1024
+	lzmaLenToPosStates  = 4
+	lzmaEndPosModel     = 14
+	lzmaFullDistances   = 128
+	lzmaAlignBits       = 4
+	lzmaMatchMinLen     = 2
+	lzmaRangeTop        = 1 << 24
+	lzmaBitModelTotal   = 1 << 11
+	lzmaMoveBits        = 5
+	lzmaLiteralCoderLen = 0x300
+)
+
+var errLZMA = errors.New("lzma: corrupt data")
+
+type rangeDecoder struct {
+	src  []byte
+	pos  int
+	rng  uint32
+	code uint32
+}
+
+func (rc *rangeDecoder) next() uint32 {
+	if rc.pos >= len(rc.src) {
+		rc.pos++
+		return 0
+	}
+	b := rc.src[rc.pos]
+	rc.pos++
+	return uint32(b)
+}
+
+func (rc *rangeDecoder) init() {
+	rc.rng = 0xFFFFFFFF
+	rc.next()
+	for i := 0; i < 4; i++ {
+		rc.code = rc.code<<8 | rc.next()
+	}
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng < lzmaRangeTop {
+		rc.rng <<= 8
+		rc.code = rc.code<<8 | rc.next()
+	}
+}
+
+func (rc *rangeDecoder) bit(p *uint16) uint32 {
+	var b uint32
+	bound := (rc.rng >> 11) * uint32(*p)
+	if rc.code < bound {
+		rc.rng = bound
+		*p += (lzmaBitModelTotal - *p) >> lzmaMoveBits
+	} else {
+		rc.rng -= bound
+		rc.code -= bound
+		*p -= *p >> lzmaMoveBits
+		b = 1
+	}
+	rc.normalize()
+	return b
+}
+
+func (rc *rangeDecoder) direct(n uint) uint32 {
+	var res uint32
+	for ; n > 0; n-- {
+		rc.rng >>= 1
+		rc.code -= rc.rng
+		t := 0 - (rc.code >> 31)
+		rc.code += rc.rng & t
+		rc.normalize()
+		res = res<<1 + t + 1
+	}
+	return res
+}
+
+func (rc *rangeDecoder) tree(probs []uint16, bits uint) uint32 {
+	m := uint32(1)
+	for i := uint(0); i < bits; i++ {
+		m = m<<1 + rc.bit(&probs[m])
+	}
+	return m - 1<<bits
+}
+
+func (rc *rangeDecoder) reverseTree(probs []uint16, bits uint) uint32 {
+	m, sym := uint32(1), uint32(0)
+	for i := uint(0); i < bits; i++ {
+		b := rc.bit(&probs[m])
+		m = m<<1 + b
+		sym |= b << i
+	}
+	return sym
+}
+
+func newProbs(n int) []uint16 {
+	p := make([]uint16, n)
+	for i := range p {
+		p[i] = lzmaProbInit
+	}
+	return p
+}
+
+type lenDecoder struct {
+	choice []uint16
+	low    []uint16
+	mid    []uint16
+	high   []uint16
+}
+
+func newLenDecoder() *lenDecoder {
+	return &lenDecoder{
+		choice: newProbs(2),
+		low:    newProbs(lzmaPosStates << 3),
+		mid:    newProbs(lzmaPosStates << 3),
+		high:   newProbs(1 << 8),
+	}
+}
+
+func (l *lenDecoder) decode(rc *rangeDecoder, posState uint32) uint32 {
+	if rc.bit(&l.choice[0]) == 0 {
+		return rc.tree(l.low[posState<<3:], 3)
+	}
+	if rc.bit(&l.choice[1]) == 0 {
+		return 8 + rc.tree(l.mid[posState<<3:], 3)
+	}
+	return 16 + rc.tree(l.high, 8)
+}
+
+// lzmaDecode decodes src into dst until dst is full.
+func lzmaDecode(src, dst []byte) error {
+	rc := &rangeDecoder{src: src}
+	rc.init()
+	var (
+		lit       = newProbs(lzmaLiteralCoderLen << lzmaLC)
+		isMatch   = newProbs(lzmaStates << lzmaPB)
+		isRep     = newProbs(lzmaStates)
+		isRepG0   = newProbs(lzmaStates)
+		isRepG1   = newProbs(lzmaStates)
+		isRepG2   = newProbs(lzmaStates)
+		isRep0L   = newProbs(lzmaStates << lzmaPB)
+		posSlot   = newProbs(lzmaLenToPosStates << 6)
+		posProbs  = newProbs(1 + lzmaFullDistances - lzmaEndPosModel)
+		align     = newProbs(1 << lzmaAlignBits)
+		lenDec    = newLenDecoder()
+		repLenDec = newLenDecoder()
+		state     uint32
+		rep       [4]uint32
+		pos       int
+	)
+	for pos < len(dst) {
+		posState := uint32(pos) & (lzmaPosStates - 1)
+		if rc.bit(&isMatch[state<<lzmaPB+posState]) == 0 {
+			var prev uint32
+			if pos > 0 {
+				prev = uint32(dst[pos-1])
+			}
+			probs := lit[lzmaLiteralCoderLen*(prev>>(8-lzmaLC)):]
+			sym := uint32(1)
+			if state >= 7 {
+				if int(rep[0]) >= pos {
+					return errLZMA
+				}
+				match := uint32(dst[pos-int(rep[0])-1])
+				for sym < 0x100 {
+					mb := (match >> 7) & 1
+					match <<= 1
+					b := rc.bit(&probs[(1+mb)<<8+sym])
+					sym = sym<<1 | b
+					if mb != b {
+						break
+					}
+				}
+			}
+			for sym < 0x100 {
+				sym = sym<<1 | rc.bit(&probs[sym])
+			}
+			dst[pos] = byte(sym)
+			pos++
+			switch {
+			case state < 4:
+				state = 0
+			case state < 10:
+				state -= 3
+			default:
+				state -= 6
+			}
+			continue
+		}
+		var n uint32
+		if rc.bit(&isRep[state]) != 0 {
+			if pos == 0 {
+				return errLZMA
+			}
+			if rc.bit(&isRepG0[state]) == 0 {
+				if rc.bit(&isRep0L[state<<lzmaPB+posState]) == 0 {
+					if state < 7 {
+						state = 9
+					} else {
+						state = 11
+					}
+					dst[pos] = dst[pos-int(rep[0])-1]
+					pos++
+					continue
+				}
+			} else {
+				var dist uint32
+				if rc.bit(&isRepG1[state]) == 0 {
+					dist = rep[1]
+				} else {
+					if rc.bit(&isRepG2[state]) == 0 {
+						dist = rep[2]
+					} else {
+						dist = rep[3]
+						rep[3] = rep[2]
+					}
+					rep[2] = rep[1]
+				}
+				rep[1] = rep[0]
+				rep[0] = dist
+			}
+			n = repLenDec.decode(rc, posState)
+			if state < 7 {
+				state = 8
+			} else {
+				state = 11
+			}
+		} else {
+			rep[3], rep[2], rep[1] = rep[2], rep[1], rep[0]
+			n = lenDec.decode(rc, posState)
+			if state < 7 {
+				state = 7
+			} else {
+				state = 10
+			}
+			lenState := n
+			if lenState > lzmaLenToPosStates-1 {
+				lenState = lzmaLenToPosStates - 1
+			}
+			slot := rc.tree(posSlot[lenState<<6:], 6)
+			dist := slot
+			if slot >= 4 {
+				direct := uint(slot>>1) - 1
+				dist = (2 | slot&1) << direct
+				if slot < lzmaEndPosModel {
+					dist += rc.reverseTree(posProbs[dist-slot:], direct)
+				} else {
+					dist += rc.direct(direct-lzmaAlignBits) << lzmaAlignBits
+					dist += rc.reverseTree(align, lzmaAlignBits)
+				}
+			}
+			if dist == 0xFFFFFFFF {
+				// The end marker.
+				break
+			}
+			rep[0] = dist
+		}
+		if int(rep[0]) >= pos {
+			return errLZMA
+		}
+		for n += lzmaMatchMinLen; n > 0 && pos < len(dst); n-- {
+			dst[pos] = dst[pos-int(rep[0])-1]
+			pos++
+		}
+	}
+	if pos < len(dst) {
+		return errLZMA
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"strings"
 )
 
 type zipReader struct {
@@ -22,15 +23,15 @@ func (r zipReader) Close() error {
 	return r.f.Close()
 }
 
-func decodeZip(f string) (io.ReadCloser, error) {
+func decodeZip(f string, get getter) (io.ReadCloser, string, error) {
 	r, err := zip.OpenReader(f)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	var zr zipReader
 	for _, zf := range r.File {
-		ext := filepath.Ext(zf.FileHeader.Name)
-		if decoder, ok := getDecoder(ext); ok {
+		ext := strings.ToLower(filepath.Ext(zf.FileHeader.Name))
+		if decoder, ok := get(ext); ok {
 			rf, err := zf.Open()
 			if err != nil {
 				continue
@@ -41,8 +42,9 @@ func decodeZip(f string) (io.ReadCloser, error) {
 				continue
 			}
 			zr = zipReader{r, rom}
-			return zr, nil
+			return zr, ext, nil
 		}
 	}
-	return nil, fmt.Errorf("No valid roms found in zip.")
+	r.Close()
+	return nil, "", fmt.Errorf("No valid roms found in zip.")
 }
@@ -0,0 +1,271 @@
+package header
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sselph/scraper/internal/cuesheet"
+	rh "github.com/sselph/scraper/rom/hash"
+)
+
+const (
+	sectorSize    = 2048
+	rawSectorSize = 2352
+)
+
+// cdSync is the sync pattern at the start of every raw CD sector.
+var cdSync = []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+// track is the data track of a disc image.
+type track struct {
+	r io.ReaderAt
+	// size is the size of each sector in the file and offset is where the user data begins.
+	size, offset int64
+}
+
+// newTrack detects if the track is raw or only contains the user data.
+func newTrack(r io.ReaderAt) (*track, error) {
+	h := make([]byte, 16)
+	if _, err := r.ReadAt(h, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(h[:12], cdSync) {
+		return &track{r, sectorSize, 0}, nil
+	}
+	if h[15] == 2 {
+		return &track{r, rawSectorSize, 24}, nil
+	}
+	return &track{r, rawSectorSize, 16}, nil
+}
+
+// sector reads the user data of the sector.
+func (t *track) sector(lba int64) ([]byte, error) {
+	b := make([]byte, sectorSize)
+	_, err := t.r.ReadAt(b, lba*t.size+t.offset)
+	return b, err
+}
+
+// read reads n bytes of user data starting at the sector.
+func (t *track) read(lba, n int64) ([]byte, error) {
+	var b []byte
+	for ; int64(len(b)) < n; lba++ {
+		s, err := t.sector(lba)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, s...)
+	}
+	return b[:n], nil
+}
+
+// isRawCD returns true if the path is a plain file that starts with a raw CD sector.
+func isRawCD(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b := make([]byte, len(cdSync))
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false
+	}
+	return bytes.Equal(b, cdSync)
+}
+
+// IsDisc returns true if the path is a disc image whose header Read can find.
+func IsDisc(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".cue", ".gdi", ".iso", ".chd":
+		return true
+	case ".bin":
+		return isRawCD(p)
+	}
+	return false
+}
+
+// readDisc reads the header of the .cue, .gdi, .iso, .chd or .bin disc image at path p.
+func readDisc(p string) (*Info, error) {
+	if strings.ToLower(filepath.Ext(p)) == ".chd" {
+		r, _, err := rh.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		ra, ok := r.(io.ReaderAt)
+		if !ok {
+			return nil, ErrNoHeader
+		}
+		return readTrack(ra)
+	}
+	tp, err := cuesheet.DataTrack(p)
+	if err == cuesheet.ErrNoDataTrack {
+		return nil, ErrNoHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(tp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readTrack(f)
+}
+
+// readTrack reads the header of the data track of a disc.
+func readTrack(r io.ReaderAt) (*Info, error) {
+	t, err := newTrack(r)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := t.sector(0)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(ip, []byte("SEGA SEGASATURN")):
+		return parseSaturn(ip), nil
+	case bytes.HasPrefix(ip, []byte("SEGA SEGAKATANA")):
+		return parseDreamcast(ip), nil
+	case bytes.HasPrefix(ip, []byte("SEGADISCSYSTEM")):
+		info, err := parseMD(ip[:0x200])
+		if err != nil {
+			return nil, err
+		}
+		info.System = "segacd"
+		return info, nil
+	}
+	return parsePlayStation(t)
+}
+
+// segaRegions maps the area symbols of Saturn and Dreamcast discs to region codes.
+var segaRegions = map[byte]string{'J': "jp", 'T': "asi", 'U': "us", 'B': "br", 'K': "kr", 'A': "asi", 'E': "eu"}
+
+// segaArea converts the area symbols to a comma-separated list of region codes.
+func segaArea(b []byte) string {
+	var regions []string
+	seen := make(map[string]bool)
+	for _, c := range b {
+		if r, ok := segaRegions[c]; ok && !seen[r] {
+			seen[r] = true
+			regions = append(regions, r)
+		}
+	}
+	return strings.Join(regions, ",")
+}
+
+func parseSaturn(b []byte) *Info {
+	return &Info{
+		System:   "saturn",
+		Title:    clean(b[0x60:0xD0]),
+		Serial:   clean(b[0x20:0x2A]),
+		Revision: strings.TrimPrefix(clean(b[0x2A:0x30]), "V"),
+		Region:   segaArea(b[0x40:0x50]),
+	}
+}
+
+func parseDreamcast(b []byte) *Info {
+	return &Info{
+		System:   "dreamcast",
+		Title:    clean(b[0x80:0x100]),
+		Serial:   clean(b[0x40:0x4A]),
+		Revision: strings.TrimPrefix(clean(b[0x4A:0x50]), "V"),
+		Region:   segaArea(b[0x30:0x38]),
+	}
+}
+
+// dirRecord is an ISO 9660 directory record.
+type dirRecord struct {
+	name   string
+	extent int64
+	size   int64
+}
+
+// findFile finds the file in the root directory of the ISO 9660 filesystem.
+func findFile(t *track, name string) (*dirRecord, error) {
+	pvd, err := t.sector(16)
+	if err != nil {
+		return nil, err
+	}
+	if pvd[0] != 1 || !bytes.Equal(pvd[1:6], []byte("CD001")) {
+		return nil, ErrNoHeader
+	}
+	root := pvd[156:]
+	extent := int64(binary.LittleEndian.Uint32(root[2:6]))
+	size := int64(binary.LittleEndian.Uint32(root[10:14]))
+	dir, err := t.read(extent, size)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(dir); {
+		l := int(dir[i])
+		if l == 0 {
+			// Records don't cross sectors so skip to the next one.
+			i = (i/sectorSize + 1) * sectorSize
+			continue
+		}
+		if i+l > len(dir) || l < 34 {
+			break
+		}
+		r := dir[i : i+l]
+		if 33+int(r[32]) > l {
+			break
+		}
+		n := strings.ToUpper(string(r[33 : 33+int(r[32])]))
+		if strings.SplitN(n, ";", 2)[0] == name {
+			return &dirRecord{
+				name:   n,
+				extent: int64(binary.LittleEndian.Uint32(r[2:6])),
+				size:   int64(binary.LittleEndian.Uint32(r[10:14])),
+			}, nil
+		}
+		i += l
+	}
+	return nil, ErrNoHeader
+}
+
+// psSerial converts the boot executable, e.g. cdrom:\SLUS_005.94;1, to the serial SLUS-00594.
+func psSerial(boot string) string {
+	boot = boot[strings.LastIndexAny(boot, `:\/`)+1:]
+	boot = strings.SplitN(boot, ";", 2)[0]
+	boot = strings.Replace(boot, ".", "", -1)
+	return strings.ToUpper(strings.Replace(boot, "_", "-", -1))
+}
+
+func parsePlayStation(t *track) (*Info, error) {
+	rec, err := findFile(t, "SYSTEM.CNF")
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.read(rec.extent, rec.size)
+	if err != nil {
+		return nil, fmt.Errorf("can't read SYSTEM.CNF: %v", err)
+	}
+	info := &Info{}
+	for _, l := range strings.Split(string(b), "\n") {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch k {
+		case "BOOT":
+			info.System = "psx"
+			info.Serial = psSerial(v)
+		case "BOOT2":
+			info.System = "ps2"
+			info.Serial = psSerial(v)
+		case "VER":
+			info.Revision = v
+		}
+	}
+	if info.Serial == "" {
+		return nil, ErrNoHeader
+	}
+	return info, nil
+}
@@ -0,0 +1,264 @@
+// Package header reads the metadata stored in the internal header of a rom.
+package header
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	rh "github.com/sselph/scraper/rom/hash"
+)
+
+// ErrNoHeader is returned when the rom doesn't have a known header.
+var ErrNoHeader = errors.New("no known header")
+
+// Info is the metadata found in the header of a rom. Not all formats populate all values.
+type Info struct {
+	// System is only set for disc images, e.g. psx, ps2, saturn, segacd or dreamcast.
+	System string
+	Title  string
+	// Region is a comma-separated list of region codes, e.g. "us,eu".
+	Region   string
+	Serial   string
+	Revision string
+	Mapper   string
+	Save     string
+}
+
+// maxRead is the most data needed to find any of the supported headers.
+const maxRead = 0x10000
+
+// Read reads the header of the rom at path p. For .cue and .gdi files the header
+// is read from the data track and for .chd files from the first track.
+func Read(p string) (*Info, error) {
+	if IsDisc(p) {
+		return readDisc(p)
+	}
+	r, ext, err := rh.OpenRaw(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxRead))
+	if err != nil {
+		return nil, err
+	}
+	switch ext {
+	case ".nes":
+		return parseNES(b)
+	case ".lnx", ".lyx":
+		return parseLNX(b)
+	case ".a78":
+		return parseA78(b)
+	case ".n64", ".v64", ".z64":
+		return parseN64(b)
+	}
+	r, ext, err = rh.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err = ioutil.ReadAll(io.LimitReader(r, maxRead))
+	if err != nil {
+		return nil, err
+	}
+	switch ext {
+	case ".smc", ".sfc", ".fig", ".swc":
+		return parseSNES(b)
+	case ".gen", ".md", ".smd", ".mgd", ".bin":
+		return parseMD(b)
+	}
+	return nil, ErrNoHeader
+}
+
+// clean converts fixed width header text into a string removing padding and non-printable characters.
+func clean(b []byte) string {
+	s := strings.Map(func(r rune) rune {
+		if r < 32 || r > 126 {
+			return ' '
+		}
+		return r
+	}, string(b))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func parseNES(b []byte) (*Info, error) {
+	if len(b) < 16 || !bytes.Equal(b[:4], []byte("NES\x1a")) {
+		return nil, ErrNoHeader
+	}
+	info := &Info{}
+	mapper := int(b[6]>>4) | int(b[7]&0xF0)
+	pal := b[9]&1 == 1
+	if b[7]&12 == 8 {
+		mapper |= int(b[8]&0x0F) << 8
+		pal = b[12]&3 == 1
+	}
+	info.Mapper = strconv.Itoa(mapper)
+	if b[6]&2 == 2 {
+		info.Save = "battery"
+	}
+	if pal {
+		info.Region = "eu"
+	}
+	return info, nil
+}
+
+func parseLNX(b []byte) (*Info, error) {
+	if len(b) < 64 || !bytes.Equal(b[:4], []byte("LYNX")) {
+		return nil, ErrNoHeader
+	}
+	return &Info{Title: clean(b[10:42])}, nil
+}
+
+func parseA78(b []byte) (*Info, error) {
+	if len(b) < 128 || !bytes.Equal(b[1:10], []byte("ATARI7800")) {
+		return nil, ErrNoHeader
+	}
+	info := &Info{Title: clean(b[17:49])}
+	info.Mapper = fmt.Sprintf("%04x", binary.BigEndian.Uint16(b[53:55]))
+	if b[57]&1 == 1 {
+		info.Region = "eu"
+	} else {
+		info.Region = "us"
+	}
+	switch b[58] {
+	case 1:
+		info.Save = "hsc"
+	case 2:
+		info.Save = "savekey"
+	}
+	return info, nil
+}
+
+// snesRegions maps the SNES country code to region codes.
+var snesRegions = map[byte]string{
+	0x00: "jp", 0x01: "us", 0x02: "eu", 0x03: "se", 0x04: "fi", 0x05: "dk",
+	0x06: "fr", 0x07: "nl", 0x08: "sp", 0x09: "de", 0x0A: "it", 0x0B: "cn",
+	0x0D: "kr", 0x0F: "ca", 0x10: "br", 0x11: "au",
+}
+
+// snesScore scores how likely the offset is the SNES header.
+func snesScore(b []byte, o int) int {
+	if len(b) < o+0x40 {
+		return -1
+	}
+	score := 0
+	sum := binary.LittleEndian.Uint16(b[o+0x1E:])
+	comp := binary.LittleEndian.Uint16(b[o+0x1C:])
+	if sum^comp == 0xFFFF {
+		score += 4
+	}
+	if m := b[o+0x15] & 0x0F; (o == 0x7FC0 && m&1 == 0) || (o == 0xFFC0 && m&1 == 1) {
+		score += 2
+	}
+	for _, c := range b[o : o+21] {
+		if c < 32 || c > 126 {
+			score--
+		}
+	}
+	return score
+}
+
+func parseSNES(b []byte) (*Info, error) {
+	o := 0x7FC0
+	if snesScore(b, 0xFFC0) > snesScore(b, o) {
+		o = 0xFFC0
+	}
+	if snesScore(b, o) < 0 {
+		return nil, ErrNoHeader
+	}
+	h := b[o:]
+	info := &Info{Title: clean(h[:21])}
+	info.Mapper = fmt.Sprintf("%02x", h[0x15])
+	if h[0x18] > 0 {
+		switch h[0x16] & 0x0F {
+		case 0x02, 0x05, 0x06, 0x09, 0x0A:
+			info.Save = "battery"
+		default:
+			info.Save = "sram"
+		}
+	}
+	info.Region = snesRegions[h[0x19]]
+	info.Revision = strconv.Itoa(int(h[0x1B]))
+	if h[0x1A] == 0x33 {
+		info.Serial = clean(b[o-0x0E : o-0x0A])
+	}
+	return info, nil
+}
+
+// mdRegions maps the old style Genesis region characters to region codes.
+var mdRegions = map[byte]string{'J': "jp", 'U': "us", 'E': "eu"}
+
+func parseMD(b []byte) (*Info, error) {
+	if len(b) < 0x200 || !bytes.HasPrefix(b[0x100:], []byte("SEGA")) && !bytes.HasPrefix(b[0x101:], []byte("SEGA")) {
+		return nil, ErrNoHeader
+	}
+	info := &Info{Title: clean(b[0x150:0x180])}
+	if info.Title == "" {
+		info.Title = clean(b[0x120:0x150])
+	}
+	serial := clean(b[0x180:0x18E])
+	if i := strings.LastIndex(serial, "-"); i != -1 {
+		info.Revision = strings.TrimLeft(serial[i+1:], "0")
+		if info.Revision == "" {
+			info.Revision = "0"
+		}
+		serial = serial[:i]
+	}
+	info.Serial = serial
+	if bytes.Equal(b[0x1B0:0x1B2], []byte("RA")) {
+		info.Save = "sram"
+	}
+	var regions []string
+	for _, c := range bytes.TrimSpace(b[0x1F0:0x1F3]) {
+		if r, ok := mdRegions[c]; ok {
+			regions = append(regions, r)
+		}
+	}
+	info.Region = strings.Join(regions, ",")
+	return info, nil
+}
+
+// n64Regions maps the last character of the N64 game code to region codes.
+var n64Regions = map[byte]string{
+	'A': "wor", 'B': "br", 'C': "cn", 'D': "de", 'E': "us", 'F': "fr",
+	'I': "it", 'J': "jp", 'K': "kr", 'P': "eu", 'S': "sp", 'U': "au",
+	'X': "eu", 'Y': "eu",
+}
+
+// toZ64 converts the N64 rom data to big-endian z64 order in place.
+func toZ64(b []byte) {
+	switch {
+	case b[1] == 0x80:
+		for i := 0; i+4 <= len(b); i += 4 {
+			b[i], b[i+1], b[i+2], b[i+3] = b[i+1], b[i], b[i+3], b[i+2]
+		}
+	case b[3] == 0x80:
+		for i := 0; i+4 <= len(b); i += 4 {
+			b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+		}
+	}
+}
+
+func parseN64(b []byte) (*Info, error) {
+	if len(b) < 0x40 {
+		return nil, ErrNoHeader
+	}
+	toZ64(b)
+	if b[0] != 0x80 {
+		return nil, ErrNoHeader
+	}
+	info := &Info{Title: clean(b[0x20:0x34])}
+	code := clean(b[0x3B:0x3F])
+	info.Serial = code
+	if len(code) == 4 {
+		info.Region = n64Regions[code[3]]
+	}
+	info.Revision = strconv.Itoa(int(b[0x3F]))
+	return info, nil
+}
@@ -0,0 +1,223 @@
+package header
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func nesROM() []byte {
+	b := make([]byte, 16+16*1024)
+	copy(b, "NES\x1a")
+	b[4] = 1
+	b[6] = 0x12
+	b[7] = 0x00
+	b[9] = 1
+	return b
+}
+
+func snesROM() []byte {
+	b := make([]byte, 0x8000)
+	h := b[0x7FC0:]
+	copy(h, "SUPER GAME           ")
+	h[0x15] = 0x20
+	h[0x16] = 0x02
+	h[0x18] = 0x03
+	h[0x19] = 0x01
+	h[0x1A] = 0x33
+	h[0x1B] = 0x01
+	h[0x1C], h[0x1D] = 0xFF, 0xFF
+	copy(b[0x7FB0:], "01AGME")
+	return b
+}
+
+func mdROM() []byte {
+	b := make([]byte, 0x4000)
+	for i := 0x100; i < 0x200; i++ {
+		b[i] = ' '
+	}
+	copy(b[0x100:], "SEGA MEGA DRIVE")
+	copy(b[0x120:], "DOMESTIC GAME")
+	copy(b[0x150:], "OVERSEAS  GAME")
+	copy(b[0x180:], "GM 00001009-01")
+	copy(b[0x1B0:], "RA")
+	copy(b[0x1F0:], "JUE")
+	return b
+}
+
+func v64ROM() []byte {
+	b := n64ROM()
+	for i := 0; i < len(b); i += 2 {
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+	return b
+}
+
+func n64ROM() []byte {
+	b := make([]byte, 0x1000)
+	copy(b, []byte{0x80, 0x37, 0x12, 0x40})
+	copy(b[0x20:], "SUPER N64 GAME      ")
+	copy(b[0x3B:], "NSME")
+	b[0x3F] = 2
+	return b
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want *Info
+	}{
+		{"game.nes", nesROM(), &Info{Region: "eu", Mapper: "1", Save: "battery"}},
+		{"game.sfc", snesROM(), &Info{Title: "SUPER GAME", Region: "us", Serial: "AGME", Revision: "1", Mapper: "20", Save: "battery"}},
+		{"game.md", mdROM(), &Info{Title: "OVERSEAS GAME", Region: "jp,us,eu", Serial: "GM 00001009", Revision: "1", Save: "sram"}},
+		{"game.z64", n64ROM(), &Info{Title: "SUPER N64 GAME", Region: "us", Serial: "NSME", Revision: "2"}},
+		{"game.v64", v64ROM(), &Info{Title: "SUPER N64 GAME", Region: "us", Serial: "NSME", Revision: "2"}},
+	} {
+		p := filepath.Join(dir, tc.name)
+		if err := ioutil.WriteFile(p, tc.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(p)
+		if err != nil {
+			t.Errorf("Read(%q) => err = %v; want nil", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Read(%q) => %+v; want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadNoHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "game.gb")
+	if err := ioutil.WriteFile(p, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(p); err != ErrNoHeader {
+		t.Errorf("Read(%q) => err = %v; want %v", p, err, ErrNoHeader)
+	}
+}
+
+// isoImage creates a 2048 byte sector ISO 9660 image with SYSTEM.CNF in the root directory.
+func isoImage(cnf string) []byte {
+	b := make([]byte, 20*sectorSize)
+	pvd := b[16*sectorSize:]
+	pvd[0] = 1
+	copy(pvd[1:], "CD001")
+	root := pvd[156:]
+	root[0] = 34
+	binary.LittleEndian.PutUint32(root[2:], 18)
+	binary.LittleEndian.PutUint32(root[10:], sectorSize)
+	dir := b[18*sectorSize:]
+	name := "SYSTEM.CNF;1"
+	dir[0] = byte(33 + len(name))
+	binary.LittleEndian.PutUint32(dir[2:], 19)
+	binary.LittleEndian.PutUint32(dir[10:], uint32(len(cnf)))
+	dir[32] = byte(len(name))
+	copy(dir[33:], name)
+	copy(b[19*sectorSize:], cnf)
+	return b
+}
+
+// rawImage converts a 2048 byte sector image into a raw MODE1/2352 image.
+func rawImage(b []byte) []byte {
+	var out []byte
+	for i := 0; i < len(b); i += sectorSize {
+		s := make([]byte, rawSectorSize)
+		copy(s, cdSync)
+		s[15] = 1
+		copy(s[16:], b[i:i+sectorSize])
+		out = append(out, s...)
+	}
+	return out
+}
+
+func saturnIP() []byte {
+	b := make([]byte, sectorSize)
+	for i := 0; i < 0x100; i++ {
+		b[i] = ' '
+	}
+	copy(b, "SEGA SEGASATURN ")
+	copy(b[0x20:], "MK-81014")
+	copy(b[0x2A:], "V1.001")
+	copy(b[0x40:], "JTUE")
+	copy(b[0x60:], "SATURN GAME")
+	return b
+}
+
+func TestReadDisc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"ps1.iso":        isoImage("BOOT = cdrom:\\SLUS_005.94;1\r\nTCB = 4\r\nVER = 1.00\r\n"),
+		"ps2.iso":        isoImage("BOOT2 = cdrom0:\\SLES_500.03;1\nVER = 1.01\n"),
+		"saturn (1).bin": rawImage(saturnIP()),
+		"saturn.cue":     []byte("FILE \"saturn (1).bin\" BINARY\n  TRACK 01 MODE1/2352\n    INDEX 01 00:00:00\n"),
+		"dc.gdi":         []byte("3\n1 0 4 2352 track01.bin 0\n2 450 0 2352 track02.raw 0\n3 45000 4 2352 \"track 03.bin\" 0\n"),
+	}
+	dc := saturnIP()
+	copy(dc, "SEGA SEGAKATANA ")
+	copy(dc[0x30:], "JUE     ")
+	copy(dc[0x40:], "MK-51000  V1.002")
+	copy(dc[0x80:], "DREAMCAST GAME")
+	files["track 03.bin"] = rawImage(dc)
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		want *Info
+	}{
+		{"ps1.iso", &Info{System: "psx", Serial: "SLUS-00594", Revision: "1.00"}},
+		{"ps2.iso", &Info{System: "ps2", Serial: "SLES-50003", Revision: "1.01"}},
+		{"saturn.cue", &Info{System: "saturn", Title: "SATURN GAME", Serial: "MK-81014", Revision: "1.001", Region: "jp,asi,us,eu"}},
+		{"saturn (1).bin", &Info{System: "saturn", Title: "SATURN GAME", Serial: "MK-81014", Revision: "1.001", Region: "jp,asi,us,eu"}},
+		{"dc.gdi", &Info{System: "dreamcast", Title: "DREAMCAST GAME", Serial: "MK-51000", Revision: "1.002", Region: "jp,us,eu"}},
+	} {
+		got, err := Read(filepath.Join(dir, tc.name))
+		if err != nil {
+			t.Errorf("Read(%q) => err = %v; want nil", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Read(%q) => %+v; want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadBadRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b := isoImage("BOOT = cdrom:\\SLUS_005.94;1\r\n")
+	// The name is longer than the record.
+	b[18*sectorSize+32] = 200
+	p := filepath.Join(dir, "bad.iso")
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(p); err != ErrNoHeader {
+		t.Errorf("Read(%q) => err = %v; want %v", p, err, ErrNoHeader)
+	}
+}
@@ -0,0 +1,176 @@
+package rom
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// launchBoxPlatforms maps the platform names of es_systems.cfg to LaunchBox platform names.
+var launchBoxPlatforms = map[string]string{
+	"3do":             "3DO Interactive Multiplayer",
+	"amiga":           "Commodore Amiga",
+	"amstradcpc":      "Amstrad CPC",
+	"arcade":          "Arcade",
+	"atari2600":       "Atari 2600",
+	"atari5200":       "Atari 5200",
+	"atari7800":       "Atari 7800",
+	"atarijaguar":     "Atari Jaguar",
+	"atarilynx":       "Atari Lynx",
+	"atarist":         "Atari ST",
+	"c64":             "Commodore 64",
+	"coleco":          "ColecoVision",
+	"colecovision":    "ColecoVision",
+	"dreamcast":       "Sega Dreamcast",
+	"fds":             "Nintendo Famicom Disk System",
+	"gamegear":        "Sega Game Gear",
+	"gb":              "Nintendo Game Boy",
+	"gba":             "Nintendo Game Boy Advance",
+	"gbc":             "Nintendo Game Boy Color",
+	"genesis":         "Sega Genesis",
+	"intellivision":   "Mattel Intellivision",
+	"mame":            "Arcade",
+	"mastersystem":    "Sega Master System",
+	"megadrive":       "Sega Genesis",
+	"msx":             "Microsoft MSX",
+	"n64":             "Nintendo 64",
+	"nds":             "Nintendo DS",
+	"neogeo":          "SNK Neo Geo AES",
+	"nes":             "Nintendo Entertainment System",
+	"ngp":             "SNK Neo Geo Pocket",
+	"ngpc":            "SNK Neo Geo Pocket Color",
+	"pcengine":        "NEC TurboGrafx-16",
+	"pcenginecd":      "NEC TurboGrafx-CD",
+	"ps2":             "Sony Playstation 2",
+	"psp":             "Sony PSP",
+	"psx":             "Sony Playstation",
+	"saturn":          "Sega Saturn",
+	"scummvm":         "ScummVM",
+	"sega32x":         "Sega 32X",
+	"segacd":          "Sega CD",
+	"sg-1000":         "Sega SG-1000",
+	"snes":            "Super Nintendo Entertainment System",
+	"tg16":            "NEC TurboGrafx-16",
+	"tg-cd":           "NEC TurboGrafx-CD",
+	"vectrex":         "GCE Vectrex",
+	"virtualboy":      "Nintendo Virtual Boy",
+	"wonderswan":      "WonderSwan",
+	"wonderswancolor": "WonderSwan Color",
+	"zxspectrum":      "Sinclair ZX Spectrum",
+}
+
+// LaunchBoxPlatform returns the LaunchBox platform name for the es_systems.cfg platform.
+func LaunchBoxPlatform(platform string) (string, bool) {
+	n, ok := launchBoxPlatforms[strings.ToLower(platform)]
+	return n, ok
+}
+
+// LaunchBox is the platform XML format of LaunchBox.
+type LaunchBox struct {
+	// Platform is the name of the LaunchBox platform, e.g. "Nintendo Entertainment System".
+	Platform string
+	// Dir is the LaunchBox directory. If empty, the platform XML is written next to the roms.
+	Dir string
+	// Opts are the options used to create the game list. They are needed to find local files.
+	Opts *XMLOpts
+}
+
+type launchBoxGame struct {
+	ID              string `xml:"ID"`
+	Title           string `xml:"Title"`
+	ApplicationPath string `xml:"ApplicationPath"`
+	Platform        string `xml:"Platform"`
+	Developer       string `xml:"Developer,omitempty"`
+	Publisher       string `xml:"Publisher,omitempty"`
+	ReleaseDate     string `xml:"ReleaseDate,omitempty"`
+	Genre           string `xml:"Genre,omitempty"`
+	Notes           string `xml:"Notes,omitempty"`
+	MaxPlayers      string `xml:"MaxPlayers,omitempty"`
+	Region          string `xml:"Region,omitempty"`
+	CloneOf         string `xml:"CloneOf,omitempty"`
+}
+
+type launchBoxXML struct {
+	XMLName xml.Name        `xml:"LaunchBox"`
+	Games   []launchBoxGame `xml:"Game"`
+}
+
+// launchBoxID creates a stable GUID for the game from its path.
+func launchBoxID(p string) string {
+	h := md5.Sum([]byte(p))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// Encode implements Format.
+func (lb LaunchBox) Encode(w io.Writer, gl *GameListXML) error {
+	out := launchBoxXML{}
+	for _, g := range gl.GameList {
+		p := absPath(lb.Opts, g.Path)
+		lg := launchBoxGame{
+			ID:              launchBoxID(p),
+			Title:           g.GameTitle,
+			ApplicationPath: filepath.FromSlash(p),
+			Platform:        lb.Platform,
+			Developer:       g.Developer,
+			Publisher:       g.Publisher,
+			Genre:           g.Genre,
+			Notes:           g.Overview,
+			MaxPlayers:      g.Players,
+			Region:          g.Region,
+			CloneOf:         g.CloneOf,
+		}
+		if t, err := time.Parse("20060102T150405", g.ReleaseDate); err == nil {
+			lg.ReleaseDate = t.Format("2006-01-02T15:04:05")
+		}
+		out.Games = append(out.Games, lg)
+	}
+	output, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(output)
+	return err
+}
+
+// Decode implements Format.
+func (lb LaunchBox) Decode(r io.Reader, gl *GameListXML) error {
+	var in launchBoxXML
+	if err := xml.NewDecoder(r).Decode(&in); err != nil {
+		return err
+	}
+	for _, lg := range in.Games {
+		g := &GameXML{
+			Path:      relPath(lb.Opts, lg.ApplicationPath),
+			GameTitle: lg.Title,
+			Developer: lg.Developer,
+			Publisher: lg.Publisher,
+			Genre:     lg.Genre,
+			Overview:  lg.Notes,
+			Players:   lg.MaxPlayers,
+			Region:    lg.Region,
+			CloneOf:   lg.CloneOf,
+		}
+		if len(lg.ReleaseDate) >= 10 {
+			if t, err := time.Parse("2006-01-02", lg.ReleaseDate[:10]); err == nil {
+				g.ReleaseDate = t.Format("20060102T000000")
+			}
+		}
+		gl.Append(g)
+	}
+	return nil
+}
+
+// FileName implements Format.
+func (lb LaunchBox) FileName() string {
+	if lb.Dir == "" {
+		return lb.Platform + ".xml"
+	}
+	return filepath.Join(lb.Dir, "Data", "Platforms", lb.Platform+".xml")
+}
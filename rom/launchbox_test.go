@@ -0,0 +1,44 @@
+package rom
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLaunchBox(t *testing.T) {
+	romDir, err := filepath.Abs("testroms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb := LaunchBox{Platform: "Arcade", Opts: &XMLOpts{RomDir: romDir, RomXMLDir: "."}}
+	gl := &GameListXML{}
+	gl.Append(&GameXML{
+		Path:        "./sf2j.zip",
+		GameTitle:   "Street Fighter II: The World Warrior",
+		Overview:    "A fighting game.",
+		CloneOf:     "sf2",
+		ReleaseDate: "19910522T000000",
+		Developer:   "Capcom",
+		Publisher:   "Capcom",
+		Genre:       "Fighting",
+		Players:     "2",
+	})
+	var buf bytes.Buffer
+	if err := lb.Encode(&buf, gl); err != nil {
+		t.Fatalf("Encode() => err = %v; want nil", err)
+	}
+	for _, s := range []string{"<ReleaseDate>1991-05-22T00:00:00</ReleaseDate>", "<CloneOf>sf2</CloneOf>", "<Platform>Arcade</Platform>"} {
+		if !bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Errorf("Encode() => %s; want %s", buf.String(), s)
+		}
+	}
+	got := &GameListXML{}
+	if err := lb.Decode(&buf, got); err != nil {
+		t.Fatalf("Decode() => err = %v; want nil", err)
+	}
+	if !reflect.DeepEqual(got, gl) {
+		t.Errorf("Decode() => %+v; want %+v", got.GameList[0], gl.GameList[0])
+	}
+}
@@ -0,0 +1,223 @@
+package rom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sselph/scraper/ds"
+)
+
+// pegasusAssets maps image types to the asset names used by Pegasus.
+var pegasusAssets = map[ds.ImgType]string{
+	ds.ImgBoxart:    "boxFront",
+	ds.ImgBoxart3D:  "boxFront",
+	ds.ImgScreen:    "screenshot",
+	ds.ImgTitle:     "titlescreen",
+	ds.ImgFanart:    "background",
+	ds.ImgBanner:    "banner",
+	ds.ImgLogo:      "logo",
+	ds.ImgMarquee:   "marquee",
+	ds.ImgCabinet:   "cabinetLeft",
+	ds.ImgFlyer:     "poster",
+	ds.ImgCart:      "cartridge",
+	ds.ImgCartLabel: "cartridge",
+}
+
+// PegasusAsset returns the Pegasus asset name for the image type. Image types without
+// a matching asset, like the mixes, are used as the front of the box.
+func PegasusAsset(t ds.ImgType) string {
+	if a, ok := pegasusAssets[t]; ok {
+		return a
+	}
+	return "boxFront"
+}
+
+// Pegasus is the metadata.pegasus.txt format of Pegasus Frontend.
+type Pegasus struct {
+	// Collection is the name of the collection listing all the games. If empty, no collection is written.
+	Collection string
+	// ImageAsset is the asset the image of a game is used as. The default is boxFront.
+	ImageAsset string
+}
+
+func (p Pegasus) imageAsset() string {
+	if p.ImageAsset == "" {
+		return "boxFront"
+	}
+	return p.ImageAsset
+}
+
+// pegasusDate converts a gamelist date to the YYYY-MM-DD used by Pegasus.
+func pegasusDate(d string) string {
+	t, err := time.Parse("20060102T150405", d)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// writeValue writes a key and value. Values with multiple lines are indented on
+// the following lines and empty lines are replaced with a dot.
+func writeValue(w *bufio.Writer, k, v string) {
+	if v == "" {
+		return
+	}
+	if !strings.ContainsRune(v, '\n') {
+		fmt.Fprintf(w, "%s: %s\n", k, v)
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", k)
+	for _, l := range strings.Split(v, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			l = "."
+		}
+		fmt.Fprintf(w, "  %s\n", l)
+	}
+}
+
+// Encode implements Format.
+func (p Pegasus) Encode(w io.Writer, gl *GameListXML) error {
+	bw := bufio.NewWriter(w)
+	if p.Collection != "" {
+		writeValue(bw, "collection", p.Collection)
+		var files []string
+		for _, g := range gl.GameList {
+			files = append(files, g.Path)
+		}
+		writeValue(bw, "files", strings.Join(files, "\n"))
+	}
+	for _, g := range gl.GameList {
+		bw.WriteString("\n")
+		writeValue(bw, "game", g.GameTitle)
+		writeValue(bw, "file", g.Path)
+		writeValue(bw, "developer", g.Developer)
+		writeValue(bw, "publisher", g.Publisher)
+		writeValue(bw, "genre", g.Genre)
+		writeValue(bw, "players", g.Players)
+		writeValue(bw, "release", pegasusDate(g.ReleaseDate))
+		if g.Rating > 0 {
+			writeValue(bw, "rating", fmt.Sprintf("%.0f%%", g.Rating*100))
+		}
+		writeValue(bw, "description", g.Overview)
+		writeValue(bw, "assets."+p.imageAsset(), g.Image)
+		writeValue(bw, "assets.video", g.Video)
+		writeValue(bw, "assets.marquee", g.Marquee)
+		writeValue(bw, "x-id", g.ID)
+		writeValue(bw, "x-source", g.Source)
+		writeValue(bw, "x-fuzzy", g.Fuzzy)
+		writeValue(bw, "x-cloneof", g.CloneOf)
+		writeValue(bw, "x-region", g.Region)
+		writeValue(bw, "x-lang", g.Lang)
+	}
+	return bw.Flush()
+}
+
+// set sets the value of a Pegasus key on the game.
+func (p Pegasus) set(g *GameXML, k, v string) {
+	switch k {
+	case "file", "files":
+		if g.Path == "" {
+			g.Path = strings.SplitN(v, "\n", 2)[0]
+		}
+	case "developer":
+		g.Developer = v
+	case "publisher":
+		g.Publisher = v
+	case "genre":
+		g.Genre = v
+	case "players":
+		g.Players = v
+	case "release":
+		for _, f := range []string{"2006-01-02", "2006-01", "2006"} {
+			if t, err := time.Parse(f, v); err == nil {
+				g.ReleaseDate = t.Format("20060102T000000")
+				break
+			}
+		}
+	case "rating":
+		if r, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64); err == nil {
+			g.Rating = r / 100
+		}
+	case "description":
+		g.Overview = v
+	case "assets." + p.imageAsset():
+		g.Image = v
+	case "assets.video":
+		g.Video = v
+	case "assets.marquee":
+		g.Marquee = v
+	case "x-id":
+		g.ID = v
+	case "x-source":
+		g.Source = v
+	case "x-fuzzy":
+		g.Fuzzy = v
+	case "x-cloneof":
+		g.CloneOf = v
+	case "x-region":
+		g.Region = v
+	case "x-lang":
+		g.Lang = v
+	}
+}
+
+// Decode implements Format. Only game entries are read, collections are ignored.
+func (p Pegasus) Decode(r io.Reader, gl *GameListXML) error {
+	var g *GameXML
+	var k string
+	var vals []string
+	flush := func() {
+		if g != nil && k != "" {
+			p.set(g, k, strings.TrimSpace(strings.Join(vals, "\n")))
+		}
+		k, vals = "", nil
+	}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := s.Text()
+		switch {
+		case strings.HasPrefix(l, "#"):
+			continue
+		case strings.TrimSpace(l) == "":
+			continue
+		case l[0] == ' ' || l[0] == '\t':
+			if v := strings.TrimSpace(l); v != "." {
+				vals = append(vals, v)
+			} else {
+				vals = append(vals, "")
+			}
+			continue
+		}
+		flush()
+		kv := strings.SplitN(l, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("pegasus: invalid line %q", l)
+		}
+		k = strings.TrimSpace(kv[0])
+		v := strings.TrimSpace(kv[1])
+		switch k {
+		case "game":
+			g = &GameXML{GameTitle: v}
+			gl.Append(g)
+			k = ""
+			continue
+		case "collection":
+			g = nil
+		}
+		if v != "" {
+			vals = append(vals, v)
+		}
+	}
+	flush()
+	return s.Err()
+}
+
+// FileName implements Format.
+func (Pegasus) FileName() string {
+	return "metadata.pegasus.txt"
+}
@@ -0,0 +1,72 @@
+package rom
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const testPegasus = `collection: nes
+files:
+  ./smb.nes
+  ./zelda.nes
+
+game: Super Mario Bros.
+file: ./smb.nes
+developer: Nintendo
+publisher: Nintendo
+players: 2
+release: 1985-09-13
+rating: 80%
+description:
+  Line one.
+  .
+  Line two.
+assets.screenshot: ./images/smb-image.jpg
+assets.video: ./images/smb-video.mp4
+x-id: 1
+x-source: theGamesDB.net
+
+game: The Legend of Zelda
+file: ./zelda.nes
+description: Single line.
+`
+
+func TestPegasus(t *testing.T) {
+	p := Pegasus{Collection: "nes", ImageAsset: "screenshot"}
+	want := []*GameXML{
+		{
+			ID:          "1",
+			Source:      "theGamesDB.net",
+			Path:        "./smb.nes",
+			GameTitle:   "Super Mario Bros.",
+			Overview:    "Line one.\n\nLine two.",
+			Image:       "./images/smb-image.jpg",
+			Rating:      0.8,
+			ReleaseDate: "19850913T000000",
+			Developer:   "Nintendo",
+			Publisher:   "Nintendo",
+			Players:     "2",
+			Video:       "./images/smb-video.mp4",
+		},
+		{
+			Path:      "./zelda.nes",
+			GameTitle: "The Legend of Zelda",
+			Overview:  "Single line.",
+		},
+	}
+	gl := &GameListXML{}
+	if err := p.Decode(bytes.NewBufferString(testPegasus), gl); err != nil {
+		t.Fatalf("Decode() => err = %v; want nil", err)
+	}
+	if !reflect.DeepEqual(gl.GameList, want) {
+		t.Errorf("Decode() => %+v; want %+v", gl.GameList, want)
+	}
+	var buf bytes.Buffer
+	if err := p.Encode(&buf, gl); err != nil {
+		t.Fatalf("Encode() => err = %v; want nil", err)
+	}
+	if got := buf.String(); got != testPegasus {
+		t.Errorf("Encode() => %q; want %q", got, testPegasus)
+	}
+}
@@ -0,0 +1,163 @@
+package rom
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/sselph/scraper/ds"
+)
+
+// ProvenanceFile returns the path of the file storing the provenance of the games
+// in the output file.
+func ProvenanceFile(output string) string {
+	return output + ".provenance.json"
+}
+
+// elements are the elements returned by scraped in the order of the game list.
+var elements = []string{"name", "desc", "image", "thumbnail", "rating", "releasedate", "developer", "publisher", "genre", "players", "marquee", "video", "cloneof", "region", "lang"}
+
+// scraped returns pointers to the elements of the game that are set by scraping.
+func (g *GameXML) scraped() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        &g.GameTitle,
+		"desc":        &g.Overview,
+		"image":       &g.Image,
+		"thumbnail":   &g.Thumb,
+		"rating":      &g.Rating,
+		"releasedate": &g.ReleaseDate,
+		"developer":   &g.Developer,
+		"publisher":   &g.Publisher,
+		"genre":       &g.Genre,
+		"players":     &g.Players,
+		"marquee":     &g.Marquee,
+		"video":       &g.Video,
+		"cloneof":     &g.CloneOf,
+		"region":      &g.Region,
+		"lang":        &g.Lang,
+	}
+}
+
+// value returns the element returned by scraped as a string.
+func value(v interface{}) string {
+	switch v := v.(type) {
+	case *string:
+		return *v
+	case *float64:
+		if *v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// setValue sets the element returned by scraped to the element of another game.
+func setValue(dst, src interface{}) {
+	switch dst := dst.(type) {
+	case *string:
+		*dst = *src.(*string)
+	case *float64:
+		*dst = *src.(*float64)
+	}
+}
+
+func sum(v string) string {
+	s := sha1.Sum([]byte(v))
+	return hex.EncodeToString(s[:8])
+}
+
+// WriteProvenance writes the provenance of the games to w as JSON keyed by path. Each
+// value's checksum is recorded so values changed after scraping can be found.
+func WriteProvenance(w io.Writer, gl *GameListXML) error {
+	out := make(map[string]map[string]ds.Provenance)
+	for _, g := range gl.GameList {
+		values := g.scraped()
+		m := make(map[string]ds.Provenance)
+		for f, p := range g.Provenance {
+			v := value(values[f])
+			if v == "" {
+				continue
+			}
+			p.Sum = sum(v)
+			m[f] = p
+		}
+		if len(m) > 0 {
+			out[g.Path] = m
+		}
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// ReadProvenance reads the provenance written by WriteProvenance into the games
+// with the same path.
+func ReadProvenance(r io.Reader, gl *GameListXML) error {
+	var in map[string]map[string]ds.Provenance
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return err
+	}
+	for _, g := range gl.GameList {
+		if p, ok := in[g.Path]; ok {
+			g.Provenance = p
+		}
+	}
+	return nil
+}
+
+// Refresh keeps the values of old, the game in the list before refreshing, that the
+// scraped game shouldn't overwrite: values changed or added after old was scraped,
+// values the scraped game doesn't have and values found by an exact match when the
+// scraped game wasn't. Changed and added values are also locked. Values the scraped
+// game has without provenance, like media already on disk, keep the provenance of
+// old. If old has no provenance every value is overwritten.
+func (g *GameXML) Refresh(old *GameXML) {
+	if len(old.Provenance) == 0 {
+		return
+	}
+	if g.Provenance == nil {
+		g.Provenance = make(map[string]ds.Provenance)
+	}
+	values, ovs := g.scraped(), old.scraped()
+	for _, f := range elements {
+		ov := ovs[f]
+		v := value(ov)
+		if v == "" {
+			continue
+		}
+		p, hasOld := old.Provenance[f]
+		// A value without provenance is only an edit if the scraped game doesn't have
+		// it too, like an image already on disk that is reused.
+		edited := hasOld && p.Sum != sum(v) || !hasOld && value(values[f]) != v
+		np, ok := g.Provenance[f]
+		if !ok && !edited && value(values[f]) == v {
+			// The reused value keeps its provenance.
+			if hasOld {
+				g.Provenance[f] = p
+			}
+			continue
+		}
+		switch {
+		case edited:
+		case value(values[f]) == "":
+		case p.Exact() && !(ok && np.Exact()):
+		default:
+			continue
+		}
+		setValue(values[f], ov)
+		if edited {
+			// The value was changed by hand so it has no provenance and later
+			// refreshes keep it even without the provenance file.
+			delete(g.Provenance, f)
+			g.lock(f)
+		} else {
+			g.Provenance[f] = p
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package rom
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sselph/scraper/ds"
+)
+
+func TestProvenanceRoundTrip(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := ds.Provenance{Source: "ss", ID: "1", Match: ds.MatchSHA1, Time: now}
+	gl := &GameListXML{GameList: []*GameXML{
+		{Path: "./a.nes", GameTitle: "A", Rating: 0.5, Provenance: map[string]ds.Provenance{"name": p, "rating": p, "desc": p}},
+		{Path: "./b.nes", GameTitle: "B"},
+	}}
+	var b bytes.Buffer
+	if err := WriteProvenance(&b, gl); err != nil {
+		t.Fatalf("WriteProvenance() => err = %v; want nil", err)
+	}
+	read := &GameListXML{GameList: []*GameXML{{Path: "./a.nes"}, {Path: "./b.nes"}}}
+	if err := ReadProvenance(&b, read); err != nil {
+		t.Fatalf("ReadProvenance() => err = %v; want nil", err)
+	}
+	got := read.GameList[0].Provenance
+	if len(got) != 2 || got["name"].Sum != sum("A") || got["rating"].Sum != sum("0.5") || got["name"].Source != "ss" {
+		t.Errorf("ReadProvenance() => %v; want name and rating from ss with sums", got)
+	}
+	if read.GameList[1].Provenance != nil {
+		t.Errorf("ReadProvenance() => %v for a game without provenance; want nil", read.GameList[1].Provenance)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	exact := ds.Provenance{Source: "gdb", Match: ds.MatchSHA1}
+	fuzzy := ds.Provenance{Source: "ss", Match: ds.MatchFuzzy}
+	withSum := func(p ds.Provenance, v string) ds.Provenance {
+		p.Sum = sum(v)
+		return p
+	}
+	old := &GameXML{
+		GameTitle:   "Edited Name",
+		Overview:    "Old desc",
+		Developer:   "Old developer",
+		Genre:       "Added genre",
+		Publisher:   "Old publisher",
+		ReleaseDate: "19900101T000000",
+		Image:       "./images/a.png",
+		Marquee:     "./images/a-marquee.png",
+		Provenance: map[string]ds.Provenance{
+			"image":       withSum(fuzzy, "./images/a.png"),
+			"name":        withSum(exact, "Scraped Name"),
+			"desc":        withSum(exact, "Old desc"),
+			"developer":   withSum(exact, "Old developer"),
+			"publisher":   withSum(exact, "Old publisher"),
+			"releasedate": withSum(exact, "19900101T000000"),
+		},
+	}
+	g := &GameXML{
+		GameTitle:   "New Name",
+		Overview:    "New desc",
+		Developer:   "Fuzzy developer",
+		Genre:       "New genre",
+		ReleaseDate: "19910101T000000",
+		Image:       "./images/a.png",
+		Marquee:     "./images/a-marquee.png",
+		Provenance: map[string]ds.Provenance{
+			"name":        exact,
+			"desc":        exact,
+			"developer":   fuzzy,
+			"genre":       exact,
+			"releasedate": exact,
+		},
+	}
+	g.Refresh(old)
+	want := &GameXML{
+		Lock:        "name,genre",
+		GameTitle:   "Edited Name",
+		Overview:    "New desc",
+		Developer:   "Old developer",
+		Genre:       "Added genre",
+		Publisher:   "Old publisher",
+		ReleaseDate: "19910101T000000",
+		Image:       "./images/a.png",
+		Marquee:     "./images/a-marquee.png",
+		Provenance: map[string]ds.Provenance{
+			"image":       withSum(fuzzy, "./images/a.png"),
+			"desc":        exact,
+			"developer":   withSum(exact, "Old developer"),
+			"publisher":   withSum(exact, "Old publisher"),
+			"releasedate": exact,
+		},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("Refresh() => %+v; want %+v", g, want)
+	}
+
+	// Without provenance everything is overwritten.
+	g = &GameXML{GameTitle: "New Name"}
+	g.Refresh(&GameXML{GameTitle: "Old Name"})
+	if g.GameTitle != "New Name" {
+		t.Errorf("Refresh() without provenance => %q; want %q", g.GameTitle, "New Name")
+	}
+}
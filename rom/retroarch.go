@@ -0,0 +1,257 @@
+package rom
+
+import (
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sselph/scraper/ds"
+	"github.com/sselph/scraper/internal/cuesheet"
+)
+
+// retroArchPlaylists maps the platform names of es_systems.cfg to RetroArch playlist names.
+var retroArchPlaylists = map[string]string{
+	"3do":             "The 3DO Company - 3DO",
+	"amiga":           "Commodore - Amiga",
+	"amstradcpc":      "Amstrad - CPC",
+	"arcade":          "MAME",
+	"atari2600":       "Atari - 2600",
+	"atari5200":       "Atari - 5200",
+	"atari7800":       "Atari - 7800",
+	"atarijaguar":     "Atari - Jaguar",
+	"atarilynx":       "Atari - Lynx",
+	"atarist":         "Atari - ST",
+	"c64":             "Commodore - 64",
+	"coleco":          "Coleco - ColecoVision",
+	"colecovision":    "Coleco - ColecoVision",
+	"dreamcast":       "Sega - Dreamcast",
+	"fds":             "Nintendo - Family Computer Disk System",
+	"gamegear":        "Sega - Game Gear",
+	"gb":              "Nintendo - Game Boy",
+	"gba":             "Nintendo - Game Boy Advance",
+	"gbc":             "Nintendo - Game Boy Color",
+	"genesis":         "Sega - Mega Drive - Genesis",
+	"intellivision":   "Mattel - Intellivision",
+	"mame":            "MAME",
+	"mastersystem":    "Sega - Master System - Mark III",
+	"megadrive":       "Sega - Mega Drive - Genesis",
+	"msx":             "Microsoft - MSX",
+	"msx2":            "Microsoft - MSX2",
+	"n64":             "Nintendo - Nintendo 64",
+	"nds":             "Nintendo - Nintendo DS",
+	"neogeo":          "SNK - Neo Geo",
+	"nes":             "Nintendo - Nintendo Entertainment System",
+	"ngp":             "SNK - Neo Geo Pocket",
+	"ngpc":            "SNK - Neo Geo Pocket Color",
+	"pcengine":        "NEC - PC Engine - TurboGrafx 16",
+	"pcenginecd":      "NEC - PC Engine CD - TurboGrafx-CD",
+	"pokemini":        "Nintendo - Pokemon Mini",
+	"ps2":             "Sony - PlayStation 2",
+	"psp":             "Sony - PlayStation Portable",
+	"psx":             "Sony - PlayStation",
+	"saturn":          "Sega - Saturn",
+	"scummvm":         "ScummVM",
+	"sega32x":         "Sega - 32X",
+	"segacd":          "Sega - Mega-CD - Sega CD",
+	"sg-1000":         "Sega - SG-1000",
+	"snes":            "Nintendo - Super Nintendo Entertainment System",
+	"supergrafx":      "NEC - PC Engine SuperGrafx",
+	"tg16":            "NEC - PC Engine - TurboGrafx 16",
+	"tg-cd":           "NEC - PC Engine CD - TurboGrafx-CD",
+	"vectrex":         "GCE - Vectrex",
+	"virtualboy":      "Nintendo - Virtual Boy",
+	"wonderswan":      "Bandai - WonderSwan",
+	"wonderswancolor": "Bandai - WonderSwan Color",
+	"zxspectrum":      "Sinclair - ZX Spectrum +3",
+}
+
+// RetroArchPlaylist returns the RetroArch playlist name for the es_systems.cfg platform.
+func RetroArchPlaylist(platform string) (string, bool) {
+	n, ok := retroArchPlaylists[strings.ToLower(platform)]
+	return n, ok
+}
+
+// retroArchThumbs maps image types to the RetroArch thumbnail directories.
+var retroArchThumbs = map[ds.ImgType]string{
+	ds.ImgBoxart:   "Named_Boxarts",
+	ds.ImgBoxart3D: "Named_Boxarts",
+	ds.ImgScreen:   "Named_Snaps",
+	ds.ImgTitle:    "Named_Titles",
+}
+
+// RetroArchThumbDir returns the RetroArch thumbnail directory for the image type. Image
+// types without a matching directory are used as box art.
+func RetroArchThumbDir(t ds.ImgType) string {
+	if d, ok := retroArchThumbs[t]; ok {
+		return d
+	}
+	return "Named_Boxarts"
+}
+
+// retroArchName replaces the characters RetroArch doesn't allow in thumbnail names.
+func retroArchName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("&*/:`<>?\\|", r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// RetroArch is the JSON .lpl playlist format of RetroArch.
+type RetroArch struct {
+	// Name is the name of the playlist and its database, e.g. "Nintendo - Nintendo Entertainment System".
+	Name string
+	// Dir is the RetroArch directory with the playlists and thumbnails directories.
+	// If empty, the playlist is written next to the roms and thumbnails aren't copied.
+	Dir string
+	// Opts are the options used to create the game list. They are needed to find local files.
+	Opts *XMLOpts
+	// Hasher is used to get the CRC32 of each rom when it is scraped. If nil the CRC32 is
+	// detected by RetroArch.
+	Hasher *ds.Hasher
+	// ThumbDir is the thumbnail directory the image of a game is copied to. The default is Named_Boxarts.
+	ThumbDir string
+}
+
+type retroArchItem struct {
+	Path     string `json:"path"`
+	Label    string `json:"label"`
+	CorePath string `json:"core_path"`
+	CoreName string `json:"core_name"`
+	CRC32    string `json:"crc32"`
+	DBName   string `json:"db_name"`
+}
+
+type retroArchLPL struct {
+	Version            string          `json:"version"`
+	DefaultCorePath    string          `json:"default_core_path"`
+	DefaultCoreName    string          `json:"default_core_name"`
+	LabelDisplayMode   int             `json:"label_display_mode"`
+	RightThumbnailMode int             `json:"right_thumbnail_mode"`
+	LeftThumbnailMode  int             `json:"left_thumbnail_mode"`
+	SortMode           int             `json:"sort_mode"`
+	Items              []retroArchItem `json:"items"`
+}
+
+// copyThumb copies the image to the thumbnail directory converting it to PNG if needed.
+// An existing thumbnail isn't replaced.
+func (ra RetroArch) copyThumb(g *GameXML) error {
+	src := localPath(ra.Opts.ImgXMLDir, ra.Opts.ImgDir, g.Image)
+	dir := ra.ThumbDir
+	if dir == "" {
+		dir = "Named_Boxarts"
+	}
+	dir = filepath.Join(ra.Dir, "thumbnails", ra.Name, dir)
+	if err := mkDir(dir); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, retroArchName(g.GameTitle)+".png")
+	if exists(dst) {
+		return nil
+	}
+	if strings.ToLower(filepath.Ext(src)) == ".png" {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// crcPath returns the path of the file the CRC32 of the rom is computed from. For a
+// .m3u it is the first disc and for a .cue or .gdi the data track.
+func crcPath(r *ROM) (string, error) {
+	if r.Ext == ".m3u" {
+		if len(r.Discs) == 0 {
+			return "", cuesheet.ErrNoDataTrack
+		}
+		r = r.Discs[0]
+	}
+	return cuesheet.DataTrack(r.Path)
+}
+
+// WriteGame implements GameWriter. If Hasher is set, the CRC32 of the rom is stored in
+// the game. If Dir is set, the image of the game is copied into the thumbnails directory.
+func (ra RetroArch) WriteGame(r *ROM, g *GameXML) error {
+	if ra.Hasher != nil {
+		if p, err := crcPath(r); err == nil {
+			if d, err := ra.Hasher.Digests(p); err == nil && d.CRC32 != "" {
+				g.CRC32 = strings.ToUpper(d.CRC32)
+			}
+		}
+	}
+	if ra.Dir == "" || g.Image == "" {
+		return nil
+	}
+	return ra.copyThumb(g)
+}
+
+// Encode implements Format.
+func (ra RetroArch) Encode(w io.Writer, gl *GameListXML) error {
+	lpl := retroArchLPL{Version: "1.5", Items: []retroArchItem{}}
+	for _, g := range gl.GameList {
+		item := retroArchItem{
+			Path:     absPath(ra.Opts, g.Path),
+			Label:    g.GameTitle,
+			CorePath: "DETECT",
+			CoreName: "DETECT",
+			CRC32:    "DETECT",
+			DBName:   ra.Name + ".lpl",
+		}
+		if g.CRC32 != "" {
+			item.CRC32 = g.CRC32 + "|crc"
+		}
+		lpl.Items = append(lpl.Items, item)
+	}
+	b, err := json.MarshalIndent(lpl, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Decode implements Format. Only the path, label and CRC32 of each item are read.
+func (ra RetroArch) Decode(r io.Reader, gl *GameListXML) error {
+	var lpl retroArchLPL
+	if err := json.NewDecoder(r).Decode(&lpl); err != nil {
+		return err
+	}
+	for _, item := range lpl.Items {
+		g := &GameXML{Path: relPath(ra.Opts, item.Path), GameTitle: item.Label}
+		if strings.HasSuffix(item.CRC32, "|crc") {
+			g.CRC32 = strings.TrimSuffix(item.CRC32, "|crc")
+		}
+		gl.Append(g)
+	}
+	return nil
+}
+
+// FileName implements Format.
+func (ra RetroArch) FileName() string {
+	if ra.Dir == "" {
+		return ra.Name + ".lpl"
+	}
+	return filepath.Join(ra.Dir, "playlists", ra.Name+".lpl")
+}
@@ -0,0 +1,136 @@
+package rom
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sselph/scraper/ds"
+)
+
+func TestRetroArchName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Super Mario Bros.", "Super Mario Bros."},
+		{"Zelda: A Link to the Past", "Zelda_ A Link to the Past"},
+		{"Tom & Jerry / Who?", "Tom _ Jerry _ Who_"},
+	}
+	for _, tt := range tests {
+		if got := retroArchName(tt.in); got != tt.want {
+			t.Errorf("retroArchName(%q) = %q want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRetroArch(t *testing.T) {
+	romDir, err := filepath.Abs("testroms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := RetroArch{Name: "Nintendo - Nintendo Entertainment System", Opts: &XMLOpts{RomDir: romDir, RomXMLDir: "."}}
+	gl := &GameListXML{}
+	gl.Append(&GameXML{Path: "./smb.nes", GameTitle: "Super Mario Bros.", CRC32: "3337EC46"})
+	gl.Append(&GameXML{Path: "./zelda.nes", GameTitle: "Zelda"})
+	var buf bytes.Buffer
+	if err := ra.Encode(&buf, gl); err != nil {
+		t.Fatalf("Encode() => err = %v; want nil", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"db_name": "Nintendo - Nintendo Entertainment System.lpl"`)) {
+		t.Errorf("Encode() => %s; want db_name", buf.String())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"crc32": "3337EC46|crc"`)) || !bytes.Contains(buf.Bytes(), []byte(`"crc32": "DETECT"`)) {
+		t.Errorf("Encode() => %s; want the stored crc32 and DETECT", buf.String())
+	}
+	got := &GameListXML{}
+	if err := ra.Decode(&buf, got); err != nil {
+		t.Fatalf("Decode() => err = %v; want nil", err)
+	}
+	if !reflect.DeepEqual(got, gl) {
+		t.Errorf("Decode() => %+v; want %+v", got.GameList, gl.GameList)
+	}
+}
+
+func TestRetroArchWriteGame(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retroarch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "smb.png"), img.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ra := RetroArch{Name: "Nintendo - Nintendo Entertainment System", Dir: dir, Opts: &XMLOpts{ImgDir: dir, ImgXMLDir: "."}}
+	r := &ROM{Path: filepath.Join(dir, "smb.nes"), Ext: ".nes"}
+	if err := ra.WriteGame(r, &GameXML{GameTitle: "Super Mario Bros.", Image: "./smb.png"}); err != nil {
+		t.Fatalf("WriteGame() => err = %v; want nil", err)
+	}
+	thumb := filepath.Join(dir, "thumbnails", ra.Name, "Named_Boxarts", "Super Mario Bros..png")
+	if !exists(thumb) {
+		t.Errorf("WriteGame() didn't copy the image to %s", thumb)
+	}
+	if err := ra.WriteGame(r, &GameXML{GameTitle: "Zelda", Image: "./zelda.png"}); err == nil {
+		t.Errorf("WriteGame() with a missing image => err = nil; want an error")
+	}
+	if err := ra.WriteGame(r, &GameXML{GameTitle: "Super Mario Bros.", Image: "./zelda.png"}); err != nil {
+		t.Errorf("WriteGame() with an existing thumbnail => err = %v; want nil", err)
+	}
+}
+
+func TestRetroArchWriteGameCRC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retroarch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"game.cue":           "FILE \"game (Track 1).bin\" BINARY\n  TRACK 01 MODE1/2352\n    INDEX 01 00:00:00\nFILE \"game (Track 2).bin\" BINARY\n  TRACK 02 AUDIO\n    INDEX 01 00:00:00\n",
+		"game (Track 1).bin": "data track",
+		"game (Track 2).bin": "audio track",
+		"game.m3u":           "game.cue\n",
+		"pitfall.a26":        "atari rom",
+	}
+	for n, s := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, n), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hasher, err := ds.NewHasher(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crc := func(s string) string {
+		return fmt.Sprintf("%08X", crc32.ChecksumIEEE([]byte(s)))
+	}
+	cue := &ROM{Path: filepath.Join(dir, "game.cue"), Ext: ".cue"}
+	tests := []struct {
+		r    *ROM
+		want string
+	}{
+		{&ROM{Path: filepath.Join(dir, "pitfall.a26"), Ext: ".a26"}, crc("atari rom")},
+		{cue, crc("data track")},
+		{&ROM{Path: filepath.Join(dir, "game.m3u"), Ext: ".m3u", Discs: []*ROM{cue}}, crc("data track")},
+		{&ROM{Path: filepath.Join(dir, "missing.nes"), Ext: ".nes"}, ""},
+	}
+	ra := RetroArch{Name: "Sony - PlayStation", Opts: &XMLOpts{}, Hasher: hasher}
+	for _, tt := range tests {
+		g := &GameXML{}
+		if err := ra.WriteGame(tt.r, g); err != nil {
+			t.Errorf("WriteGame(%s) => err = %v; want nil", tt.r.Path, err)
+		}
+		if g.CRC32 != tt.want {
+			t.Errorf("WriteGame(%s) => CRC32 = %q; want %q", tt.r.Path, g.CRC32, tt.want)
+		}
+	}
+}
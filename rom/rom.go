@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
@@ -12,10 +13,12 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"unicode"
-	"unicode/utf8"
+	"time"
 
+	"github.com/sselph/scraper/cache"
 	"github.com/sselph/scraper/ds"
+	"github.com/sselph/scraper/internal/cuesheet"
+	"github.com/sselph/scraper/naming"
 )
 
 var lock chan struct{}
@@ -45,10 +48,22 @@ type GameOpts struct {
 	NoPrettyName bool
 	// UseFilename instructs the scraper to use the filename minus extension as the xml name.
 	UseFilename bool
+	// NameTags are the tags of the filename added to the game title, ie the region
+	// and revision.
+	NameTags []naming.Tag
 	// NoStripUnicode instructs the scraper to not strip out unicode characters.
 	NoStripUnicode bool
 	// OverviewLen is the max length allowed for a overview. 0 means no limit.
 	OverviewLen int
+	// Merge instructs the scraper to query the sources until no field can change and
+	// merge the games found instead of using the first one.
+	Merge bool
+	// Priority is the order of the sources for each field when merging.
+	Priority ds.Priority
+	// MergeImages and MergeVideos are the types that have to be found before the
+	// sources left aren't queried.
+	MergeImages []ds.ImgType
+	MergeVideos []ds.VidType
 }
 
 // XMLOpts represents the options for creating XML information.
@@ -89,6 +104,11 @@ type XMLOpts struct {
 	MarqDir      string
 	MarqXMLDir   string
 	MarqFormat   string
+	// Media is the cache of downloaded images and videos. If nil, nothing is cached.
+	Media *cache.Media
+	// DryRun instructs the scraper to set the paths of the images and videos that
+	// would be downloaded without downloading them.
+	DryRun bool
 }
 
 // stripChars strips out unicode and converts "fancy" quotes to normal quotes.
@@ -117,42 +137,6 @@ func stripCharsForFilename(r rune) rune {
 	return -1
 }
 
-// scanWords is a split function for a Scanner that returns each
-// space-separated word of text, with surrounding spaces deleted. It will
-// never return an empty string. The definition of space is set by
-// unicode.IsSpace.
-func scanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	// Skip leading spaces.
-	start := 0
-	for width := 0; start < len(data); start += width {
-		var r rune
-		r, width = utf8.DecodeRune(data[start:])
-		if !unicode.IsSpace(r) {
-			break
-		}
-	}
-	quote := false
-	// Scan until space, marking end of word.
-	for width, i := 0, start; i < len(data); i += width {
-		var r rune
-		r, width = utf8.DecodeRune(data[i:])
-		switch {
-		case i == 0 && r == '"':
-			quote = true
-		case !quote && unicode.IsSpace(r):
-			return i + width, data[start:i], nil
-		case quote && r == '"':
-			return i + width, data[start+width : i], nil
-		}
-	}
-	// If we're at EOF, we have a final, non-empty, non-terminated word. Return it.
-	if atEOF && len(data) > start {
-		return len(data), data[start:], nil
-	}
-	// Request more data.
-	return start, nil, nil
-}
-
 // ROM stores information about the ROM.
 type ROM struct {
 	Path     	string
@@ -163,8 +147,10 @@ type ROM struct {
 	Ext      	string
 	Bins     	[]string
 	Cue      	bool
+	Discs    	[]*ROM
 	Game     	*ds.Game
 	NotFound 	bool
+	Group    	*DiscGroup
 }
 
 // populatePaths populates all the relative path information from the full path.
@@ -174,7 +160,8 @@ func (r *ROM) populatePaths() {
 	r.BaseName = r.FileName[:len(r.FileName)-len(r.Ext)]
 }
 
-// populateBins populates .bin information for .cue or .gdi files.
+// populateBins populates .bin information for .cue or .gdi files and
+// the disc information for .m3u files.
 func (r *ROM) populateBins() error {
 	f, err := os.Open(r.Path)
 	if err != nil {
@@ -189,7 +176,7 @@ func (r *ROM) populateBins() error {
 		}
 		for s.Scan() {
 			w := bufio.NewScanner(strings.NewReader(s.Text()))
-			w.Split(scanWords)
+			w.Split(cuesheet.ScanWords)
 			for i := 0; i < 5; i++ {
 				if !w.Scan() {
 					return fmt.Errorf("bad gdi")
@@ -204,7 +191,7 @@ func (r *ROM) populateBins() error {
 	case r.Ext == ".cue":
 		for s.Scan() {
 			w := bufio.NewScanner(strings.NewReader(s.Text()))
-			w.Split(scanWords)
+			w.Split(cuesheet.ScanWords)
 			if !w.Scan() {
 				continue
 			}
@@ -221,33 +208,166 @@ func (r *ROM) populateBins() error {
 				r.Bins = append(r.Bins, p)
 			}
 		}
+	case r.Ext == ".m3u":
+		for s.Scan() {
+			disc := strings.TrimSpace(s.Text())
+			if disc == "" || strings.HasPrefix(disc, "#") {
+				continue
+			}
+			p := filepath.FromSlash(disc)
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(r.Dir, p)
+			}
+			if !exists(p) {
+				continue
+			}
+			d, err := NewROM(p)
+			if err != nil {
+				return err
+			}
+			r.Discs = append(r.Discs, d)
+			r.Bins = append(r.Bins, p)
+			r.Bins = append(r.Bins, d.Bins...)
+		}
 	}
 	return nil
 }
 
+// discGame attempts to identify the whole disc, or for a .m3u any of the discs,
+// from all of its tracks using sources that implement ds.DiscDS.
+func (r *ROM) discGame(ctx context.Context, data []ds.DS) *ds.Game {
+	discs := r.Discs
+	if r.Ext != ".m3u" {
+		discs = []*ROM{r}
+	}
+	for _, disc := range discs {
+		if len(disc.Bins) == 0 || len(disc.Discs) != 0 {
+			continue
+		}
+		for _, source := range data {
+			dd, ok := source.(ds.DiscDS)
+			if !ok {
+				continue
+			}
+			if game, err := dd.GetDiscGame(ctx, disc.Bins); err == nil {
+				game.Record(ds.SourceName(source), time.Now())
+				return game
+			}
+		}
+	}
+	return nil
+}
+
+// mergeGame queries each source in order until the sources left can't change the
+// merged game and returns it with the pretty name of the first source that found it.
+func (r *ROM) mergeGame(ctx context.Context, data []ds.DS, files []string, opts *GameOpts) (*ds.Game, string, error) {
+	names := make([]string, len(data))
+	for i, source := range data {
+		names[i] = ds.SourceName(source)
+	}
+	var found []ds.Found
+	var prettyName string
+	var quota bool
+	err := ds.ErrNotFound
+	for i, source := range data {
+		if len(found) > 0 && opts.Priority.Complete(found, names[i:], opts.MergeImages, opts.MergeVideos) {
+			break
+		}
+		var game *ds.Game
+		if r.Cue {
+			game = r.discGame(ctx, []ds.DS{source})
+		}
+		for _, file := range files {
+			if game != nil {
+				break
+			}
+			name := source.GetName(file)
+			var gerr error
+			game, gerr = source.GetGame(ctx, file)
+			if gerr != nil {
+				quota = quota || gerr == ds.ErrQuota
+				// An error of a source isn't hidden by the sources after it not finding the game.
+				if gerr != ds.ErrNotFound {
+					err = gerr
+				}
+				continue
+			}
+			if prettyName == "" {
+				prettyName = name
+			}
+		}
+		if game != nil {
+			game.Record(names[i], time.Now())
+			found = append(found, ds.Found{Source: names[i], Game: game})
+		}
+	}
+	if len(found) == 0 {
+		if quota {
+			return nil, "", ds.ErrQuota
+		}
+		return nil, "", err
+	}
+	return opts.Priority.Merge(found), prettyName, nil
+}
+
 // GetGame attempts to populates the Game from data sources in oder.
 func (r *ROM) GetGame(ctx context.Context, data []ds.DS, opts *GameOpts) error {
 	if opts == nil {
 		opts = &GameOpts{}
 	}
 	var err error
+	var quota bool
 	var prettyName string
 	var game *ds.Game
 	files := []string{r.Path}
 	if r.Cue {
 		files = append(files, r.Bins...)
 	}
+	if opts.Merge {
+		game, prettyName, err = r.mergeGame(ctx, data, files, opts)
+		files = nil
+	} else if r.Cue {
+		if game = r.discGame(ctx, data); game != nil {
+			files = nil
+		}
+	}
 Loop:
 	for _, file := range files {
 		for _, source := range data {
 			prettyName = source.GetName(file)
 			game, err = source.GetGame(ctx, file)
 			if err != nil {
+				quota = quota || err == ds.ErrQuota
 				continue
 			}
+			game.Record(ds.SourceName(source), time.Now())
 			break Loop
 		}
 	}
+	if game == nil {
+		// Searching by name is only done once for the ROM instead of for every file.
+		for _, source := range data {
+			sr, ok := source.(ds.Searcher)
+			if !ok {
+				continue
+			}
+			g, serr := sr.SearchGame(ctx, r.Path)
+			if serr != nil {
+				quota = quota || serr == ds.ErrQuota
+				if serr != ds.ErrNotFound || err == nil {
+					err = serr
+				}
+				continue
+			}
+			g.Record(ds.SourceName(source), time.Now())
+			game, err = g, nil
+			break
+		}
+	}
+	if game == nil && quota {
+		// A source that couldn't be used might find it in a later run.
+		err = ds.ErrQuota
+	}
 	if game == nil {
 		if err == ds.ErrNotFound {
 			r.NotFound = true
@@ -260,9 +380,16 @@ Loop:
 	r.CleanName = strings.Map(stripCharsForFilename, game.GameTitle)
 	if !opts.NoPrettyName && prettyName != "" {
 		game.GameTitle = prettyName
+		// The No-Intro name has its own tags.
+		if len(opts.NameTags) > 0 {
+			game.GameTitle = naming.Parse(prettyName).Title
+		}
 	}
 	if opts.UseFilename {
 		game.GameTitle = r.BaseName
+		delete(game.Provenance, ds.FieldName)
+	} else if len(opts.NameTags) > 0 {
+		game.GameTitle += naming.Parse(r.BaseName).Tags(opts.NameTags...)
 	}
 	if !opts.NoStripUnicode {
 		game.Overview = strings.Map(stripChars, game.Overview)
@@ -279,7 +406,7 @@ Loop:
 func NewROM(p string) (*ROM, error) {
 	r := &ROM{Path: p}
 	r.populatePaths()
-	r.Cue = r.Ext == ".cue" || r.Ext == ".gdi"
+	r.Cue = r.Ext == ".cue" || r.Ext == ".gdi" || r.Ext == ".m3u"
 	if r.Cue {
 		if err := r.populateBins(); err != nil {
 			return nil, err
@@ -352,7 +479,7 @@ func mkDir(d string) error {
 	return fmt.Errorf("%s is a file not a directory", d)
 }
 
-func getVideo(ctx context.Context, dsVid ds.Video, p string) error {
+func getVideo(ctx context.Context, dsVid ds.Video, p string, m *cache.Media) error {
 	dir := filepath.Dir(p)
 	if !imgDirs[dir] {
 		err := mkDir(dir)
@@ -361,11 +488,36 @@ func getVideo(ctx context.Context, dsVid ds.Video, p string) error {
 		}
 		imgDirs[dir] = true
 	}
-	return dsVid.Save(ctx, p)
+	key := ds.CacheKey(dsVid, 0, 0)
+	if ok, err := getCached(m, key, p); ok || err != nil {
+		return err
+	}
+	if err := dsVid.Save(ctx, p); err != nil {
+		return err
+	}
+	putCached(m, key, p)
+	return nil
+}
+
+// getCached creates p from the media cache. It returns false if it isn't cached.
+func getCached(m *cache.Media, key, p string) (bool, error) {
+	if m == nil || key == "" {
+		return false, nil
+	}
+	return m.Get(key+filepath.Ext(p), p)
+}
+
+// putCached adds p to the media cache. The file was already saved so failing
+// to cache it isn't an error.
+func putCached(m *cache.Media, key, p string) {
+	if m == nil || key == "" {
+		return
+	}
+	m.Put(key+filepath.Ext(p), p)
 }
 
 // getImage gets the image, resizes it and saves it to specified path.
-func getImage(ctx context.Context, dsImg ds.Image, p string, w uint, h uint) error {
+func getImage(ctx context.Context, dsImg ds.Image, p string, w uint, h uint, m *cache.Media) error {
 	dir := filepath.Dir(p)
 	if !imgDirs[dir] {
 		err := mkDir(dir)
@@ -374,11 +526,19 @@ func getImage(ctx context.Context, dsImg ds.Image, p string, w uint, h uint) err
 		}
 		imgDirs[dir] = true
 	}
+	key := ds.CacheKey(dsImg, w, h)
+	if ok, err := getCached(m, key, p); ok || err != nil {
+		return err
+	}
 	<-lock
 	defer func() {
 		lock <- struct{}{}
 	}()
-	return dsImg.Save(ctx, p, w, h)
+	if err := dsImg.Save(ctx, p, w, h); err != nil {
+		return err
+	}
+	putCached(m, key, p)
+	return nil
 }
 
 func exists(s string) bool {
@@ -439,10 +599,27 @@ func (r *ROM) XML(ctx context.Context, opts *XMLOpts) (*GameXML, error) {
 		Genre:       r.Game.Genre,
 		Source:      r.Game.Source,
 		CloneOf:     r.Game.CloneOf,
+		Region:      r.Game.Region,
+		Lang:        r.Game.Lang,
 	}
 	if r.Game.Players > 0 {
 		gxml.Players = strconv.FormatInt(r.Game.Players, 10)
 	}
+	if r.Game.Fuzzy {
+		gxml.Fuzzy = "true"
+	}
+	gxml.Provenance = make(map[string]ds.Provenance)
+	for f, p := range r.Game.Provenance {
+		// Images and videos are added once one of them is used.
+		if !strings.Contains(f, ".") {
+			gxml.Provenance[f] = p
+		}
+	}
+	imgProvenance := func(f string, t ds.ImgType) {
+		if p, ok := r.Game.Provenance[ds.FieldImage+"."+string(t)]; ok {
+			gxml.Provenance[f] = p
+		}
+	}
 	imgPath := getImgPath(r, opts)
 	imgPath, exists := fileExists(imgPath, imgExts...)
 	if exists {
@@ -459,13 +636,19 @@ func (r *ROM) XML(ctx context.Context, opts *XMLOpts) (*GameXML, error) {
 			if dsImg == nil {
 				continue
 			}
-			if err := getImage(ctx, dsImg, imgPath, opts.ImgWidth, opts.ImgHeight); err != nil {
-				if err == ds.ErrImgNotFound {
+			if opts.DryRun {
+				gxml.Image = fixPath(opts.ImgXMLDir, opts.ImgDir, imgPath)
+				imgProvenance("image", it)
+				break
+			}
+			if err := getImage(ctx, dsImg, imgPath, opts.ImgWidth, opts.ImgHeight, opts.Media); err != nil {
+				if skipMedia(err) {
 					continue
 				}
 				return nil, err
 			}
 			gxml.Image = fixPath(opts.ImgXMLDir, opts.ImgDir, imgPath)
+			imgProvenance("image", it)
 			break
 		}
 	}
@@ -481,20 +664,24 @@ func (r *ROM) XML(ctx context.Context, opts *XMLOpts) (*GameXML, error) {
 				continue
 			}
 			newPath = vidPath + dsVid.Ext()
-			if err := getVideo(ctx, dsVid, newPath); err != nil {
-				if err == ds.ErrImgNotFound {
-					continue
-				}
-				return nil, err
-			}
-			if opts.VidConvert {
-				if err := convertVideo(newPath); err != nil {
+			if !opts.DryRun {
+				if err := getVideo(ctx, dsVid, newPath, opts.Media); err != nil {
+					if skipMedia(err) {
+						continue
+					}
 					return nil, err
 				}
+				if opts.VidConvert {
+					if err := convertVideo(newPath); err != nil {
+						return nil, err
+					}
+				}
 			}
 
 			gxml.Video = fixPath(opts.VidXMLDir, opts.VidDir, newPath)
-
+			if p, ok := r.Game.Provenance[ds.FieldVideo+"."+string(vt)]; ok {
+				gxml.Provenance["video"] = p
+			}
 		}
 	}
 	imgPath = getMarqPath(r, opts)
@@ -504,20 +691,39 @@ func (r *ROM) XML(ctx context.Context, opts *XMLOpts) (*GameXML, error) {
 	}
 	if !exists && opts.DownloadMarq {
 		if dsImg := r.Game.Images[ds.ImgMarquee]; dsImg != nil {
-			if err := getImage(ctx, dsImg, imgPath, opts.ImgWidth, opts.ImgHeight); err != nil && err != ds.ErrImgNotFound {
+			var err error
+			if !opts.DryRun {
+				err = getImage(ctx, dsImg, imgPath, opts.ImgWidth, opts.ImgHeight, opts.Media)
+			}
+			switch {
+			case err == nil:
+				gxml.Marquee = fixPath(opts.MarqXMLDir, opts.MarqDir, imgPath)
+				imgProvenance("marquee", ds.ImgMarquee)
+			case !skipMedia(err):
 				return nil, err
 			}
-			gxml.Marquee = fixPath(opts.MarqXMLDir, opts.MarqDir, imgPath)
 		}
 	}
 	return gxml, nil
 }
 
+// skipMedia returns true if the error means the image or video isn't available,
+// either because the source doesn't have it or it isn't cached in offline mode.
+// The image or video is skipped and the game is kept.
+func skipMedia(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	return err == ds.ErrImgNotFound || err == cache.ErrOffline
+}
+
 // GameXML is the object used to export the <game> elements of the gamelist.xml.
 type GameXML struct {
 	XMLName     xml.Name `xml:"game"`
 	ID          string   `xml:"id,attr"`
 	Source      string   `xml:"source,attr"`
+	Fuzzy       string   `xml:"fuzzy,attr,omitempty"`
+	Lock        string   `xml:"lock,attr,omitempty"`
 	Path        string   `xml:"path"`
 	GameTitle   string   `xml:"name"`
 	Overview    string   `xml:"desc"`
@@ -537,12 +743,26 @@ type GameXML struct {
 	CloneOf     string   `xml:"cloneof,omitempty"`
 	Hidden      string   `xml:"hidden,omitempty"`
 	KidGame     string   `xml:"kidgame,omitempty"`
+	Region      string   `xml:"region,omitempty"`
+	Lang        string   `xml:"lang,omitempty"`
+	// CRC32 is the CRC32 of the rom, of the data track for discs. It is written to
+	// the RetroArch playlist instead of the game list.
+	CRC32 string `xml:"-" json:",omitempty"`
+	// Provenance maps the elements to where their values came from. It is written to
+	// the provenance file instead of the game list.
+	Provenance map[string]ds.Provenance `xml:"-" json:",omitempty"`
+	// Attrs and Extra are the attributes and elements not known to the scraper.
+	Attrs []xml.Attr `xml:"-" json:",omitempty"`
+	Extra []Element  `xml:",any" json:",omitempty"`
 }
 
 // GameListXML is the structure used to export the gamelist.xml file.
 type GameListXML struct {
-	XMLName  xml.Name   `xml:"gameList"`
-	GameList []*GameXML `xml:"game"`
+	XMLName  xml.Name     `xml:"gameList"`
+	GameList []*GameXML   `xml:"game"`
+	Folders  []*FolderXML `xml:"folder"`
+	// Extra are the elements not known to the scraper.
+	Extra []Element `xml:",any" json:",omitempty"`
 }
 
 // Append appeads a GameXML to the GameList.
@@ -1,8 +1,17 @@
 package rom
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/sselph/scraper/cache"
+	"github.com/sselph/scraper/ds"
+	"github.com/sselph/scraper/naming"
 )
 
 func TestFixPath(t *testing.T) {
@@ -28,3 +37,154 @@ func TestFixPath(t *testing.T) {
 		}
 	}
 }
+
+func TestNewROMM3U(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	other, err := ioutil.TempDir("", "m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	disc1 := filepath.Join(dir, "Game (Disc 1).iso")
+	disc2 := filepath.Join(other, "Game (Disc 2).iso")
+	for _, p := range []string{disc1, disc2} {
+		if err := ioutil.WriteFile(p, []byte("disc"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m3u := filepath.Join(dir, "Game.m3u")
+	if err := ioutil.WriteFile(m3u, []byte("Game (Disc 1).iso\n"+filepath.ToSlash(disc2)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewROM(m3u)
+	if err != nil {
+		t.Fatalf("NewROM(%q) => err = %v; want nil", m3u, err)
+	}
+	if len(r.Discs) != 2 || r.Discs[0].Path != disc1 || r.Discs[1].Path != disc2 {
+		t.Errorf("NewROM(%q) => discs %v; want %s and %s", m3u, r.Bins, disc1, disc2)
+	}
+}
+
+func TestXMLOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client := ds.Client
+	ds.Client = &http.Client{Transport: cache.Offline{}}
+	defer func() {
+		ds.Client = client
+	}()
+	r := &ROM{Path: filepath.Join(dir, "smb.nes"), Game: ds.NewGame()}
+	r.populatePaths()
+	r.Game.GameTitle = "Super Mario Bros."
+	r.Game.Images[ds.ImgBoxart] = ds.HTTPImage{URL: "http://example.com/smb.png"}
+	r.Game.Images[ds.ImgMarquee] = ds.HTTPImage{URL: "http://example.com/smb-marquee.png"}
+	r.Game.Videos[ds.VidStandard] = ds.HTTPVideo{URL: "http://example.com/smb.mp4", E: ".mp4"}
+	opts := &XMLOpts{
+		RomDir: dir, RomXMLDir: ".",
+		ImgDir: dir, ImgXMLDir: ".", ImgFormat: "jpg", ImgPriority: []ds.ImgType{ds.ImgBoxart},
+		DownloadVid: true, VidDir: dir, VidXMLDir: ".", VidPriority: []ds.VidType{ds.VidStandard},
+		DownloadMarq: true, MarqDir: dir, MarqXMLDir: ".", MarqFormat: "png",
+	}
+	g, err := r.XML(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("XML() offline => err = %v; want nil", err)
+	}
+	if g.GameTitle != "Super Mario Bros." || g.Image != "" || g.Video != "" || g.Marquee != "" {
+		t.Errorf("XML() offline => %+v; want the game without images or videos", g)
+	}
+}
+
+// searchDS only finds games by name.
+type searchDS struct {
+	searches []string
+}
+
+func (s *searchDS) GetName(string) string { return "" }
+
+func (s *searchDS) GetGame(context.Context, string) (*ds.Game, error) {
+	return nil, ds.ErrNotFound
+}
+
+func (s *searchDS) SearchGame(_ context.Context, p string) (*ds.Game, error) {
+	s.searches = append(s.searches, p)
+	g := ds.NewGame()
+	g.GameTitle = "Game"
+	return g, nil
+}
+
+func TestGetGameSearch(t *testing.T) {
+	r := &ROM{Path: "game.cue", Cue: true, Bins: []string{"game (Track 1).bin", "game (Track 2).bin"}}
+	r.populatePaths()
+	src := &searchDS{}
+	if err := r.GetGame(context.Background(), []ds.DS{src}, nil); err != nil {
+		t.Fatalf("GetGame() => err = %v; want nil", err)
+	}
+	if len(src.searches) != 1 || src.searches[0] != r.Path {
+		t.Errorf("GetGame() searched %q; want only %q", src.searches, r.Path)
+	}
+	if r.Game == nil || r.Game.GameTitle != "Game" {
+		t.Errorf("GetGame() => %+v; want the game found by name", r.Game)
+	}
+}
+
+// nameDS finds every game with the title and names them name.
+type nameDS struct {
+	name, title string
+}
+
+func (n *nameDS) GetName(string) string { return n.name }
+
+func (n *nameDS) GetGame(context.Context, string) (*ds.Game, error) {
+	g := ds.NewGame()
+	g.GameTitle = n.title
+	return g, nil
+}
+
+func TestGetGameNameTags(t *testing.T) {
+	tests := []struct {
+		name, title string
+		want        string
+	}{
+		{"", "Street Fighter II (Champion Edition) v2", "Street Fighter II (Champion Edition) v2 (USA)"},
+		{"Super Game (Japan) (Rev 1)", "Super Game", "Super Game (USA)"},
+	}
+	for _, test := range tests {
+		r := &ROM{Path: "game (USA) (Rev 2).zip"}
+		r.populatePaths()
+		opts := &GameOpts{NameTags: []naming.Tag{naming.TagRegion}, NoStripUnicode: true}
+		if err := r.GetGame(context.Background(), []ds.DS{&nameDS{test.name, test.title}}, opts); err != nil {
+			t.Fatalf("GetGame() => err = %v; want nil", err)
+		}
+		if r.Game.GameTitle != test.want {
+			t.Errorf("GetGame() with name %q and title %q => %q; want %q", test.name, test.title, r.Game.GameTitle, test.want)
+		}
+	}
+}
+
+// errDS fails to get every game with err.
+type errDS struct {
+	err error
+}
+
+func (e *errDS) GetName(string) string { return "" }
+
+func (e *errDS) GetGame(context.Context, string) (*ds.Game, error) {
+	return nil, e.err
+}
+
+func TestGetGameMergeErr(t *testing.T) {
+	r := &ROM{Path: "game.zip"}
+	r.populatePaths()
+	errNet := errors.New("network error")
+	src := []ds.DS{&errDS{errNet}, &errDS{ds.ErrNotFound}}
+	if err := r.GetGame(context.Background(), src, &GameOpts{Merge: true}); err != errNet {
+		t.Errorf("GetGame() => err = %v; want %v", err, errNet)
+	}
+}
@@ -1,25 +1,34 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha1"
 	"encoding/csv"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/sselph/scraper/adb"
+	"github.com/sselph/scraper/cache"
+	"github.com/sselph/scraper/dat"
 	"github.com/sselph/scraper/ds"
 	"github.com/sselph/scraper/gdb"
+	"github.com/sselph/scraper/limit"
+	"github.com/sselph/scraper/mamedb"
+	"github.com/sselph/scraper/naming"
 	"github.com/sselph/scraper/rom"
 	"github.com/sselph/scraper/ss"
 
@@ -29,6 +38,10 @@ import (
 var hashFile = flag.String("hash_file", "", "The `file` containing hash information.")
 var romDir = flag.String("rom_dir", ".", "The `directory` containing the roms file to process.")
 var outputFile = flag.String("output_file", "gamelist.xml", "The XML `file` to output to. If scrape_all is used, this is ignored and the gamelist in the system path.")
+var outputFormat = flag.String("output_format", "es", "The `format` of the output file, es=EmulationStation gamelist.xml, pegasus=Pegasus metadata.pegasus.txt, retroarch=RetroArch <System>.lpl playlist, attractmode=Attract-Mode romlist, launchbox=LaunchBox platform XML.")
+var retroArchDir = flag.String("retroarch_dir", "", "The RetroArch `directory` containing the playlists and thumbnails directories. If empty, playlists are written next to the roms and no thumbnails are copied.")
+var attractModeDir = flag.String("attractmode_dir", "", "The Attract-Mode `directory` containing the romlists directory. If empty, romlists are written next to the roms.")
+var launchBoxDir = flag.String("launchbox_dir", "", "The LaunchBox `directory`. If empty, platform XMLs are written next to the roms.")
 var imageDir = flag.String("image_dir", "images", "The `directory` to place downloaded images to locally.")
 var imagePath = flag.String("image_path", "images", "The `path` to use for images in gamelist.xml. If scrape_all is used, only image_dir is used.")
 var videoDir = flag.String("video_dir", "images", "The `directory` to place downloaded videos to locally.")
@@ -52,12 +65,13 @@ var nestedImageDir = flag.Bool("nested_img_dir", false, "Use a nested img direct
 var region = flag.String("region", "us,wor,eu,jp,fr,xx", "The order to choose for region if there is more than one for a value. xx is a special region that will choose any region.")
 var lang = flag.String("lang", "en", "The order to choose for language if there is more than one for a value. (en, fr, es, de, pt)")
 var useFilename = flag.Bool("use_filename", false, "If true, use the filename minus the extension as the game title in xml.")
+var nameTags = flag.String("name_tags", "", "Comma-separated list of tags of the filename to add to the game title: region, language, revision, version, disc. ie \"region,revision\" gives \"Game (USA) (Rev 1)\".")
 var addNotFound = flag.Bool("add_not_found", false, "If true, add roms that are not found as an empty gamelist entry.")
 var useNoIntroName = flag.Bool("use_nointro_name", true, "Use the name in the No-Intro DB instead of the one in the GDB.")
 var mame = flag.Bool("mame", false, "If true we want to run in MAME mode.")
 var mameImg = flag.String("mame_img", "t,m,s,c", "Comma-separated order to prefer images, s=snap, t=title, m=marquee, c=cabinet, b=boxart, 3b=3D-boxart, fly=flyer.")
-var mameSrcs = flag.String("mame_src", "adb,gdb", "Comma-separated order to prefer mame sources, ss=screenscraper, adb=arcadeitalia, mamedb=mamedb-mirror, gdb=theGamesDB-neogeo")
-var consoleSrcs = flag.String("console_src", "gdb", "Comma-separated order to prefer console sources, ss=screenscraper, ovgdb=OpenVGDB, gdb=theGamesDB")
+var mameSrcs = flag.String("mame_src", "adb,gdb", "Comma-separated order to prefer mame sources, ss=screenscraper, adb=arcadeitalia, mamedb=mamedb-mirror, gdb=theGamesDB-neogeo, dat=local DAT files")
+var consoleSrcs = flag.String("console_src", "gdb", "Comma-separated order to prefer console sources, ss=screenscraper, ovgdb=OpenVGDB, gdb=theGamesDB, gdb_search=theGamesDB by file name, dat=local DAT files, header=ROM header")
 var stripUnicode = flag.Bool("strip_unicode", false, "If true, remove all non-ascii characters.")
 var downloadImages = flag.Bool("download_images", true, "If false, don't download any images, instead see if the expected file is stored locally already.")
 var downloadVideos = flag.Bool("download_videos", false, "If true, download videos.")
@@ -77,6 +91,29 @@ var ssUser = flag.String("ss_user", "", "The `username` for registered ScreenScr
 var ssPassword = flag.String("ss_password", "", "The `password` for registered ScreenScraper users.")
 var gdbAPIkey = flag.String("gdb_apikey", "", "The gamesdb apikey received by https://forums.thegamesdb.net/viewforum.php?f=10")
 var updateCache = flag.Bool("update_cache", true, "If false, don't check for updates on locally cached files.")
+var datFiles = flag.String("dat_files", "", "Comma-separated list of Logiqx XML DAT `files` used by the dat source.")
+var configFile = flag.String("config", "", "The TOML, YAML or JSON config `file` with values for the flags. If empty, config.toml, config.yaml, config.yml or config.json in the cache directory is used if it exists.")
+var resume = flag.Bool("resume", false, "If true, continue an interrupted scrape skipping the ROMs that were already processed.")
+var flushInterval = flag.Duration("flush_interval", time.Minute, "How often the partial output file is written while scraping. If 0, it is only written at the end.")
+var cacheTTL = flag.Duration("cache_ttl", 30*24*time.Hour, "How long responses from the metadata APIs are cached, not found responses are cached for at most a day. If 0, responses aren't cached.")
+var offline = flag.Bool("offline", false, "If true, only use cached responses and files and never make a request.")
+var mediaCacheSize = flag.Int64("media_cache_size", 1024, "The max size in `MB` of the cache of downloaded images and videos. If 0, they aren't cached.")
+var dryRun = flag.Bool("dry_run", false, "If true, look up every ROM but don't write the output file or download images and videos. The changes to the output file are printed instead.")
+var diffJSON = flag.String("diff_json", "", "With -dry_run, also write the changes to the output file as JSON to this `file`.")
+var provenance = flag.Bool("provenance", false, "If true, write the source, ID, match method and time of each scraped value to the output file followed by .provenance.json. With -refresh, values changed after scraping are kept.")
+var folders = flag.Bool("folders", false, "If true, add a <folder> element with a name, description and image for each subdirectory holding games. Folders holding a single game, like the discs of a multi-disc game, use the game's metadata and image. A folder.jpg in the subdirectory is used as its image. Folders of deleted subdirectories are removed.")
+var groupDiscs = flag.Bool("group_discs", false, "If true, scrape the files of a multi-disc game, ie \"Game (Disc 1).cue\" and \"Game (Disc 2).cue\", once and hide all but the first disc in the output file.")
+var m3u = flag.Bool("m3u", false, "With -group_discs, write an .m3u playlist of the discs of each multi-disc game and list it instead of the first disc.")
+var merge = flag.Bool("merge", false, "If true, query every source until no field can change and merge the games found instead of using the first one.")
+var mergePriority = flag.String("merge_priority", "", "Semicolon-separated list of fields and the order of the sources to take them from when merging, ie \"desc=ss,gdb;image=ss,gdb;rating=adb\". Fields are name, desc, rating, releasedate, developer, publisher, genre, players, cloneof, region, lang, image, image.<type>, video and video.<type>.")
+var mediaCacheMode = flag.String("media_cache_mode", "copy", "How images and videos are created from the media cache: copy, hardlink or symlink. Symlinks break when a file is removed from the cache.")
+var rateLimits = flag.String("rate_limits", "", "Comma-separated list of host=`N` limiting the requests per second to each host, e.g. www.screenscraper.fr=2.")
+var dailyQuotas = flag.String("daily_quotas", "", "Comma-separated list of host=`N` limiting the requests per day to each host. The requests made today are saved in the cache directory.")
+var throttleRetries = flag.Int("throttle_retries", 5, "The number of times a request throttled by the server is retried after waiting.")
+var ssSearch = flag.Bool("ss_search", false, "If true, search ScreenScraper by the name of the file when the hash isn't found. Games found this way are marked as fuzzy.")
+var ssSearchThreshold = flag.Float64("ss_search_threshold", 0.75, "The minimum score from 0 to 1 of a game found by -ss_search.")
+var gdbSearchThreshold = flag.Float64("gdb_search_threshold", 0.75, "The minimum score from 0 to 1 of a game found by the gdb_search source.")
+var rehash = flag.Bool("rehash", false, "If true, ignore the cached hashes of ROMs and hash them again.")
 
 var errUserCanceled = errors.New("user canceled")
 
@@ -93,6 +130,17 @@ func dirExists(s string) bool {
 	return !os.IsNotExist(err) && fi.IsDir()
 }
 
+// hasExt checks if the file has one of the extensions.
+func hasExt(f string, exts []string) bool {
+	e := filepath.Ext(f)
+	for _, x := range exts {
+		if e == x {
+			return true
+		}
+	}
+	return false
+}
+
 func isHidden(f string) bool {
 	b := filepath.Base(f)
 	return b != "." && strings.HasPrefix(b, ".")
@@ -130,7 +178,7 @@ func done(ctx context.Context) bool {
 }
 
 // worker is a function to process roms from a channel.
-func worker(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts *rom.GameOpts, results chan result, roms chan *rom.ROM, wg *sync.WaitGroup) {
+func worker(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts *rom.GameOpts, gw rom.GameWriter, results chan result, roms chan *rom.ROM, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for r := range roms {
 		if done(ctx) {
@@ -143,8 +191,12 @@ func worker(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts
 			}
 			log.Printf("INFO: Starting: %s", r.Path)
 			if err := r.GetGame(ctx, sources, gameOpts); err != nil {
-				log.Printf("ERR: error processing %s: %s", r.Path, err)
 				res.Err = err
+				if err == ds.ErrQuota {
+					// The source logs when its quota is reached so every ROM isn't logged.
+					break
+				}
+				log.Printf("ERR: error processing %s: %s", r.Path, err)
 				if err == ds.ErrNotFound {
 					break
 				} else {
@@ -161,6 +213,11 @@ func worker(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts
 				continue
 			}
 			res.XML = xml
+			if gw != nil {
+				if err := gw.WriteGame(r, xml); err != nil {
+					log.Printf("ERR: Can't write the files of %s: %s", r.Path, err)
+				}
+			}
 			break
 		}
 		results <- res
@@ -168,7 +225,9 @@ func worker(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts
 }
 
 // crawlROMs crawls the rom directory and processes the files.
-func crawlROMs(ctx context.Context, gl *rom.GameListXML, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts *rom.GameOpts) error {
+// Each result is recorded in the journal and the game list is flushed periodically.
+// If gw isn't nil, it writes the files of each game once it is scraped.
+func crawlROMs(ctx context.Context, gl *rom.GameListXML, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts *rom.GameOpts, gw rom.GameWriter, j *journal, flush func() error) error {
 	var missingCSV *csv.Writer
 	var gdbDS *ds.GDB
 	if *missing != "" {
@@ -237,11 +296,45 @@ func crawlROMs(ctx context.Context, gl *rom.GameListXML, sources []ds.DS, xmlOpt
 	roms := make(chan *rom.ROM, 2**workers)
 	for i := 0; i < *workers; i++ {
 		wg.Add(1)
-		go worker(ctx, sources, xmlOpts, gameOpts, results, roms, &wg)
+		go worker(ctx, sources, xmlOpts, gameOpts, gw, results, roms, &wg)
+	}
+	// listed are the paths of the games in the list before scraping.
+	listed := make(map[string]bool)
+	for _, x := range gl.GameList {
+		listed[x.Path] = true
+	}
+	// add adds the game to the list replacing the game with the same path when refreshing.
+	add := func(x *rom.GameXML) {
+		if existing[x.Path] && *refreshOut {
+			for i, g := range gl.GameList {
+				if g.Path != x.Path {
+					continue
+				}
+				x.Refresh(g)
+				x.Keep(g)
+				copy(gl.GameList[i:], gl.GameList[i+1:])
+				gl.GameList = gl.GameList[:len(gl.GameList)-1]
+			}
+		}
+		gl.Append(x)
 	}
 	go func() {
 		defer wg.Done()
+		lastFlush := time.Now()
 		for r := range results {
+			e := journalEntry{Path: r.ROM.Path, Status: statusDone, Game: r.XML}
+			if r.XML == nil {
+				e.Status = statusFailed
+				if r.Err == ds.ErrNotFound {
+					e.Status = statusNotFound
+				}
+				if r.Err != nil {
+					e.Error = r.Err.Error()
+				}
+			}
+			if err := j.add(e); err != nil {
+				log.Printf("ERR: Can't write to journal: %s", err)
+			}
 			if r.XML == nil {
 				if *missing == "" {
 					continue
@@ -282,61 +375,104 @@ func crawlROMs(ctx context.Context, gl *rom.GameListXML, sources []ds.DS, xmlOpt
 					log.Printf("ERR: Can't write to %s", *missing)
 				}
 			}
-			if existing[r.XML.Path] && *refreshOut {
-				for i, g := range gl.GameList {
-					if g.Path != r.XML.Path {
+			add(r.XML)
+			if r.ROM.Group != nil {
+				for _, h := range r.ROM.Group.Hidden(r.XML, xmlOpts) {
+					if err := j.add(journalEntry{Path: h.Path, Status: statusDone, Game: h}); err != nil {
+						log.Printf("ERR: Can't write to journal: %s", err)
+					}
+					// Discs listed by an earlier run are hidden once scraping is done.
+					if listed[h.Path] && !*refreshOut {
 						continue
 					}
-					r.XML.Favorite = g.Favorite
-					r.XML.LastPlayed = g.LastPlayed
-					r.XML.PlayCount = g.PlayCount
-					copy(gl.GameList[i:], gl.GameList[i+1:])
-					gl.GameList = gl.GameList[:len(gl.GameList)-1]
+					add(h)
+				}
+			}
+			if *flushInterval > 0 && time.Since(lastFlush) >= *flushInterval {
+				if err := flush(); err != nil {
+					log.Printf("ERR: Can't write partial output: %s", err)
 				}
+				lastFlush = time.Now()
 			}
-			gl.Append(r.XML)
 		}
 	}()
+	// skip returns true if the file was scraped by an earlier run.
+	skip := func(f string) bool {
+		if existing[f] && !*refreshOut {
+			log.Printf("INFO: Skipping %s, already in gamelist.", f)
+			return true
+		}
+		if j.skip(f) {
+			log.Printf("INFO: Skipping %s, already in journal.", f)
+			return true
+		}
+		return false
+	}
+	// grouped returns true if the file has a disc tag. These files are only skipped
+	// once grouped so a game is skipped or scraped with all its discs.
+	grouped := func(f string) bool {
+		return *groupDiscs && !*mame && naming.ParseFile(f).Disc != ""
+	}
+	// discs are the files with a disc tag, grouped once every file is found.
+	var discs []*rom.ROM
+	send := func(r *rom.ROM) {
+		if grouped(r.Path) {
+			discs = append(discs, r)
+			return
+		}
+		roms <- r
+	}
 	bins := make(map[string]bool)
 	if !*mame {
-		err := filepath.Walk(xmlOpts.RomDir, func(f string, fi os.FileInfo, err error) error {
-			if done(ctx) {
-				return ctx.Err()
-			}
-			if err != nil {
-				log.Printf("ERR: Processing: %s, %s", f, err)
-				return nil
-			}
-			if isHidden(f) {
-				if fi.IsDir() {
-					return filepath.SkipDir
+		// Playlists are processed before cue sheets so discs that are part of a
+		// multi-disc game don't get their own entry.
+		for _, exts := range [][]string{{".m3u"}, {".cue", ".gdi"}} {
+			err := filepath.Walk(xmlOpts.RomDir, func(f string, fi os.FileInfo, err error) error {
+				if done(ctx) {
+					return ctx.Err()
 				}
+				if err != nil {
+					log.Printf("ERR: Processing: %s, %s", f, err)
+					return nil
+				}
+				if isHidden(f) {
+					if fi.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if fi.IsDir() || bins[f] || !hasExt(f, exts) {
+					return nil
+				}
+				r, err := rom.NewROM(f)
+				if err != nil {
+					log.Printf("ERR: Processing: %s, %s", f, err)
+					return nil
+				}
+				for _, b := range r.Bins {
+					bins[b] = true
+				}
+				bins[f] = true
+				if r.Ext != ".m3u" && grouped(f) {
+					send(r)
+					return nil
+				}
+				if skip(f) {
+					return nil
+				}
+				if r.Ext == ".m3u" {
+					if *groupDiscs {
+						r.Group = &rom.DiscGroup{Discs: r.Discs}
+					}
+					roms <- r
+					return nil
+				}
+				send(r)
 				return nil
+			})
+			if err != nil && err != context.Canceled {
+				return err
 			}
-			if fi.IsDir() {
-				return nil
-			}
-			r, err := rom.NewROM(f)
-			if err != nil {
-				log.Printf("ERR: Processing: %s, %s", f, err)
-				return nil
-			}
-			if !r.Cue {
-				return nil
-			}
-			for _, b := range r.Bins {
-				bins[b] = true
-			}
-			bins[f] = true
-			if existing[f] && !*refreshOut {
-				log.Printf("INFO: Skipping %s, already in gamelist.", f)
-				return nil
-			}
-			roms <- r
-			return nil
-		})
-		if err != nil && err != context.Canceled {
-			return err
 		}
 	}
 	err := filepath.Walk(xmlOpts.RomDir, func(f string, fi os.FileInfo, err error) error {
@@ -359,8 +495,7 @@ func crawlROMs(ctx context.Context, gl *rom.GameListXML, sources []ds.DS, xmlOpt
 		if filepath.Ext(f) == ".daphne" {
 			return filepath.SkipDir
 		}
-		if existing[f] && !*refreshOut {
-			log.Printf("INFO: Skipping %s, already in gamelist.", f)
+		if !grouped(f) && skip(f) {
 			return nil
 		}
 		r, err := rom.NewROM(f)
@@ -375,18 +510,56 @@ func crawlROMs(ctx context.Context, gl *rom.GameListXML, sources []ds.DS, xmlOpt
 			return nil
 		}
 		if !bins[f] && (rh.KnownExt(r.Ext) || r.Ext == ".svm" || r.Ext == ".daphne" || r.Ext == ".7z") {
-			roms <- r
+			send(r)
 		}
 		return nil
 	})
 	if err != nil && err != context.Canceled {
 		return err
 	}
+	groups, rest := rom.GroupDiscs(discs)
+	for _, r := range rest {
+		if done(ctx) {
+			break
+		}
+		if !skip(r.Path) {
+			roms <- r
+		}
+	}
+	// entries are the ROMs listed for the groups.
+	entries := make([]*rom.ROM, len(groups))
+	for i, g := range groups {
+		if done(ctx) {
+			break
+		}
+		r := g.Discs[0]
+		if *m3u {
+			r = g.M3U()
+		}
+		entries[i] = r
+		if skip(r.Path) {
+			continue
+		}
+		if *m3u && !*dryRun {
+			if err := g.WriteM3U(); err != nil {
+				log.Printf("ERR: Can't write %s, %s", r.Path, err)
+				r = g.Discs[0]
+			}
+		}
+		r.Group = g
+		entries[i] = r
+		roms <- r
+	}
 	close(roms)
 	wg.Wait()
 	wg.Add(1)
 	close(results)
 	wg.Wait()
+	for i, g := range groups {
+		if entries[i] != nil {
+			g.HideDiscs(gl, entries[i], xmlOpts)
+		}
+	}
 	if done(ctx) {
 		return errUserCanceled
 	}
@@ -406,46 +579,292 @@ func mkDir(d string) error {
 	return fmt.Errorf("%s is a file not a directory", d)
 }
 
+// formatOpts are the options used to create an output format.
+type formatOpts struct {
+	xmlOpts *rom.XMLOpts
+	// name is the name of the system, either from es_systems.cfg or the rom directory.
+	name string
+	// platform is the platform of the system in es_systems.cfg, it may be empty.
+	platform string
+	hasher   *ds.Hasher
+}
+
+// systemName returns the name of the system when not using es_systems.cfg.
+func systemName(romDir string) string {
+	d, err := filepath.Abs(romDir)
+	if err != nil {
+		return filepath.Base(romDir)
+	}
+	return filepath.Base(d)
+}
+
+// formats are the output formats that can be selected with -output_format.
+var formats = map[string]func(o formatOpts) rom.Format{
+	"es": func(formatOpts) rom.Format {
+		return rom.ESFormat{}
+	},
+	"pegasus": func(o formatOpts) rom.Format {
+		p := rom.Pegasus{Collection: o.name}
+		if len(o.xmlOpts.ImgPriority) > 0 {
+			p.ImageAsset = rom.PegasusAsset(o.xmlOpts.ImgPriority[0])
+		}
+		return p
+	},
+	"retroarch": func(o formatOpts) rom.Format {
+		ra := rom.RetroArch{Dir: *retroArchDir, Opts: o.xmlOpts, Hasher: o.hasher}
+		var ok bool
+		if ra.Name, ok = rom.RetroArchPlaylist(o.platform); !ok {
+			if ra.Name, ok = rom.RetroArchPlaylist(o.name); !ok {
+				ra.Name = o.name
+			}
+		}
+		if len(o.xmlOpts.ImgPriority) > 0 {
+			ra.ThumbDir = rom.RetroArchThumbDir(o.xmlOpts.ImgPriority[0])
+		}
+		return ra
+	},
+	"attractmode": func(o formatOpts) rom.Format {
+		return rom.AttractMode{Emulator: o.name, Dir: *attractModeDir, Opts: o.xmlOpts}
+	},
+	"launchbox": func(o formatOpts) rom.Format {
+		lb := rom.LaunchBox{Dir: *launchBoxDir, Opts: o.xmlOpts}
+		var ok bool
+		if lb.Platform, ok = rom.LaunchBoxPlatform(o.platform); !ok {
+			if lb.Platform, ok = rom.LaunchBoxPlatform(o.name); !ok {
+				lb.Platform = o.name
+			}
+		}
+		return lb
+	},
+}
+
 // scrape handles scraping and wriiting the XML.
-func scrape(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts *rom.GameOpts) error {
+func scrape(ctx context.Context, sources []ds.DS, xmlOpts *rom.XMLOpts, gameOpts *rom.GameOpts, format rom.Format) error {
 	var err error
 	xmlOpts.RomDir, err = filepath.EvalSymlinks(xmlOpts.RomDir)
 	if err != nil {
 		return err
 	}
 	gl := &rom.GameListXML{}
-	if *appendOut || *refreshOut {
+	if *appendOut || *refreshOut || *dryRun {
 		f, err := os.Open(*outputFile)
 		if err != nil {
 			log.Printf("ERR: Can't open %s, creating new file. error %q", *outputFile, err)
 		} else {
-			decoder := xml.NewDecoder(f)
-			if err := decoder.Decode(gl); err != nil {
+			if err := format.Decode(f, gl); err != nil {
 				log.Printf("ERR: Can't open %s, creating new file. error %q", *outputFile, err)
 			}
 			f.Close()
 		}
+		if *provenance {
+			if err := readProvenance(gl); err != nil {
+				log.Printf("ERR: Can't read the provenance of %s. error %q", *outputFile, err)
+			}
+		}
 	}
-	cerr := crawlROMs(ctx, gl, sources, xmlOpts, gameOpts)
+	if *dryRun {
+		// Refreshing, hiding discs and AddFolders change the games and folders in place.
+		old := &rom.GameListXML{}
+		for _, g := range gl.GameList {
+			c := *g
+			old.GameList = append(old.GameList, &c)
+		}
+		for _, f := range gl.Folders {
+			c := *f
+			old.Folders = append(old.Folders, &c)
+		}
+		if !*appendOut && !*refreshOut {
+			gl.GameList = nil
+		}
+		noFlush := func() error { return nil }
+		if err := crawlROMs(ctx, gl, sources, xmlOpts, gameOpts, nil, discardJournal(), noFlush); err != nil {
+			return err
+		}
+		if *folders {
+			gl.AddFolders(xmlOpts)
+		}
+		return writeDiff(rom.DiffList(old, gl))
+	}
+	jp, err := journalPath(*outputFile)
+	if err != nil {
+		return err
+	}
+	j, err := openJournal(jp, *resume)
+	if err != nil {
+		return err
+	}
+	if *resume {
+		listed := make(map[string]bool)
+		for _, g := range gl.GameList {
+			listed[g.Path] = true
+		}
+		for _, g := range j.games() {
+			if !listed[g.Path] {
+				gl.Append(g)
+			}
+		}
+	}
+	flush := func() error {
+		if err := writeGameList(gl, format); err != nil {
+			return err
+		}
+		if *provenance {
+			return writeProvenance(gl)
+		}
+		return nil
+	}
+	gw, _ := format.(rom.GameWriter)
+	cerr := crawlROMs(ctx, gl, sources, xmlOpts, gameOpts, gw, j, flush)
 	if cerr != nil && cerr != errUserCanceled {
+		j.Close()
 		return cerr
 	}
-	output, err := xml.MarshalIndent(gl, "  ", "    ")
-	if err != nil {
+	if *folders {
+		gl.AddFolders(xmlOpts)
+	}
+	if err := flush(); err != nil {
+		j.Close()
 		return err
 	}
-	if len(gl.GameList) == 0 {
+	if cerr != nil {
+		j.Close()
 		return cerr
 	}
-	err = mkDir(filepath.Dir(*outputFile))
+	return j.Remove()
+}
+
+// setHTTPClients makes the metadata APIs and the image and video downloads share
+// the rate limiter. The metadata APIs also use the response cache in the cache directory.
+func setHTTPClients() error {
+	hosts, err := limit.ParseHosts(*rateLimits, *dailyQuotas)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(*outputFile, append([]byte(xml.Header), output...), 0664)
+	lt := &limit.Transport{Hosts: hosts, Retries: *throttleRetries}
+	if *dailyQuotas != "" {
+		dir, err := ds.DefaultCachePath()
+		if err != nil {
+			return err
+		}
+		lt.Counts = filepath.Join(dir, "quotas.json")
+	}
+	ds.Client = lt.Client()
+	c := ds.Client
+	if *offline {
+		ds.Client = &http.Client{Transport: cache.Offline{}}
+	}
+	if *cacheTTL > 0 || *offline {
+		dir, err := ds.DefaultCachePath()
+		if err != nil {
+			return err
+		}
+		t, err := cache.New(filepath.Join(dir, "http"), *cacheTTL, *offline)
+		if err != nil {
+			return err
+		}
+		t.Transport = lt
+		c = t.Client()
+	}
+	ss.Client = c
+	adb.Client = c
+	mamedb.Client = c
+	gdb.SetClient(c)
+	return nil
+}
+
+// newMediaCache opens the cache of downloaded images and videos in the cache directory.
+func newMediaCache() (*cache.Media, error) {
+	dir, err := ds.DefaultCachePath()
 	if err != nil {
+		return nil, err
+	}
+	return cache.NewMedia(filepath.Join(dir, "media"), *mediaCacheSize<<20, *mediaCacheMode)
+}
+
+// writeDiff prints the changes -dry_run would make to the output file and writes
+// them as JSON to the -diff_json file.
+func writeDiff(d *rom.ListDiff) error {
+	fmt.Printf("Changes to %s:\n", *outputFile)
+	if err := d.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if *diffJSON == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*diffJSON, append(b, '\n'), 0664)
+}
+
+// readProvenance reads the provenance of the games in the game list if the file exists.
+func readProvenance(gl *rom.GameListXML) error {
+	f, err := os.Open(rom.ProvenanceFile(*outputFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return rom.ReadProvenance(f, gl)
+}
+
+// writeProvenance writes the provenance of the games in the game list next to the
+// output file.
+func writeProvenance(gl *rom.GameListXML) error {
+	if len(gl.GameList) == 0 {
+		return nil
+	}
+	var output bytes.Buffer
+	if err := rom.WriteProvenance(&output, gl); err != nil {
+		return err
+	}
+	p := rom.ProvenanceFile(*outputFile)
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, output.Bytes(), 0664); err != nil {
 		return err
 	}
-	return cerr
+	return os.Rename(tmp, p)
+}
+
+// writeGameList writes the game list to the output file. The file is replaced
+// atomically so an interruption never leaves a partial file.
+func writeGameList(gl *rom.GameListXML, format rom.Format) error {
+	var output bytes.Buffer
+	if err := format.Encode(&output, gl); err != nil {
+		return err
+	}
+	if len(gl.GameList) == 0 {
+		return nil
+	}
+	if err := mkDir(filepath.Dir(*outputFile)); err != nil {
+		return err
+	}
+	tmp := *outputFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, output.Bytes(), 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *outputFile)
+}
+
+var datDB *dat.DB
+
+// loadDAT loads the DAT files once for all sources.
+func loadDAT() (*dat.DB, error) {
+	if datDB != nil {
+		return datDB, nil
+	}
+	if *datFiles == "" {
+		return nil, errors.New("the dat source requires -dat_files")
+	}
+	db, err := dat.Load(strings.Split(*datFiles, ",")...)
+	if err != nil {
+		return nil, err
+	}
+	datDB = db
+	return db, nil
 }
 
 // System represents a single system in es_systems.cfg
@@ -503,34 +922,9 @@ func getSystems() ([]System, error) {
 	return out, nil
 }
 
-func main() {
-	flag.Parse()
-	status := 1
-	defer func() {
-		os.Exit(status)
-	}()
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	stopChan := make(chan os.Signal)
-	signal.Notify(stopChan, os.Interrupt)
-	defer signal.Stop(stopChan)
-	go func() {
-		<-stopChan
-		status = 130
-		cancel()
-	}()
-
-	if *version {
-		fmt.Println(versionStr)
-		return
-	}
-	runtime.GOMAXPROCS(runtime.NumCPU())
-	if *imgWorkers == 0 {
-		*imgWorkers = *workers
-	}
-	rom.SetMaxImg(*imgWorkers)
-
-	xmlOpts := &rom.XMLOpts{
+// newXMLOpts creates the XMLOpts from the flags.
+func newXMLOpts(media *cache.Media) *rom.XMLOpts {
+	return &rom.XMLOpts{
 		RomDir:       *romDir,
 		RomXMLDir:    *romPath,
 		NestImgDir:   *nestedImageDir,
@@ -553,33 +947,185 @@ func main() {
 		MarqSuffix:   *marqueeSuffix,
 		MarqFormat:   *marqueeFormat,
 		VidPriority:  []ds.VidType{ds.VidStandard},
+		Media:        media,
+		DryRun:       *dryRun,
 	}
-	var aImg []ds.ImgType
-	var cImg []ds.ImgType
-	var ssRegions []string
-	var ssLangs []string
-	for _, t := range strings.Split(*mameImg, ",") {
-		aImg = append(aImg, ds.ImgType(t))
-	}
-	for _, t := range strings.Split(*consoleImg, ",") {
-		cImg = append(cImg, ds.ImgType(t))
+}
+
+// newGameOpts creates the GameOpts from the flags.
+func newGameOpts() (*rom.GameOpts, error) {
+	tags, err := naming.ParseTags(*nameTags)
+	if err != nil {
+		return nil, err
 	}
-	for _, r := range strings.Split(*region, ",") {
-		if r != "" {
-			ssRegions = append(ssRegions, r)
-		}
+	priority, err := ds.ParsePriority(*mergePriority)
+	if err != nil {
+		return nil, err
 	}
-	for _, l := range strings.Split(*lang, ",") {
-		if l != "" {
-			ssLangs = append(ssLangs, l)
-		}
+	var vids []ds.VidType
+	if *downloadVideos {
+		vids = []ds.VidType{ds.VidStandard}
 	}
-	gameOpts := &rom.GameOpts{
+	return &rom.GameOpts{
 		AddNotFound:    *addNotFound,
 		NoPrettyName:   !*useNoIntroName,
 		UseFilename:    *useFilename,
+		NameTags:       tags,
 		NoStripUnicode: !*stripUnicode,
 		OverviewLen:    *overviewLen,
+		Merge:          *merge,
+		Priority:       priority,
+		MergeVideos:    vids,
+	}, nil
+}
+
+// imgTypes splits a comma-separated list of image types.
+func imgTypes(s string) []ds.ImgType {
+	var out []ds.ImgType
+	for _, t := range strings.Split(s, ",") {
+		out = append(out, ds.ImgType(t))
+	}
+	return out
+}
+
+// splitList splits a comma-separated list removing empty values.
+func splitList(s string) []string {
+	var out []string
+	for _, x := range strings.Split(s, ",") {
+		if x != "" {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// withOptions returns copies of the sources using the current region, language,
+// image size and search flags so they can be changed per system.
+func withOptions(sources []ds.DS, platform string) []ds.DS {
+	out := make([]ds.DS, len(sources))
+	for i, src := range sources {
+		switch src := src.(type) {
+		case *ds.SS:
+			c := *src
+			c.Region, c.Lang = splitList(*region), splitList(*lang)
+			c.Width, c.Height = int(*maxWidth), int(*maxHeight)
+			c.Search, c.SearchThreshold = *ssSearch, *ssSearchThreshold
+			c.SystemID, _ = ss.SystemID(platform)
+			out[i] = &c
+		case *ds.GDBSearch:
+			c := *src
+			c.Threshold = *gdbSearchThreshold
+			out[i] = &c
+		case *ds.SSMAME:
+			c := *src
+			c.Region, c.Lang = splitList(*region), splitList(*lang)
+			c.Width, c.Height = int(*maxWidth), int(*maxHeight)
+			out[i] = &c
+		default:
+			out[i] = src
+		}
+	}
+	return out
+}
+
+func main() {
+	flag.Parse()
+	status := 1
+	defer func() {
+		os.Exit(status)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopChan := make(chan os.Signal)
+	signal.Notify(stopChan, os.Interrupt)
+	defer signal.Stop(stopChan)
+	go func() {
+		<-stopChan
+		status = 130
+		cancel()
+	}()
+
+	if *version {
+		fmt.Println(versionStr)
+		return
+	}
+	cli := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		cli[f.Name] = true
+	})
+	if *configFile == "" {
+		p, err := findConfig()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		*configFile = p
+	}
+	cfg := &config{}
+	if *configFile != "" {
+		var err error
+		cfg, err = loadConfig(*configFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := cfg.apply(cli); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if *scrapeAll {
+			if err := cfg.checkSystems(); err != nil {
+				fmt.Println(err)
+				return
+			}
+		} else {
+			if _, err := cfg.applySystem(systemName(*romDir), cli); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
+	newFormat, ok := formats[*outputFormat]
+	if !ok {
+		fmt.Printf("Invalid output format %q\n", *outputFormat)
+		return
+	}
+	outputSet := cli["output_file"] || cfg.has(systemName(*romDir), "output_file")
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	if *imgWorkers == 0 {
+		*imgWorkers = *workers
+	}
+	rom.SetMaxImg(*imgWorkers)
+	if *offline {
+		*updateCache = false
+	}
+	if *dryRun {
+		// Nothing but the diff is written.
+		*missing = ""
+	}
+	if err := setHTTPClients(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var media *cache.Media
+	if *mediaCacheSize > 0 {
+		var err error
+		media, err = newMediaCache()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	xmlOpts := newXMLOpts(media)
+	aImg := imgTypes(*mameImg)
+	cImg := imgTypes(*consoleImg)
+	ssRegions := splitList(*region)
+	ssLangs := splitList(*lang)
+	gameOpts, err := newGameOpts()
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
 	var arcadeSources []ds.DS
@@ -601,13 +1147,16 @@ func main() {
 	aSrcNames := strings.Split(*mameSrcs, ",")
 	for _, s := range cSrcNames {
 		switch s {
-		case "gdb", "ss":
+		case "gdb", "ss", "gdb_search":
 			needHM = true
 			needHasher = true
-		case "ovgdb":
+		case "ovgdb", "dat":
 			needHasher = true
 		}
 	}
+	if *outputFormat == "retroarch" {
+		needHasher = true
+	}
 	for _, s := range aSrcNames {
 		switch s {
 		case "gdb":
@@ -616,13 +1165,18 @@ func main() {
 	}
 
 	var hasher *ds.Hasher
-	var err error
 	if needHasher {
-		hasher, err = ds.NewHasher(sha1.New, *workers)
+		hasher, err = ds.NewCachedHasher(*workers, "", *rehash)
 		if err != nil {
-			fmt.Println(err)
-			return
+			// The hash cache is optional, another instance may be using it.
+			log.Printf("ERR: Can't open the hash cache, hashes won't be cached. error %q", err)
+			hasher, err = ds.NewHasher(*workers)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 		}
+		defer hasher.Close()
 	}
 
 	var hm *ds.HashMap
@@ -644,13 +1198,20 @@ func main() {
 		return
 	}
 
+	ssQuota := &ds.SSQuota{}
+	if !*offline && *ssUser != "" && *ssPassword != "" {
+		if err := ssQuota.Load(ctx, dev, ss.UserInfo{*ssUser, *ssPassword}); err != nil {
+			log.Printf("ERR: Can't get ScreenScraper quota: %s", err)
+		}
+	}
+
 	for _, src := range cSrcNames {
 		switch src {
 		case "":
 		case "gdb":
 			apikey := getGamesDbAPIKey()
 
-			if !*skipCheck {
+			if !*skipCheck && !*offline {
 				if ok := gdb.IsUp(ctx, apikey); !ok {
 					fmt.Println("It appears that thegamesdb.net isn't up. If you are sure it is use -skip_check to bypass this error.")
 					continue
@@ -661,7 +1222,10 @@ func main() {
 			consoleSources = append(consoleSources, &ds.Daphne{HM: hm, APIKey: apikey})
 			consoleSources = append(consoleSources, &ds.NeoGeo{HM: hm, APIKey: apikey})
 		case "ss":
-			t := ss.Threads(ctx, dev, ss.UserInfo{*ssUser, *ssPassword})
+			t := 1
+			if !*offline {
+				t = ss.Threads(ctx, dev, ss.UserInfo{*ssUser, *ssPassword})
+			}
 			ssDS := &ds.SS{
 				HM:     hm,
 				Hasher: hasher,
@@ -672,6 +1236,7 @@ func main() {
 				Region: ssRegions,
 				Lang:   ssLangs,
 				Limit:  make(chan struct{}, t),
+				Quota:  ssQuota,
 			}
 			consoleSources = append(consoleSources, ssDS)
 		case "ovgdb":
@@ -682,6 +1247,17 @@ func main() {
 			}
 			defer o.Close()
 			consoleSources = append(consoleSources, o)
+		case "dat":
+			db, err := loadDAT()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			consoleSources = append(consoleSources, &ds.DAT{DB: db, Hasher: hasher})
+		case "gdb_search":
+			consoleSources = append(consoleSources, ds.NewGDBSearch(getGamesDbAPIKey(), hm, hasher))
+		case "header":
+			consoleSources = append(consoleSources, &ds.Header{})
 		default:
 			fmt.Printf("unknown console source :%q", src)
 			return
@@ -691,7 +1267,10 @@ func main() {
 		switch src {
 		case "":
 		case "ss":
-			t := ss.Threads(ctx, dev, ss.UserInfo{*ssUser, *ssPassword})
+			t := 1
+			if !*offline {
+				t = ss.Threads(ctx, dev, ss.UserInfo{*ssUser, *ssPassword})
+			}
 			ssMDS := &ds.SSMAME{
 				Dev:    dev,
 				User:   ss.UserInfo{*ssUser, *ssPassword},
@@ -700,6 +1279,7 @@ func main() {
 				Region: ssRegions,
 				Lang:   ssLangs,
 				Limit:  make(chan struct{}, t),
+				Quota:  ssQuota,
 			}
 			arcadeSources = append(arcadeSources, ssMDS)
 		case "mamedb":
@@ -715,6 +1295,13 @@ func main() {
 			arcadeSources = append(arcadeSources, &ds.NeoGeo{HM: hm, APIKey: apikey})
 		case "adb":
 			arcadeSources = append(arcadeSources, &ds.ADB{Limit: make(chan struct{}, 1)})
+		case "dat":
+			db, err := loadDAT()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			arcadeSources = append(arcadeSources, &ds.DAT{DB: db})
 		default:
 			fmt.Printf("Invalid MAME source %q\n", src)
 			return
@@ -728,14 +1315,21 @@ func main() {
 
 	if !*scrapeAll {
 		var sources []ds.DS
+		// The name of the directory is usually the platform.
+		platform := systemName(xmlOpts.RomDir)
 		if *mame {
-			sources = arcadeSources
+			sources = withOptions(arcadeSources, platform)
 			xmlOpts.ImgPriority = aImg
 		} else {
-			sources = consoleSources
+			sources = withOptions(consoleSources, platform)
 			xmlOpts.ImgPriority = cImg
 		}
-		err := scrape(ctx, sources, xmlOpts, gameOpts)
+		gameOpts.MergeImages = xmlOpts.ImgPriority
+		format := newFormat(formatOpts{xmlOpts: xmlOpts, name: systemName(xmlOpts.RomDir), hasher: hasher})
+		if !outputSet {
+			*outputFile = format.FileName()
+		}
+		err := scrape(ctx, sources, xmlOpts, gameOpts, format)
 		if err != nil {
 			fmt.Println(err)
 			return
@@ -749,6 +1343,17 @@ func main() {
 		origMissing := *missing
 		for _, s := range systems {
 			log.Printf("Starting System %s", s.Path)
+			restore, err := cfg.applySystem(s.Name, cli)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			xmlOpts := newXMLOpts(media)
+			gameOpts, err := newGameOpts()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 			xmlOpts.RomDir = s.Path
 			xmlOpts.RomXMLDir = s.Path
 			xmlOpts.ImgDir = s.mediaPath(*imageDir)
@@ -757,21 +1362,28 @@ func main() {
 			xmlOpts.VidXMLDir = s.mediaPath(*videoDir)
 			xmlOpts.MarqDir = s.mediaPath(*marqueeDir)
 			xmlOpts.MarqXMLDir = s.mediaPath(*marqueeDir)
-			out := filepath.Join(s.Path, "gamelist.xml")
-			*outputFile = out
 			if origMissing != "" {
 				*missing = fmt.Sprintf("%s_%s", s.Name, origMissing)
 			}
 			var sources []ds.DS
 			switch s.Platform {
 			case "arcade", "neogeo":
-				sources = arcadeSources
-				xmlOpts.ImgPriority = aImg
+				sources = withOptions(arcadeSources, s.Platform)
+				xmlOpts.ImgPriority = imgTypes(*mameImg)
 			default:
-				sources = consoleSources
-				xmlOpts.ImgPriority = cImg
+				sources = withOptions(consoleSources, s.Platform)
+				xmlOpts.ImgPriority = imgTypes(*consoleImg)
+			}
+			gameOpts.MergeImages = xmlOpts.ImgPriority
+			format := newFormat(formatOpts{xmlOpts: xmlOpts, name: s.Name, platform: s.Platform, hasher: hasher})
+			if _, ok := cfg.systems[s.Name]["output_file"]; !ok {
+				*outputFile = format.FileName()
+			}
+			if !filepath.IsAbs(*outputFile) {
+				*outputFile = filepath.Join(s.Path, *outputFile)
 			}
-			err := scrape(ctx, sources, xmlOpts, gameOpts)
+			err = scrape(ctx, sources, xmlOpts, gameOpts, format)
+			restore()
 			if err != nil {
 				fmt.Println(err)
 				return
@@ -4,5 +4,11 @@ if [ "${GIMME_OS}" = "linux" ] && [ "${GIMME_ARCH}" = "amd64" ]; then
 	go test -v ./ds
 	go test -v ./rom/hash
 	go test -v ./rom
+	go test -v ./rom/header
 	go test -v ./ss
+	go test -v ./dat
+	go test -v ./cache
+	go test -v ./limit
+	go test -v ./naming
+	go test -v ./internal/cuesheet
 fi
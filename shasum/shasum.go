@@ -1,7 +1,7 @@
 package main
 
 import (
-	"crypto/sha1"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -9,9 +9,12 @@ import (
 	"github.com/sselph/scraper/ds"
 )
 
+var digest = flag.String("digest", "sha1", "The digest to print: crc32, md5, sha1 or all.")
+
 func main() {
-	files := os.Args[1:]
-	hasher, err := ds.NewHasher(sha1.New, 1)
+	flag.Parse()
+	files := flag.Args()
+	hasher, err := ds.NewHasher(1)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -23,10 +26,23 @@ func main() {
 		if fi.IsDir() {
 			continue
 		}
-		h, err := hasher.Hash(file)
+		d, err := hasher.Digests(file)
 		if err != nil {
 			log.Fatal(err)
 		}
+		var h string
+		switch *digest {
+		case "crc32":
+			h = d.CRC32
+		case "md5":
+			h = d.MD5
+		case "sha1":
+			h = d.SHA1
+		case "all":
+			h = fmt.Sprintf("%s  %s  %s", d.CRC32, d.MD5, d.SHA1)
+		default:
+			log.Fatalf("unknown digest %q", *digest)
+		}
 		fmt.Printf("%s  %s\n", h, file)
 	}
 }
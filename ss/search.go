@@ -0,0 +1,157 @@
+package ss
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const searchPath = "api2/jeuRecherche.php"
+
+// systemIDs maps the platform names of es_systems.cfg to ScreenScraper system IDs.
+var systemIDs = map[string]int{
+	"3do":             29,
+	"amiga":           64,
+	"amstradcpc":      65,
+	"arcade":          75,
+	"atari2600":       26,
+	"atari5200":       40,
+	"atari7800":       41,
+	"atarijaguar":     27,
+	"atarilynx":       28,
+	"atarist":         42,
+	"c64":             66,
+	"coleco":          48,
+	"colecovision":    48,
+	"dreamcast":       23,
+	"fds":             106,
+	"gamegear":        21,
+	"gb":              9,
+	"gba":             12,
+	"gbc":             10,
+	"gc":              13,
+	"genesis":         1,
+	"intellivision":   115,
+	"mame":            75,
+	"mastersystem":    2,
+	"megadrive":       1,
+	"msx":             113,
+	"n64":             14,
+	"nds":             15,
+	"neogeo":          142,
+	"nes":             3,
+	"ngp":             25,
+	"ngpc":            82,
+	"pcengine":        31,
+	"pcenginecd":      114,
+	"ps2":             58,
+	"psp":             61,
+	"psx":             57,
+	"saturn":          22,
+	"scummvm":         123,
+	"sega32x":         19,
+	"segacd":          20,
+	"sg-1000":         109,
+	"snes":            4,
+	"tg16":            31,
+	"tg-cd":           114,
+	"vectrex":         102,
+	"virtualboy":      11,
+	"wii":             16,
+	"wonderswan":      45,
+	"wonderswancolor": 46,
+	"zxspectrum":      76,
+}
+
+// SystemID returns the ScreenScraper system ID for the es_systems.cfg platform.
+func SystemID(platform string) (int, bool) {
+	id, ok := systemIDs[strings.ToLower(platform)]
+	return id, ok
+}
+
+// SearchResponse is the list of games found by Search.
+type SearchResponse struct {
+	Games []Game   `json:"jeux"`
+	User  UserResp `json:"ssuser"`
+}
+
+// SearchResp is the response of Search.
+type SearchResp struct {
+	Response SearchResponse `json:"response"`
+}
+
+// Search finds the games of the system with a name like name.
+func Search(ctx context.Context, dev DevInfo, user UserInfo, name string, system int) (*SearchResp, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = searchPath
+	q := url.Values{}
+	q.Set("output", "json")
+	q.Set("devid", dev.ID)
+	q.Set("devpassword", dev.Password)
+	if dev.Name != "" {
+		q.Set("softname", dev.Name)
+	}
+	if user.ID != "" {
+		q.Set("ssid", user.ID)
+	}
+	if user.Password != "" {
+		q.Set("sspassword", user.Password)
+	}
+	if system != 0 {
+		q.Set("systemeid", strconv.Itoa(system))
+	}
+	q.Set("recherche", name)
+	u.RawQuery = q.Encode()
+	hReq, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	hReq = hReq.WithContext(ctx)
+	resp, err := Client.Do(hReq)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = SanitizeURL(uerr.URL)
+			return nil, uerr
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 430 || resp.StatusCode == 431 {
+		return nil, ErrQuota
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(b, []byte("Erreur : Jeu non trouv")) {
+		return nil, ErrNotFound
+	}
+	r := &SearchResp{}
+	if err := json.Unmarshal(b, r); err != nil {
+		if strings.HasPrefix(err.Error(), "invalid character '") && strings.HasSuffix(err.Error(), "' looking for beginning of value") {
+			return nil, fmt.Errorf("ss: %s", string(b))
+		}
+		return nil, fmt.Errorf("ss: cannot parse response: %q", err)
+	}
+	// An empty game is returned when nothing matches.
+	var games []Game
+	for _, g := range r.Response.Games {
+		if g.ID != "" {
+			games = append(games, g)
+		}
+	}
+	if len(games) == 0 {
+		return nil, ErrNotFound
+	}
+	r.Response.Games = games
+	return r, nil
+}
@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -38,6 +39,12 @@ const (
 // ErrNotFound is the error returned when a ROM isn't found.
 var ErrNotFound = errors.New("not found")
 
+// ErrQuota is the error returned when the daily quota of requests is used.
+var ErrQuota = errors.New("daily quota reached")
+
+// Client is the http.Client used to get game info. It can be replaced to cache responses.
+var Client = http.DefaultClient
+
 // DevInfo is the information about the developer and used across APIs.
 type DevInfo struct {
 	ID       string
@@ -52,21 +59,47 @@ type UserInfo struct {
 }
 
 type UserInfoResp struct {
-	ID              string `xml:"ssuser>id"`
-	Level           int    `xml:"ssuser>niveau"`
-	Contribution    int    `xml:"ssuser>contribution"`
-	UploadedSystems int    `xml:"ssuser>uploadsysteme"`
-	UploadedInfo    int    `xml:"ssuser>uploadinfos"`
-	ROMsAssociated  int    `xml:"ssuser>romasso"`
-	UpdatedMedia    int    `xml:"ssuser>uploadmedia"`
-	FavoriteRegion  string `xml:"ssuser>favregion"`
-	MaxThreads      int    `xml:"ssuser>maxthreads"`
+	ID                  string `xml:"ssuser>id"`
+	Level               int    `xml:"ssuser>niveau"`
+	Contribution        int    `xml:"ssuser>contribution"`
+	UploadedSystems     int    `xml:"ssuser>uploadsysteme"`
+	UploadedInfo        int    `xml:"ssuser>uploadinfos"`
+	ROMsAssociated      int    `xml:"ssuser>romasso"`
+	UpdatedMedia        int    `xml:"ssuser>uploadmedia"`
+	FavoriteRegion      string `xml:"ssuser>favregion"`
+	MaxThreads          int    `xml:"ssuser>maxthreads"`
+	RequestsToday       int    `xml:"ssuser>requeststoday"`
+	MaxRequestsPerDay   int    `xml:"ssuser>maxrequestsperday"`
+	RequestsKOToday     int    `xml:"ssuser>requestskotoday"`
+	MaxRequestsKOPerDay int    `xml:"ssuser>maxrequestskoperday"`
+}
+
+// Count is a number that the JSON responses may encode as a string. Values
+// that aren't numbers are decoded as 0 so they never fail the whole response.
+type Count int
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Count) UnmarshalJSON(b []byte) error {
+	i, _ := strconv.Atoi(strings.Trim(string(b), `"`))
+	*c = Count(i)
+	return nil
+}
+
+// UserResp is the information about the user included in the game info response.
+type UserResp struct {
+	ID                  string `json:"id"`
+	MaxThreads          Count  `json:"maxthreads"`
+	RequestsToday       Count  `json:"requeststoday"`
+	MaxRequestsPerDay   Count  `json:"maxrequestsperday"`
+	RequestsKOToday     Count  `json:"requestskotoday"`
+	MaxRequestsKOPerDay Count  `json:"maxrequestskoperday"`
 }
 
 // GameInfoReq is the information we use in the GameInfo command.
 type GameInfoReq struct {
 	Name    string
 	SHA1    string
+	Serial  string
 	RomType string
 }
 
@@ -101,6 +134,7 @@ type ROM struct {
 	FileName   string `json:"romfilename"`
 	SHA1       string `json:"romsha1"`
 	RegionsRaw string `json:"romregions"`
+	Serial     string `json:"romserial"`
 }
 
 type LanguageAndText struct {
@@ -239,11 +273,19 @@ func (g Game) ROM(req GameInfoReq) (ROM, bool) {
 			return x, true
 		}
 	}
+	if req.Serial != "" {
+		for _, x := range g.ROMs {
+			if strings.EqualFold(x.Serial, req.Serial) {
+				return x, true
+			}
+		}
+	}
 	return ROM{}, false
 }
 
 type Response struct {
-	Game Game `json:"jeu"`
+	Game Game     `json:"jeu"`
+	User UserResp `json:"ssuser"`
 }
 
 type GameInfoResp struct {
@@ -339,6 +381,9 @@ func GameInfo(ctx context.Context, dev DevInfo, user UserInfo, req GameInfoReq)
 	if req.SHA1 != "" {
 		q.Set("sha1", req.SHA1)
 	}
+	if req.Serial != "" {
+		q.Set("serialnum", req.Serial)
+	}
 	if req.RomType == "" {
 		q.Set("romtype", "rom")
 	} else {
@@ -354,7 +399,7 @@ func GameInfo(ctx context.Context, dev DevInfo, user UserInfo, req GameInfoReq)
 		return nil, err
 	}
 	hReq = hReq.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(hReq)
+	resp, err := Client.Do(hReq)
 	if err != nil {
 		if uerr, ok := err.(*url.Error); ok {
 			uerr.URL = SanitizeURL(uerr.URL)
@@ -363,6 +408,10 @@ func GameInfo(ctx context.Context, dev DevInfo, user UserInfo, req GameInfoReq)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	// 430 and 431 are returned when the quota of requests or requests not found is used.
+	if resp.StatusCode == 430 || resp.StatusCode == 431 {
+		return nil, ErrQuota
+	}
 	r := &GameInfoResp{}
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {